@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// Prefix of the payload anchored for a document, followed by its SHA-256
+var anchorPrefix = []byte("gocoin-anchor:")
+
+var anchorCmd = &cobra.Command{
+	Use:   "anchor",
+	Short: "Timestamp a document on chain",
+	Long:  "Anchor the SHA-256 hash of a document in a data carrier output, proving it existed once the transaction is mined",
+	Run:   anchorDocument,
+}
+
+var verifyAnchorCmd = &cobra.Command{
+	Use:   "verify-anchor",
+	Short: "Prove a document was anchored on chain",
+	Long:  "Find the confirmed transaction anchoring the hash of a document and show when it was mined",
+	Run:   verifyAnchor,
+}
+
+func init() {
+	anchorCmd.Flags().String("file", "", "Document to anchor")
+	anchorCmd.Flags().StringP("private-key", "p", "", "Private key of the wallet paying the fee")
+	anchorCmd.Flags().String("fee", common.Amount(common.MIN_FEE+(len(anchorPrefix)+sha256.Size)*common.DATA_FEE_PER_BYTE).String(), "Optional miners fee")
+
+	verifyAnchorCmd.Flags().String("file", "", "Document to verify")
+	verifyAnchorCmd.Flags().String("tx", "", "Optional transaction expected to anchor the document")
+
+	transactionCmd.AddCommand(anchorCmd)
+	transactionCmd.AddCommand(verifyAnchorCmd)
+}
+
+func anchorDocument(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		fmt.Println("Error: file is required")
+		return
+	}
+
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	payload, digest, err := anchorPayload(file)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	tx, err := wallet.CreateDataTransaction(payload, fee, blockchain.UTXOSet)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	if err := wallet.SignTransaction(tx); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	err = blockchain.SaveToFile(blockchainFile)
+	if err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+		return
+	}
+
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Document:       %s", file),
+		fmt.Sprintf("SHA-256:        %s", hex.EncodeToString(digest)),
+		fmt.Sprintf("Transaction ID: %s", hex.EncodeToString(tx.GetHash())),
+	))
+}
+
+func verifyAnchor(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		fmt.Println("Error: file is required")
+		return
+	}
+
+	txID, _ := cmd.Flags().GetString("tx")
+
+	payload, digest, err := anchorPayload(file)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	info, err := findAnchorTransaction(blockchain, txID, payload)
+	if err != nil {
+		fmt.Printf("[INVALID] %s: %s\n", file, err.Error())
+		return
+	}
+
+	fmt.Printf("[VALID] %s was anchored on chain\n", file)
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("SHA-256:        %s", hex.EncodeToString(digest)),
+		fmt.Sprintf("Transaction ID: %s", info.TransactionID),
+		fmt.Sprintf("Block height:   %d", info.BlockHeight),
+		fmt.Sprintf("Block hash:     %s", info.BlockHash),
+		fmt.Sprintf("Timestamp:      %s", blockchain.Blocks[info.BlockHeight].Timestamp.Format(time.RFC3339)),
+		fmt.Sprintf("Confirmations:  %d", info.Confirmations),
+	))
+}
+
+// Look up the anchoring transaction, checking the given one if any
+func findAnchorTransaction(bc *blockchain.Blockchain, txID string, payload []byte) (*blockchain.TxInfo, error) {
+	if txID == "" {
+		return bc.FindDataTransaction(payload)
+	}
+
+	info, err := bc.GetTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := info.Transaction.GetData(); !ok || !bytes.Equal(data, payload) {
+		return nil, fmt.Errorf("transaction %s does not anchor this document", txID)
+	}
+
+	return info, nil
+}
+
+func anchorPayload(file string) ([]byte, []byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest := sha256.Sum256(content)
+	return append(append([]byte{}, anchorPrefix...), digest[:]...), digest[:], nil
+}
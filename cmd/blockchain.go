@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
 	"github.com/spf13/cobra"
 )
 
@@ -44,8 +45,17 @@ var runCmd = &cobra.Command{
 	Run:     runContinuousMining,
 }
 
+var deploymentsCmd = &cobra.Command{
+	Use:     "deployments",
+	Aliases: []string{"d"},
+	Short:   "Show the state of each soft fork deployment",
+	Run:     listDeployments,
+}
+
 func init() {
 	mineCmd.Flags().StringP("miner", "m", "", "Wallet address to receive coinbase")
+	mineCmd.Flags().IntP("blocks", "b", 1, "Number of blocks to mine")
+	mineCmd.Flags().Bool("allow-empty", false, "Mine blocks with no pending transactions, to reach a lock height")
 
 	runCmd.Flags().StringP("miner", "m", "", "Wallet address to receive coinbase rewards")
 	runCmd.Flags().BoolP("verbose", "v", false, "Show detailed mining progress")
@@ -55,12 +65,17 @@ func init() {
 	blockchainCmd.AddCommand(validateCmd)
 	blockchainCmd.AddCommand(blocksCmd)
 	blockchainCmd.AddCommand(runCmd)
+	blockchainCmd.AddCommand(deploymentsCmd)
 
 	rootCmd.AddCommand(blockchainCmd)
 }
 
 func validateBlockchain(cmd *cobra.Command, args []string) {
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 	fmt.Printf("Is Blockchain valid: %t", blockchain.IsBlockchainValid())
 }
 
@@ -71,21 +86,69 @@ func mineBlock(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
-	if len(blockchain.Mempool.PendingTransactions) < 1 {
+	// The coinbase pays to a plain address, a block rewarding anything else
+	// wouldn't validate
+	if _, err := common.DecodeAddress(minerAddress); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blocks, _ := cmd.Flags().GetInt("blocks")
+	allowEmpty, _ := cmd.Flags().GetBool("allow-empty")
+	if blocks < 1 {
+		fmt.Println("Error: the number of blocks must be positive")
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if len(blockchain.Mempool.PendingTransactions) < 1 && !allowEmpty {
 		fmt.Println("No transactions pending")
 		return
 	}
 
-	blockchain.MineBlock(minerAddress)
-	blockchain.SaveToFile(blockchainFile)
+	// Without --allow-empty, mining stops once the mempool is empty
+	mined := 0
+	for mined < blocks && (allowEmpty || len(blockchain.Mempool.PendingTransactions) > 0) {
+		blockchain.MineBlock(minerAddress)
+		mined++
+	}
+
+	if err := blockchain.SaveToFile(blockchainFile); err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Mined %d blocks, height %d\n", mined, len(blockchain.Blocks)-1)
 }
 
 func listBlocks(cmd *cobra.Command, args []string) {
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 	fmt.Println(blockchain.Print())
 }
 
+func listDeployments(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	height := len(blockchain.Blocks)
+	fmt.Printf("Next block: %d (version 0x%08x)\n", height, blockchain.ComputeBlockVersion(height))
+
+	for _, status := range blockchain.GetDeploymentStatuses() {
+		fmt.Print(status.Print())
+	}
+}
+
 func runContinuousMining(cmd *cobra.Command, args []string) {
 	minerAddress, _ := cmd.Flags().GetString("miner")
 	if minerAddress == "" {
@@ -93,10 +156,19 @@ func runContinuousMining(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if _, err := common.DecodeAddress(minerAddress); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
 	verbose, _ := cmd.Flags().GetBool("verbose")
 	delay, _ := cmd.Flags().GetInt("delay")
 
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 
 	totalTransactions := len(blockchain.Mempool.PendingTransactions)
 	if totalTransactions == 0 {
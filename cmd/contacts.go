@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var contactsCmd = &cobra.Command{
+	Use:   "contacts",
+	Short: "Address book operations",
+	Long:  "Keep the addresses you pay under a name, so payments can be sent with tx send --to <name>",
+}
+
+var addContactCmd = &cobra.Command{
+	Use:   "add <name> <address>",
+	Short: "Add a contact to the address book",
+	Args:  cobra.ExactArgs(2),
+	Run:   addContact,
+}
+
+var listContactsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the address book",
+	Run:   listContacts,
+}
+
+var removeContactCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a contact from the address book",
+	Args:  cobra.ExactArgs(1),
+	Run:   removeContact,
+}
+
+var labelCmd = &cobra.Command{
+	Use:   "label <address|transaction ID> [label]",
+	Short: "Label an address or a transaction",
+	Long:  "Label one of your addresses or transactions, shown in the history. Without a label the current one is removed",
+	Args:  cobra.RangeArgs(1, 2),
+	Run:   setLabel,
+}
+
+func init() {
+	addContactCmd.Flags().String("notes", "", "Notes about the contact")
+
+	contactsCmd.AddCommand(addContactCmd)
+	contactsCmd.AddCommand(listContactsCmd)
+	contactsCmd.AddCommand(removeContactCmd)
+
+	walletCmd.AddCommand(contactsCmd)
+	walletCmd.AddCommand(labelCmd)
+}
+
+// Address of a contact name, or the address itself. The address book is
+// only read if there is one
+func resolveRecipient(nameOrAddress string) (string, error) {
+	book, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		return "", err
+	}
+
+	return book.ResolveAddress(nameOrAddress)
+}
+
+func addContact(cmd *cobra.Command, args []string) {
+	notes, _ := cmd.Flags().GetString("notes")
+
+	book, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if err := book.AddContact(args[0], args[1], notes); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if err := book.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Contact %s added\n", args[0])
+}
+
+func listContacts(cmd *cobra.Command, args []string) {
+	book, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if len(book.Contacts) == 0 {
+		fmt.Println("The address book is empty")
+		return
+	}
+
+	for _, c := range book.Contacts {
+		fmt.Print(common.BuildBox(
+			fmt.Sprintf("Name:    %s", c.Name),
+			fmt.Sprintf("Address: %s", c.Address),
+			fmt.Sprintf("Notes:   %s", c.Notes),
+		))
+	}
+}
+
+func removeContact(cmd *cobra.Command, args []string) {
+	book, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if err := book.RemoveContact(args[0]); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if err := book.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Contact %s removed\n", args[0])
+}
+
+func setLabel(cmd *cobra.Command, args []string) {
+	var label string
+	if len(args) > 1 {
+		label = args[1]
+	}
+
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	d.SetLabel(args[0], label)
+
+	if err := d.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	if label == "" {
+		fmt.Printf("Label of %s removed\n", args[0])
+		return
+	}
+
+	fmt.Printf("%s labeled %q\n", args[0], label)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var signMessageCmd = &cobra.Command{
+	Use:   "sign-message",
+	Short: "Sign a message with a wallet key",
+	Long:  "Sign a message proving ownership of an address without moving coins. Anyone can check the signature knowing only the address",
+	Run:   signMessage,
+}
+
+var verifyMessageCmd = &cobra.Command{
+	Use:   "verify-message",
+	Short: "Check a message was signed by an address",
+	Run:   verifyMessage,
+}
+
+func init() {
+	signMessageCmd.Flags().StringP("private-key", "p", "", "Private key of the signing wallet")
+	signMessageCmd.Flags().StringP("message", "m", "", "Message to sign")
+
+	verifyMessageCmd.Flags().StringP("address", "a", "", "Address expected to have signed the message")
+	verifyMessageCmd.Flags().StringP("message", "m", "", "Signed message")
+	verifyMessageCmd.Flags().StringP("signature", "s", "", "Signature given by sign-message")
+
+	walletCmd.AddCommand(signMessageCmd)
+	walletCmd.AddCommand(verifyMessageCmd)
+}
+
+func signMessage(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	message, _ := cmd.Flags().GetString("message")
+
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	if message == "" {
+		fmt.Println("Error: message is required")
+		return
+	}
+
+	w, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	signature, err := w.SignMessage(message)
+	if err != nil {
+		fmt.Printf("Error to sign message: %s\n", err.Error())
+		return
+	}
+
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Address:   %s", w.Address),
+		fmt.Sprintf("Signature: %s", signature),
+	))
+}
+
+func verifyMessage(cmd *cobra.Command, args []string) {
+	address, _ := cmd.Flags().GetString("address")
+	message, _ := cmd.Flags().GetString("message")
+	signature, _ := cmd.Flags().GetString("signature")
+
+	if address == "" || signature == "" {
+		fmt.Println("Error: address and signature are required")
+		return
+	}
+
+	if err := wallet.VerifyMessage(address, message, signature); err != nil {
+		fmt.Printf("Invalid signature: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Valid signature: the message was signed by %s\n", address)
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/psbt"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/spf13/cobra"
+)
+
+var psbtCmd = &cobra.Command{
+	Use:   "psbt",
+	Short: "Partially signed transaction operations",
+	Long:  "Build a transaction whose inputs are owned and signed by several parties",
+}
+
+var psbtCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a PSBT from the chosen inputs and outputs",
+	Run:   createPSBT,
+}
+
+var psbtSignCmd = &cobra.Command{
+	Use:   "sign <psbt>",
+	Short: "Sign the PSBT inputs owned by a private key",
+	Args:  cobra.ExactArgs(1),
+	Run:   signPSBT,
+}
+
+var psbtCombineCmd = &cobra.Command{
+	Use:   "combine <psbt> <psbt>...",
+	Short: "Combine the signatures of several copies of a PSBT",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   combinePSBT,
+}
+
+var psbtFinalizeCmd = &cobra.Command{
+	Use:   "finalize <psbt>",
+	Short: "Finalize a fully signed PSBT and print the raw transaction",
+	Args:  cobra.ExactArgs(1),
+	Run:   finalizePSBT,
+}
+
+var psbtDecodeCmd = &cobra.Command{
+	Use:   "decode <psbt>",
+	Short: "Show the inputs of a PSBT and which are signed",
+	Args:  cobra.ExactArgs(1),
+	Run:   decodePSBT,
+}
+
+func init() {
+	addRawTransactionFlags(psbtCreateCmd)
+	psbtCreateCmd.Flags().StringArray("meta", nil, "Metadata as key=value (repeatable)")
+	psbtCreateCmd.Flags().StringArray("redeem-script", nil, "Hex multisig script of an input script address (repeatable)")
+
+	psbtSignCmd.Flags().StringP("private-key", "p", "", "The private key to sign the inputs with")
+	psbtSignCmd.Flags().String("extended-key", "", "Extended private key to sign the inputs of a watch-only wallet with")
+
+	psbtFinalizeCmd.Flags().Bool("json", false, "Print the transaction as JSON instead of hex")
+
+	psbtCmd.AddCommand(psbtCreateCmd)
+	psbtCmd.AddCommand(psbtSignCmd)
+	psbtCmd.AddCommand(psbtCombineCmd)
+	psbtCmd.AddCommand(psbtFinalizeCmd)
+	psbtCmd.AddCommand(psbtDecodeCmd)
+
+	rootCmd.AddCommand(psbtCmd)
+}
+
+func createPSBT(cmd *cobra.Command, args []string) {
+	meta, _ := cmd.Flags().GetStringArray("meta")
+	redeemScripts, _ := cmd.Flags().GetStringArray("redeem-script")
+
+	tx, err := buildRawTransaction(cmd)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	p, err := psbt.NewPSBT(tx, blockchain.UTXOSet)
+	if err != nil {
+		fmt.Printf("Error to create PSBT: %s\n", err.Error())
+		return
+	}
+
+	for _, encoded := range redeemScripts {
+		redeemScript, err := hex.DecodeString(encoded)
+		if err != nil {
+			fmt.Printf("Error: invalid redeem script: %s\n", err.Error())
+			return
+		}
+
+		if _, err := p.AddRedeemScript(redeemScript); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	for _, m := range meta {
+		key, value, ok := strings.Cut(m, "=")
+		if !ok {
+			fmt.Printf("Error: invalid metadata %q, expected key=value\n", m)
+			return
+		}
+		p.Metadata[key] = value
+	}
+
+	printPSBT(p)
+}
+
+func signPSBT(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	extendedKey, _ := cmd.Flags().GetString("extended-key")
+	if privateKey == "" && extendedKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	p, err := psbt.Decode(args[0])
+	if err != nil {
+		fmt.Printf("Error to decode PSBT: %s\n", err.Error())
+		return
+	}
+
+	var signed int
+	if extendedKey != "" {
+		key, parseErr := wallet.ParseExtendedKey(extendedKey)
+		if parseErr != nil {
+			fmt.Printf("Error: %s\n", parseErr.Error())
+			return
+		}
+
+		signed, err = p.SignWithExtendedKey(key)
+	} else {
+		w, loadErr := wallet.LoadWallet(privateKey)
+		if loadErr != nil {
+			fmt.Printf("Error: %s\n", loadErr.Error())
+			return
+		}
+
+		signed, err = p.Sign(w)
+	}
+	if err != nil {
+		fmt.Printf("Error to sign PSBT: %s\n", err.Error())
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Signed %d of %d inputs\n", signed, len(p.Inputs))
+	printPSBT(p)
+}
+
+func combinePSBT(cmd *cobra.Command, args []string) {
+	psbts := make([]*psbt.PSBT, 0)
+	for _, arg := range args {
+		p, err := psbt.Decode(arg)
+		if err != nil {
+			fmt.Printf("Error to decode PSBT: %s\n", err.Error())
+			return
+		}
+		psbts = append(psbts, p)
+	}
+
+	err := psbts[0].Combine(psbts[1:]...)
+	if err != nil {
+		fmt.Printf("Error to combine PSBTs: %s\n", err.Error())
+		return
+	}
+
+	printPSBT(psbts[0])
+}
+
+func finalizePSBT(cmd *cobra.Command, args []string) {
+	asJson, _ := cmd.Flags().GetBool("json")
+
+	p, err := psbt.Decode(args[0])
+	if err != nil {
+		fmt.Printf("Error to decode PSBT: %s\n", err.Error())
+		return
+	}
+
+	err = p.Finalize()
+	if err != nil {
+		fmt.Printf("Error to finalize PSBT: %s\n", err.Error())
+		return
+	}
+
+	tx, err := p.Extract()
+	if err != nil {
+		fmt.Printf("Error to extract transaction: %s\n", err.Error())
+		return
+	}
+
+	printRawTransaction(tx, asJson)
+}
+
+func decodePSBT(cmd *cobra.Command, args []string) {
+	p, err := psbt.Decode(args[0])
+	if err != nil {
+		fmt.Printf("Error to decode PSBT: %s\n", err.Error())
+		return
+	}
+
+	fmt.Println(p.Print())
+}
+
+func printPSBT(p *psbt.PSBT) {
+	encoded, err := p.Encode()
+	if err != nil {
+		fmt.Printf("Error to encode PSBT: %s\n", err.Error())
+		return
+	}
+
+	fmt.Println(encoded)
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var createRawCmd = &cobra.Command{
+	Use:   "create-raw",
+	Short: "Create an unsigned transaction",
+	Long:  "Create an unsigned transaction from the chosen inputs and outputs, to be signed with sign-raw",
+	Run:   createRawTransaction,
+}
+
+var signRawCmd = &cobra.Command{
+	Use:   "sign-raw <hex|json>",
+	Short: "Sign a raw transaction",
+	Long:  "Sign the inputs of a raw transaction owned by the key. Inputs without a public key are found in the blockchain file, so an offline machine needs a copy of it",
+	Args:  cobra.ExactArgs(1),
+	Run:   signRawTransaction,
+}
+
+var submitRawCmd = &cobra.Command{
+	Use:   "submit-raw <hex|json>",
+	Short: "Submit a signed raw transaction",
+	Long:  "Validate a signed raw transaction and add it to the pending transactions",
+	Args:  cobra.ExactArgs(1),
+	Run:   submitRawTransaction,
+}
+
+func init() {
+	addRawTransactionFlags(createRawCmd)
+	createRawCmd.Flags().Bool("json", false, "Print the transaction as JSON instead of hex")
+
+	signRawCmd.Flags().StringP("private-key", "p", "", "The private key to sign the inputs with")
+	signRawCmd.Flags().StringP("address", "a", "", "Address of a key stored in the wallet database to sign with")
+	signRawCmd.Flags().Bool("json", false, "Print the transaction as JSON instead of hex")
+
+	transactionCmd.AddCommand(createRawCmd)
+	transactionCmd.AddCommand(signRawCmd)
+	transactionCmd.AddCommand(submitRawCmd)
+}
+
+func createRawTransaction(cmd *cobra.Command, args []string) {
+	asJson, _ := cmd.Flags().GetBool("json")
+
+	tx, err := buildRawTransaction(cmd)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	var totalInputs common.Amount
+	for _, input := range tx.Inputs {
+		utxo := blockchain.UTXOSet.GetUTXO(input.TransactionID, input.OutputIndex)
+		if utxo == nil {
+			fmt.Printf("Error: UTXO %s:%d does not exist\n", input.TransactionID, input.OutputIndex)
+			return
+		}
+
+		if totalInputs, err = totalInputs.Add(utxo.Amount); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	totalOutputs, err := tx.TotalOutputs()
+	if err == nil {
+		totalOutputs, err = totalOutputs.Add(tx.Fee)
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if totalInputs < totalOutputs {
+		fmt.Printf("Error: inputs (%s) don't cover outputs plus fee (%s)\n", totalInputs, totalOutputs)
+		return
+	}
+
+	if totalInputs > totalOutputs {
+		fmt.Fprintf(os.Stderr, "Warning: %s coins not assigned to any output will also go to the miner\n",
+			totalInputs-totalOutputs)
+	}
+
+	printRawTransaction(tx, asJson)
+}
+
+// Build an unsigned transaction from the --input, --output, --fee and
+// --message flags
+func buildRawTransaction(cmd *cobra.Command) (*transaction.Transaction, error) {
+	rawInputs, _ := cmd.Flags().GetStringArray("input")
+	rawOutputs, _ := cmd.Flags().GetStringArray("output")
+	message, _ := cmd.Flags().GetString("message")
+	lockTime, _ := cmd.Flags().GetString("lock-time")
+	sequence, _ := cmd.Flags().GetUint32("sequence")
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make([]transaction.TransactionInput, 0)
+	for _, rawInput := range rawInputs {
+		txID, outputIndex, err := transaction.ParseOutpoint(rawInput)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, transaction.TransactionInput{
+			TransactionID: txID,
+			OutputIndex:   outputIndex,
+			Sequence:      sequence,
+		})
+	}
+
+	outputs := make([]transaction.TransactionOutput, 0)
+	for _, rawOutput := range rawOutputs {
+		output, err := parseOutput(rawOutput)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs = append(outputs, *output)
+	}
+
+	if fee < common.MIN_FEE {
+		return nil, errors.New("fee less than min")
+	}
+
+	tx, err := transaction.NewRawTransaction(inputs, outputs, fee, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockTime != "" {
+		lock, err := parseLockUntil(lockTime)
+		if err != nil {
+			return nil, err
+		}
+		tx.LockTime = uint64(lock)
+	}
+
+	return tx, nil
+}
+
+func addRawTransactionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("input", "i", nil, "Outpoint to spend as txid:index (repeatable)")
+	cmd.Flags().StringArrayP("output", "o", nil, "Output as address:amount (repeatable)")
+	cmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Miners fee")
+	cmd.Flags().StringP("message", "m", "", "Optional message")
+	cmd.Flags().String("lock-time", "", "Block height or date before which the transaction can't be confirmed")
+	cmd.Flags().Uint32("sequence", 0, "Blocks each input must have been confirmed for")
+}
+
+func signRawTransaction(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	address, _ := cmd.Flags().GetString("address")
+	asJson, _ := cmd.Flags().GetBool("json")
+
+	if (privateKey == "") == (address == "") {
+		fmt.Println("Error: either a private key or a stored address is required")
+		return
+	}
+
+	tx, err := parseRawTransaction(args[0])
+	if err != nil {
+		fmt.Printf("Error to decode transaction: %s\n", err.Error())
+		return
+	}
+
+	var w *wallet.Wallet
+	if privateKey != "" {
+		w, err = wallet.LoadWallet(privateKey)
+	} else {
+		var d *wallet.Database
+		if d, err = wallet.LoadDatabase(walletFile); err == nil {
+			w, err = d.GetWallet(address)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	// Inputs without a public key are matched to their UTXOs, when there is
+	// a blockchain file to find them in
+	var utxoSet *utxo.UTXOSet
+	if _, err := os.Stat(blockchainFile); err == nil {
+		blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+		utxoSet = blockchain.UTXOSet
+	}
+
+	if err := w.SignTransaction(tx, utxoSet); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+
+	printRawTransaction(tx, asJson)
+}
+
+func submitRawTransaction(cmd *cobra.Command, args []string) {
+	tx, err := parseRawTransaction(args[0])
+	if err != nil {
+		fmt.Printf("Error to decode transaction: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if blockchain.Mempool.Contains(tx) {
+		fmt.Println("Error: transaction already pending")
+		return
+	}
+
+	err = blockchain.AddTransaction(tx)
+	if err != nil {
+		fmt.Printf("Error to submit transaction: %s\n", err.Error())
+		return
+	}
+
+	err = blockchain.SaveToFile(blockchainFile)
+	if err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Transaction submitted: %s\n", hex.EncodeToString(tx.GetHash()))
+}
+
+// Raw transactions are accepted both as hex encoded binary and as JSON
+func parseRawTransaction(raw string) (*transaction.Transaction, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "{") {
+		return transaction.ParseTransactionJson([]byte(raw))
+	}
+
+	data, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction.DeserializeTransaction(data)
+}
+
+func printRawTransaction(tx *transaction.Transaction, asJson bool) {
+	if asJson {
+		fmt.Print(tx.Json())
+		return
+	}
+
+	fmt.Println(hex.EncodeToString(tx.Serialize()))
+}
+
+func parseOutput(rawOutput string) (*transaction.TransactionOutput, error) {
+	index := strings.LastIndex(rawOutput, ":")
+	if index <= 0 {
+		return nil, fmt.Errorf("invalid output %q, expected address:amount", rawOutput)
+	}
+
+	amount, err := common.ParseAmount(rawOutput[index+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid output amount: %w", err)
+	}
+
+	if amount == 0 {
+		return nil, errors.New("output amount must be positive")
+	}
+
+	output, err := transaction.NewOutput(rawOutput[:index], amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
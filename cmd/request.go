@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+)
+
+var requestCmd = &cobra.Command{
+	Use:   "request",
+	Short: "Request a payment",
+	Long:  "Create an invoice paying to a new wallet address and print it as a gocoin: URI, with a QR code, for the payer to use with tx send --uri",
+	Run:   requestPayment,
+}
+
+var invoicesCmd = &cobra.Command{
+	Use:   "invoices",
+	Short: "List the payment requests and whether they were paid",
+	Run:   listInvoices,
+}
+
+func init() {
+	requestCmd.Flags().StringP("amount", "a", "0", "Amount requested (default: the payer chooses)")
+	requestCmd.Flags().StringP("label", "l", "", "Name of who is requesting the payment")
+	requestCmd.Flags().StringP("message", "m", "", "What the payment is for")
+	requestCmd.Flags().String("expires", "", "How long the request is valid, e.g. 24h (default: never expires)")
+	requestCmd.Flags().String("address", "", "Wallet address to be paid (default: a new one)")
+	requestCmd.Flags().Bool("qr", true, "Print a QR code of the request")
+
+	walletCmd.AddCommand(requestCmd)
+	walletCmd.AddCommand(invoicesCmd)
+}
+
+func requestPayment(cmd *cobra.Command, args []string) {
+	label, _ := cmd.Flags().GetString("label")
+	message, _ := cmd.Flags().GetString("message")
+	expires, _ := cmd.Flags().GetString("expires")
+	address, _ := cmd.Flags().GetString("address")
+	showQR, _ := cmd.Flags().GetBool("qr")
+
+	amount, err := getAmountFlag(cmd, "amount")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	request := wallet.PaymentRequest{
+		Address: address,
+		Amount:  amount,
+		Label:   label,
+		Message: message,
+	}
+
+	if expires != "" {
+		validity, err := time.ParseDuration(expires)
+		if err != nil || validity <= 0 {
+			fmt.Printf("Error: invalid expiry %q, expected a duration like 24h\n", expires)
+			return
+		}
+		request.Expires = time.Now().Add(validity).Truncate(time.Second)
+	}
+
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if request.Address == "" {
+		w, err := d.NewKey()
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+		request.Address = w.Address
+	}
+
+	invoice, err := d.AddInvoice(request)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if err := d.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	printInvoice(invoice)
+	fmt.Println(request.URI())
+
+	if showQR {
+		qr, err := qrcode.New(request.URI(), qrcode.Medium)
+		if err != nil {
+			fmt.Printf("Error to create QR code: %s\n", err.Error())
+			return
+		}
+		fmt.Print(qr.ToSmallString(false))
+	}
+}
+
+func listInvoices(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	d, err := loadWalletDatabase(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if len(d.Invoices) == 0 {
+		fmt.Println("No payment requests")
+		return
+	}
+
+	for _, invoice := range d.Invoices {
+		printInvoice(invoice)
+	}
+}
+
+func printInvoice(invoice *wallet.Invoice) {
+	amount := "any"
+	if invoice.Amount > 0 {
+		amount = formatAmount(invoice.Amount)
+	}
+
+	expires := "never"
+	if !invoice.Expires.IsZero() {
+		expires = invoice.Expires.Format(time.RFC3339)
+	}
+
+	lines := []string{
+		fmt.Sprintf("Invoice: %d", invoice.ID),
+		fmt.Sprintf("Address: %s", invoice.Address),
+		fmt.Sprintf("Amount:  %s", amount),
+		fmt.Sprintf("Label:   %s", invoice.Label),
+		fmt.Sprintf("Message: %s", invoice.Message),
+		fmt.Sprintf("Expires: %s", expires),
+		fmt.Sprintf("Status:  %s", invoice.Status()),
+	}
+	if invoice.IsPaid() {
+		lines = append(lines, fmt.Sprintf("Paid by: %s (block %d)", invoice.PaidBy, invoice.PaidHeight))
+	}
+
+	fmt.Print(common.BuildBox(lines...))
+}
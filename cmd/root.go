@@ -7,6 +7,7 @@ import (
 )
 
 var blockchainFile string
+var walletFile string
 
 var rootCmd = &cobra.Command{
 	Use:   "go-coin",
@@ -21,5 +22,6 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&blockchainFile, "blockchain-file", "f", "blockchain.json", "Path to blockchain file")
+	rootCmd.PersistentFlags().StringVarP(&blockchainFile, "blockchain-file", "f", "blockchain.dat", "Path to blockchain file, kept as JSON when named .json")
+	rootCmd.PersistentFlags().StringVar(&walletFile, "wallet-file", "wallet.json", "Path to the wallet database")
 }
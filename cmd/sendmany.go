@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var sendManyCmd = &cobra.Command{
+	Use:   "send-many",
+	Short: "Pay many recipients in a single transaction",
+	Long:  "Pay every address,amount line of a CSV file in a single transaction, showing a summary before signing",
+	Run:   sendManyTransaction,
+}
+
+func init() {
+	sendManyCmd.Flags().String("csv", "", "CSV file with one address,amount line per recipient")
+	sendManyCmd.Flags().StringP("private-key", "p", "", "The from address private key to autenticate")
+	sendManyCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Optional miners fee")
+	sendManyCmd.Flags().StringP("message", "m", "", "Optional message")
+	sendManyCmd.Flags().BoolP("yes", "y", false, "Sign and submit without asking for confirmation")
+
+	transactionCmd.AddCommand(sendManyCmd)
+}
+
+func sendManyTransaction(cmd *cobra.Command, args []string) {
+	csvFile, _ := cmd.Flags().GetString("csv")
+	if csvFile == "" {
+		fmt.Println("Error: csv file is required")
+		return
+	}
+
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	message, _ := cmd.Flags().GetString("message")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	payments, err := readPaymentsCSV(csvFile, wallet.Address)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	tx, err := wallet.CreateBatchTransaction(payments, fee, blockchain.UTXOSet, message)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	if err := printBatchSummary(tx, payments); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if !yes && !confirm("Sign and submit this transaction?") {
+		fmt.Println("Aborted")
+		return
+	}
+
+	if err := wallet.SignTransaction(tx); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	err = blockchain.SaveToFile(blockchainFile)
+	if err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+	}
+}
+
+// Read address,amount lines, skipping an optional header. Every line is
+// checked, so all the bad ones are reported at once
+func readPaymentsCSV(filename string, senderAddress string) ([]transaction.Payment, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	payments := make([]transaction.Payment, 0)
+	problems := make([]string, 0)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		if len(record) != 2 {
+			problems = append(problems, fmt.Sprintf("line %d: expected address,amount", line))
+			continue
+		}
+
+		address := strings.TrimSpace(record[0])
+		amount, err := common.ParseAmount(record[1])
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			problems = append(problems, fmt.Sprintf("line %d: %s", line, err.Error()))
+			continue
+		}
+
+		payment := transaction.Payment{
+			Address: address,
+			Amount:  amount,
+		}
+		if err := transaction.ValidatePayment(senderAddress, payment); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %s", line, err.Error()))
+			continue
+		}
+
+		payments = append(payments, payment)
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New("invalid payments file:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	if len(payments) == 0 {
+		return nil, errors.New("payments file has no payments")
+	}
+
+	return payments, nil
+}
+
+func printBatchSummary(tx *transaction.Transaction, payments []transaction.Payment) error {
+	var total common.Amount
+	lines := make([]string, 0, len(payments)+6)
+	for _, p := range payments {
+		lines = append(lines, fmt.Sprintf("%s  %s", p.Address, formatAmount(p.Amount)))
+
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return err
+		}
+	}
+
+	var change common.Amount
+	if len(tx.Outputs) > len(payments) {
+		change = tx.Outputs[len(tx.Outputs)-1].Amount
+	}
+
+	lines = append(lines,
+		"",
+		fmt.Sprintf("Recipients: %d", len(payments)),
+		fmt.Sprintf("Total:      %s", formatAmount(total)),
+		fmt.Sprintf("Fee:        %s", formatAmount(tx.Fee)),
+		fmt.Sprintf("Change:     %s", formatAmount(change)),
+		fmt.Sprintf("Inputs:     %d", len(tx.Inputs)),
+	)
+
+	fmt.Print(common.BuildBox(lines...))
+	return nil
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
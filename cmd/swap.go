@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/swap"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var swapCmd = &cobra.Command{
+	Use:   "swap",
+	Short: "Atomic swap operations",
+	Long: `Trade coins between two chains with hash time-locked contracts.
+
+The initiator locks coins to the participant behind the hash of a secret, the
+participant locks coins on the other chain behind the same hash. Redeeming the
+participant contract reveals the secret, which lets the participant redeem the
+initiator contract. If anyone walks away, both sides get refunded once their
+contract lock time passes.`,
+}
+
+var swapInitiateCmd = &cobra.Command{
+	Use:   "initiate",
+	Short: "Create a secret and lock coins to the participant",
+	Run:   initiateSwap,
+}
+
+var swapParticipateCmd = &cobra.Command{
+	Use:   "participate",
+	Short: "Lock coins to the initiator behind the initiator secret hash",
+	Run:   participateSwap,
+}
+
+var swapRedeemCmd = &cobra.Command{
+	Use:   "redeem",
+	Short: "Claim the coins of a contract revealing its secret",
+	Run:   redeemSwap,
+}
+
+var swapRefundCmd = &cobra.Command{
+	Use:   "refund",
+	Short: "Take back the coins of a contract once its lock time passes",
+	Run:   refundSwap,
+}
+
+var swapAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Check a contract and its funding transaction",
+	Run:   auditSwap,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{swapInitiateCmd, swapParticipateCmd} {
+		c.Flags().StringP("to", "t", "", "Address of the other party")
+		c.Flags().StringP("amount", "a", "0", "Quantity to lock in the contract")
+		c.Flags().StringP("private-key", "p", "", "Private key of the wallet funding the contract")
+		c.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Miners fee")
+	}
+	swapInitiateCmd.Flags().Int("lock-blocks", 48, "Blocks until the coins can be refunded")
+	swapParticipateCmd.Flags().Int("lock-blocks", 24, "Blocks until the coins can be refunded, must be less than the initiator's")
+	swapParticipateCmd.Flags().String("secret-hash", "", "Secret hash of the initiator contract")
+	swapParticipateCmd.Flags().Int("initiator-blocks-left", 0, "Blocks left until the initiator contract can be refunded, as shown by swap audit")
+
+	for _, c := range []*cobra.Command{swapRedeemCmd, swapRefundCmd, swapAuditCmd} {
+		c.Flags().String("contract", "", "Hex encoded contract script")
+		c.Flags().String("contract-tx", "", "ID of the transaction funding the contract")
+	}
+	for _, c := range []*cobra.Command{swapRedeemCmd, swapRefundCmd} {
+		c.Flags().StringP("private-key", "p", "", "Private key of the wallet receiving the coins")
+		c.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Miners fee")
+	}
+	swapRedeemCmd.Flags().String("secret", "", "Hex encoded secret")
+	swapAuditCmd.Flags().String("other-contract", "", "Hex encoded contract script of the other side")
+	swapAuditCmd.Flags().String("other-contract-tx", "", "ID of the transaction funding the contract of the other side")
+	swapAuditCmd.Flags().String("other-blockchain-file", "", "Path to the blockchain file of the other side")
+
+	swapCmd.AddCommand(swapInitiateCmd)
+	swapCmd.AddCommand(swapParticipateCmd)
+	swapCmd.AddCommand(swapRedeemCmd)
+	swapCmd.AddCommand(swapRefundCmd)
+	swapCmd.AddCommand(swapAuditCmd)
+
+	rootCmd.AddCommand(swapCmd)
+}
+
+func initiateSwap(cmd *cobra.Command, args []string) {
+	secret, secretHash, err := swap.NewSecret()
+	if err != nil {
+		fmt.Printf("Error to create secret: %s\n", err.Error())
+		return
+	}
+
+	contract, txID, err := fundContract(cmd, secretHash)
+	if err != nil {
+		fmt.Printf("Error to initiate swap: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Secret:      %s\n", hex.EncodeToString(secret))
+	fmt.Println("Keep the secret private until the participant contract is confirmed")
+	printContract(contract, txID)
+}
+
+func participateSwap(cmd *cobra.Command, args []string) {
+	encodedHash, _ := cmd.Flags().GetString("secret-hash")
+	secretHash, err := hex.DecodeString(encodedHash)
+	if err != nil || len(secretHash) != 32 {
+		fmt.Println("Error: a hex encoded SHA-256 secret hash is required")
+		return
+	}
+
+	// The initiator redeems after the participant, with the secret the
+	// participant's redeem reveals, so the participant contract must be
+	// refundable first
+	initiatorBlocksLeft, _ := cmd.Flags().GetInt("initiator-blocks-left")
+	lockBlocks, _ := cmd.Flags().GetInt("lock-blocks")
+	if initiatorBlocksLeft <= 0 {
+		fmt.Println("Error: the blocks left on the initiator contract are required, see swap audit")
+		return
+	}
+	if lockBlocks >= initiatorBlocksLeft {
+		fmt.Printf("Error: lock blocks must be less than the %d left on the initiator contract\n", initiatorBlocksLeft)
+		return
+	}
+
+	contract, txID, err := fundContract(cmd, secretHash)
+	if err != nil {
+		fmt.Printf("Error to participate in swap: %s\n", err.Error())
+		return
+	}
+
+	printContract(contract, txID)
+}
+
+// Create the contract and send the coins to it from the wallet
+func fundContract(cmd *cobra.Command, secretHash []byte) (*swap.Contract, string, error) {
+	to, _ := cmd.Flags().GetString("to")
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	lockBlocks, _ := cmd.Flags().GetInt("lock-blocks")
+
+	if to == "" || privateKey == "" {
+		return nil, "", errors.New("recipient address and private key are required")
+	}
+
+	amount, err := getAmountFlag(cmd, "amount")
+	if err != nil {
+		return nil, "", err
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if lockBlocks <= 0 {
+		return nil, "", errors.New("lock blocks must be positive")
+	}
+
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lockTime := int64(len(blockchain.Blocks) - 1 + lockBlocks)
+	contract, err := swap.NewContract(secretHash, to, wallet.Address, lockTime)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx, err := wallet.CreateTransaction(contract.Address(), amount, fee, blockchain.UTXOSet, "Swap contract")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := wallet.SignTransaction(tx); err != nil {
+		return nil, "", err
+	}
+
+	if err := blockchain.AddTransaction(tx); err != nil {
+		return nil, "", err
+	}
+
+	if err := blockchain.SaveToFile(blockchainFile); err != nil {
+		return nil, "", err
+	}
+
+	return contract, hex.EncodeToString(tx.GetHash()), nil
+}
+
+func redeemSwap(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	encodedSecret, _ := cmd.Flags().GetString("secret")
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	secret, err := hex.DecodeString(encodedSecret)
+	if err != nil || len(secret) == 0 {
+		fmt.Println("Error: a hex encoded secret is required")
+		return
+	}
+
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	w, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	contract, txID, outputIndex, amount, err := loadContract(cmd, blockchain)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	tx, err := contract.NewRedeemTransaction(txID, outputIndex, amount, fee, w, secret)
+	if err != nil {
+		fmt.Printf("Error to redeem contract: %s\n", err.Error())
+		return
+	}
+
+	submitSwapTransaction(blockchain, tx)
+}
+
+func refundSwap(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	w, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	contract, txID, outputIndex, amount, err := loadContract(cmd, blockchain)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	tx, err := contract.NewRefundTransaction(txID, outputIndex, amount, fee, w)
+	if err != nil {
+		fmt.Printf("Error to refund contract: %s\n", err.Error())
+		return
+	}
+
+	submitSwapTransaction(blockchain, tx)
+}
+
+func auditSwap(cmd *cobra.Command, args []string) {
+	// The contract of the other side is on the other chain
+	var otherBlockchain *blockchain.Blockchain
+	if otherBlockchainFile, _ := cmd.Flags().GetString("other-blockchain-file"); otherBlockchainFile != "" {
+		var err error
+		if otherBlockchain, err = blockchain.LoadFromFile(otherBlockchainFile); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	contract, err := auditContract(cmd, blockchain)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if otherBlockchain == nil {
+		return
+	}
+
+	other, err := auditContract(cmd, otherBlockchain, "other-")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if !bytes.Equal(contract.SecretHash, other.SecretHash) {
+		fmt.Println("Error: the contracts have different secret hashes")
+	}
+}
+
+// Print a contract, what became of it and how many blocks are left until it
+// can be refunded
+func auditContract(cmd *cobra.Command, blockchain *blockchain.Blockchain, prefix ...string) (*swap.Contract, error) {
+	contract, txID, outputIndex, amount, err := loadContract(cmd, blockchain, prefix...)
+	if err != nil {
+		return nil, err
+	}
+
+	info, _ := blockchain.GetTransaction(txID)
+	tipHeight := len(blockchain.Blocks) - 1
+	blocksLeft := max(contract.LockTime-int64(tipHeight+1), 0)
+
+	status := "unspent"
+	if !blockchain.UTXOSet.UTXOExists(txID, uint(outputIndex)) {
+		status = "refunded"
+		for _, spenderID := range blockchain.AddressIndex[contract.Address()] {
+			spender, err := blockchain.GetTransaction(spenderID)
+			if err != nil || spenderID == txID {
+				continue
+			}
+
+			if secret, err := contract.ExtractSecret(spender.Transaction); err == nil {
+				status = fmt.Sprintf("redeemed, secret: %s", hex.EncodeToString(secret))
+			}
+		}
+	} else if blocksLeft == 0 {
+		status = "unspent, refundable"
+	}
+
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Contract address:  %s", contract.Address()),
+		fmt.Sprintf("Amount:            %s", amount),
+		fmt.Sprintf("Recipient address: %s", contract.RecipientAddress),
+		fmt.Sprintf("Refund address:    %s", contract.RefundAddress),
+		fmt.Sprintf("Secret hash:       %s", hex.EncodeToString(contract.SecretHash)),
+		fmt.Sprintf("Lock time:         block %d (current %d)", contract.LockTime, tipHeight),
+		fmt.Sprintf("Blocks left:       %d", blocksLeft),
+		fmt.Sprintf("Confirmations:     %d", info.Confirmations),
+		fmt.Sprintf("Status:            %s", status),
+	))
+
+	return contract, nil
+}
+
+// Parse the --contract and --contract-tx flags, or the ones with the given
+// prefix, and find the contract output in the blockchain
+func loadContract(cmd *cobra.Command, blockchain *blockchain.Blockchain, prefix ...string) (*swap.Contract, string, int, common.Amount, error) {
+	var flagPrefix string
+	if len(prefix) > 0 {
+		flagPrefix = prefix[0]
+	}
+
+	encodedContract, _ := cmd.Flags().GetString(flagPrefix + "contract")
+	txID, _ := cmd.Flags().GetString(flagPrefix + "contract-tx")
+
+	contractScript, err := hex.DecodeString(encodedContract)
+	if err != nil || len(contractScript) == 0 {
+		return nil, "", 0, 0, errors.New("a hex encoded contract is required")
+	}
+
+	contract, err := swap.ParseContract(contractScript)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	info, err := blockchain.GetTransaction(txID)
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("contract transaction: %w", err)
+	}
+
+	outputIndex, err := contract.FindOutput(info.Transaction)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	return contract, txID, outputIndex, info.Transaction.Outputs[outputIndex].Amount, nil
+}
+
+func submitSwapTransaction(blockchain *blockchain.Blockchain, tx *transaction.Transaction) {
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error to submit transaction: %s\n", err.Error())
+		return
+	}
+
+	if err := blockchain.SaveToFile(blockchainFile); err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Transaction submitted: %s\n", hex.EncodeToString(tx.GetHash()))
+}
+
+func printContract(contract *swap.Contract, txID string) {
+	fmt.Printf("Secret hash: %s\n", hex.EncodeToString(contract.SecretHash))
+	fmt.Printf("Contract:    %s\n", hex.EncodeToString(contract.Script))
+	fmt.Printf("Contract tx: %s\n", txID)
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Contract address:  %s", contract.Address()),
+		fmt.Sprintf("Recipient address: %s", contract.RecipientAddress),
+		fmt.Sprintf("Refund address:    %s", contract.RefundAddress),
+		fmt.Sprintf("Lock time:         block %d", contract.LockTime),
+	))
+}
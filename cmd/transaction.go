@@ -1,13 +1,16 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/FilipeJohansson/go-coin/internal/blockchain"
 	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
 	"github.com/FilipeJohansson/go-coin/internal/wallet"
 	"github.com/FilipeJohansson/go-coin/pkg/common"
 	"github.com/spf13/cobra"
@@ -41,61 +44,220 @@ var generateCmd = &cobra.Command{
 	Run:     generateTransactions,
 }
 
+var showCmd = &cobra.Command{
+	Use:   "show <txid>",
+	Short: "Show a confirmed transaction",
+	Long:  "Show a confirmed transaction with its resolved inputs, fee and block info",
+	Args:  cobra.ExactArgs(1),
+	Run:   showTransaction,
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode <hex>",
+	Short: "Decode a raw transaction",
+	Long:  "Decode a transaction from its hex encoded binary serialization",
+	Args:  cobra.ExactArgs(1),
+	Run:   decodeTransaction,
+}
+
 func init() {
-	sendCmd.Flags().StringP("to", "t", "", "Recipient address")
-	sendCmd.Flags().StringP("private-key", "p", "", "The from address private key to autenticate")
-	sendCmd.Flags().Float64P("amount", "a", 0, "Quantity to send from sender to recipient")
-	sendCmd.Flags().Float64("fee", float64(common.MIN_FEE)/float64(common.COINS_PER_UNIT), "Optional miners fee")
+	sendCmd.Flags().StringP("to", "t", "", "Recipient address or contact name")
+	sendCmd.Flags().String("uri", "", "Pay a gocoin: payment request URI")
+	sendCmd.Flags().StringArrayP("private-key", "p", nil, "The from address private key to autenticate, repeatable to spend from several addresses")
+	sendCmd.Flags().StringP("amount", "a", "0", "Quantity to send from sender to recipient")
+	sendCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Optional miners fee")
 	sendCmd.Flags().StringP("message", "m", "", "Optional message")
+	sendCmd.Flags().String("lock-until", "", "Lock the sent coins until a block height or a date (YYYY-MM-DD or RFC 3339)")
+	sendCmd.Flags().String("coin-selection", "", fmt.Sprintf("Coin selection strategy (%s)", strings.Join(utxo.CoinSelectors, ", ")))
+	sendCmd.Flags().StringArray("utxo", nil, "UTXO to spend as txid:index, repeatable")
+
+	showCmd.Flags().Bool("raw", false, "Print the hex encoded binary serialization")
 
 	generateCmd.Flags().IntP("count", "c", 10, "Number of transactions to generate")
 	generateCmd.Flags().IntP("wallets", "w", 5, "Number of wallets to create and use")
-	generateCmd.Flags().Float64("min-amount", 0.1, "Minimum transaction amount")
-	generateCmd.Flags().Float64("max-amount", 10.0, "Maximum transaction amount")
-	generateCmd.Flags().Float64("fee", float64(common.MIN_FEE)/float64(common.COINS_PER_UNIT), "Transaction fee")
-	generateCmd.Flags().Bool("fund-wallets", true, "Create funding transactions for wallets")
+	generateCmd.Flags().String("min-amount", "0.1", "Minimum transaction amount")
+	generateCmd.Flags().String("max-amount", "10", "Maximum transaction amount")
+	generateCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Transaction fee")
+	generateCmd.Flags().Bool("fund-wallets", true, "Mine a block rewarding each wallet before generating")
 
 	transactionCmd.AddCommand(sendCmd)
 	transactionCmd.AddCommand(listCmd)
 	transactionCmd.AddCommand(generateCmd)
+	transactionCmd.AddCommand(showCmd)
+	transactionCmd.AddCommand(decodeCmd)
 
 	rootCmd.AddCommand(transactionCmd)
 }
 
 func sendTransaction(cmd *cobra.Command, args []string) {
 	to, _ := cmd.Flags().GetString("to")
+	uri, _ := cmd.Flags().GetString("uri")
+	message, _ := cmd.Flags().GetString("message")
+
+	amount, err := getAmountFlag(cmd, "amount")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if uri != "" {
+		if to != "" {
+			fmt.Println("Error: use either --to or --uri")
+			return
+		}
+
+		request, err := wallet.ParsePaymentURI(uri)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		if request.IsExpired(time.Now()) {
+			fmt.Printf("Error: payment request expired at %s\n", request.Expires.Format(time.RFC3339))
+			return
+		}
+
+		if request.Amount > 0 {
+			if amount > 0 && amount != request.Amount {
+				fmt.Printf("Error: amount %s differs from the requested %s\n", amount, request.Amount)
+				return
+			}
+			amount = request.Amount
+		}
+
+		if message == "" {
+			message = request.Message
+		}
+		to = request.Address
+	}
+
 	if to == "" {
 		fmt.Println("Error: recipient address is required")
 		return
 	}
 
-	privateKey, _ := cmd.Flags().GetString("private-key")
-	if privateKey == "" {
+	to, err = resolveRecipient(to)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	privateKeys, _ := cmd.Flags().GetStringArray("private-key")
+	if len(privateKeys) == 0 {
 		fmt.Println("Error: private key is required")
 		return
 	}
 
-	amount, _ := cmd.Flags().GetFloat64("amount")
-	fee, _ := cmd.Flags().GetFloat64("fee")
-	message, _ := cmd.Flags().GetString("message")
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	lockUntil, _ := cmd.Flags().GetString("lock-until")
+	coinSelection, _ := cmd.Flags().GetString("coin-selection")
+	outpoints, _ := cmd.Flags().GetStringArray("utxo")
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	// Several keys spend from all their addresses at once, as a keyring
+	if len(privateKeys) > 1 {
+		keyring, err := wallet.LoadKeyring(privateKeys)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		// The change goes to a new key, kept in the wallet database
+		d, err := wallet.LoadDatabase(walletFile)
+		if err != nil {
+			fmt.Printf("Error to load wallet: %s\n", err.Error())
+			return
+		}
+		keyring.StoreKeysIn(d)
 
-	wallet := wallet.LoadWallet(privateKey)
+		keys := len(keyring.Wallets)
+		tx, err := createKeyringTransaction(keyring, to, amount, fee, blockchain, coinSelection, outpoints, message)
+		if err != nil {
+			fmt.Printf("Error to create transaction: %s\n", err.Error())
+			return
+		}
+
+		// Saved before the transaction is submitted, so the change key is
+		// never lost
+		if len(keyring.Wallets) > keys {
+			if err := d.SaveToFile(walletFile); err != nil {
+				fmt.Printf("Error to save wallet: %s\n", err.Error())
+				return
+			}
+			fmt.Printf("Change address: %s\n", keyring.Wallets[len(keyring.Wallets)-1].Address)
+		}
+
+		if lockUntil != "" {
+			if err := lockFirstOutput(tx, lockUntil); err != nil {
+				fmt.Printf("Error: %s\n", err.Error())
+				return
+			}
+		}
+
+		if err := keyring.SignTransaction(tx, blockchain.UTXOSet); err != nil {
+			fmt.Printf("Error to sign transaction: %s\n", err.Error())
+			return
+		}
 
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+		if err := blockchain.AddTransaction(tx); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		if err := blockchain.SaveToFile(blockchainFile); err != nil {
+			fmt.Printf("Error to save Blockchain: %v\n", err)
+		}
+		return
+	}
 
-	tx, err := wallet.CreateTransaction(
-		to,
-		amount,
-		fee,
-		blockchain.UTXOSet,
-		message,
-	)
+	wallet, err := wallet.LoadWallet(privateKeys[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	var tx *transaction.Transaction
+	if coinSelection == "" && len(outpoints) == 0 {
+		tx, err = wallet.CreateTransaction(
+			to,
+			amount,
+			fee,
+			blockchain.UTXOSet,
+			message,
+		)
+	} else {
+		tx, err = createSelectedTransaction(wallet, to, amount, fee, blockchain, coinSelection, outpoints, message)
+	}
 	if err != nil {
 		fmt.Printf("Error to create transaction: %s", err.Error())
 		return
 	}
-	wallet.SignTransaction(tx)
-	blockchain.AddTransaction(tx)
+
+	if lockUntil != "" {
+		if err := lockFirstOutput(tx, lockUntil); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	if err := wallet.SignTransaction(tx); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 
 	err = blockchain.SaveToFile(blockchainFile)
 	if err != nil {
@@ -103,19 +265,227 @@ func sendTransaction(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Coin selector for the --coin-selection and --utxo flags, and the name to
+// show for it
+func getCoinSelector(coinSelection string, outpoints []string) (utxo.CoinSelector, string, error) {
+	if len(outpoints) == 0 {
+		selector, err := utxo.GetCoinSelector(coinSelection)
+		return selector, coinSelection, err
+	}
+
+	if coinSelection != "" {
+		return nil, "", fmt.Errorf("--utxo and --coin-selection can't be used together")
+	}
+
+	manual := &utxo.ManualSelector{}
+	for _, outpoint := range outpoints {
+		txID, index, err := transaction.ParseOutpoint(outpoint)
+		if err != nil {
+			return nil, "", err
+		}
+		manual.Outpoints = append(manual.Outpoints, fmt.Sprintf("%s:%d", txID, index))
+	}
+
+	return manual, "manual", nil
+}
+
+func printSelection(coinSelection string, selection *utxo.Selection) {
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Coin selection: %s", coinSelection),
+		fmt.Sprintf("Inputs:         %d", len(selection.UTXOs)),
+		fmt.Sprintf("Fee:            %s", formatAmount(selection.Fee)),
+		fmt.Sprintf("Change:         %s", formatAmount(selection.Change)),
+	))
+}
+
+func createSelectedTransaction(w *wallet.Wallet, to string, amount common.Amount, fee common.Amount, bc *blockchain.Blockchain, coinSelection string, outpoints []string, message string) (*transaction.Transaction, error) {
+	selector, coinSelection, err := getCoinSelector(coinSelection, outpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, selection, err := w.CreateTransactionWithSelector(to, amount, fee, bc.UTXOSet, selector, message)
+	if err != nil {
+		return nil, err
+	}
+
+	printSelection(coinSelection, selection)
+
+	return tx, nil
+}
+
+// Create a transaction spending from every address of the keyring. Change
+// goes to a new key of the keyring
+func createKeyringTransaction(keyring *wallet.Keyring, to string, amount common.Amount, fee common.Amount, bc *blockchain.Blockchain, coinSelection string, outpoints []string, message string) (*transaction.Transaction, error) {
+	if coinSelection == "" && len(outpoints) == 0 {
+		coinSelection = "largest-first"
+	}
+
+	selector, coinSelection, err := getCoinSelector(coinSelection, outpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []transaction.Payment{{Address: to, Amount: amount}}
+	tx, selection, err := keyring.CreateTransaction(payments, fee, bc.UTXOSet, selector, message)
+	if err != nil {
+		return nil, err
+	}
+
+	printSelection(coinSelection, selection)
+
+	return tx, nil
+}
+
+func lockFirstOutput(tx *transaction.Transaction, lockUntil string) error {
+	lock, err := parseLockUntil(lockUntil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.LockOutput(0, lock); err != nil {
+		return fmt.Errorf("lock transaction output: %w", err)
+	}
+
+	return nil
+}
+
+// Parse a lock given as a block height or as a date
+func parseLockUntil(value string) (int64, error) {
+	if height, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if height <= 0 || height >= common.LOCKTIME_THRESHOLD {
+			return 0, fmt.Errorf("lock height must be between 1 and %d", common.LOCKTIME_THRESHOLD-1)
+		}
+		return height, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Unix(), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid lock %q, expected a block height or a date", value)
+}
+
 func listPendingTransactions(cmd *cobra.Command, args []string) {
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 	fmt.Println(blockchain.Mempool.Print())
 }
 
+func showTransaction(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	info, err := blockchain.GetTransaction(args[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	tx := info.Transaction
+
+	raw, _ := cmd.Flags().GetBool("raw")
+	if raw {
+		fmt.Println(hex.EncodeToString(tx.Serialize()))
+		return
+	}
+
+	fmt.Println(common.BuildBox(
+		fmt.Sprintf("Transaction ID: %s", info.TransactionID),
+		fmt.Sprintf("Block height:   %d", info.BlockHeight),
+		fmt.Sprintf("Block hash:     %s", info.BlockHash),
+		fmt.Sprintf("Position:       %d", info.Position),
+		fmt.Sprintf("Confirmations:  %d", info.Confirmations),
+		fmt.Sprintf("Fee:            %s", tx.Fee),
+		fmt.Sprintf("Message:        %s", tx.Message),
+	))
+
+	fmt.Println("Inputs:")
+	if len(tx.Inputs) == 0 {
+		fmt.Println("  Coinbase")
+	}
+	for _, input := range tx.Inputs {
+		lines := []string{
+			fmt.Sprintf("Previous output: %s:%d", input.TransactionID, input.OutputIndex),
+		}
+
+		prevOutput, err := blockchain.GetPreviousOutput(input)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("Unresolved:      %s", err.Error()))
+		} else {
+			lines = append(lines,
+				fmt.Sprintf("Address:         %s", prevOutput.Address),
+				fmt.Sprintf("Amount:          %s", prevOutput.Amount),
+			)
+		}
+		fmt.Print(common.BuildBox(lines...))
+	}
+
+	fmt.Println("Outputs:")
+	for i, output := range tx.Outputs {
+		if data, err := output.Script.DataCarrierPayload(); err == nil {
+			fmt.Print(common.BuildBox(
+				fmt.Sprintf("Index:   %d", i),
+				fmt.Sprintf("Data:    %s", hex.EncodeToString(data)),
+			))
+			continue
+		}
+
+		fmt.Print(common.BuildBox(
+			fmt.Sprintf("Index:   %d", i),
+			fmt.Sprintf("Address: %s", output.Address),
+			fmt.Sprintf("Amount:  %s", output.Amount),
+		))
+	}
+}
+
+func decodeTransaction(cmd *cobra.Command, args []string) {
+	data, err := hex.DecodeString(strings.TrimSpace(args[0]))
+	if err != nil {
+		fmt.Printf("Error: invalid hex: %s\n", err.Error())
+		return
+	}
+
+	tx, err := transaction.DeserializeTransaction(data)
+	if err != nil {
+		fmt.Printf("Error to decode transaction: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Transaction ID: %s%s", hex.EncodeToString(tx.GetHash()), tx.Print())
+}
+
 func generateTransactions(cmd *cobra.Command, args []string) {
 	count, _ := cmd.Flags().GetInt("count")
 	walletCount, _ := cmd.Flags().GetInt("wallets")
-	minAmount, _ := cmd.Flags().GetFloat64("min-amount")
-	maxAmount, _ := cmd.Flags().GetFloat64("max-amount")
-	fee, _ := cmd.Flags().GetFloat64("fee")
 	fundWallets, _ := cmd.Flags().GetBool("fund-wallets")
 
+	minAmount, err := getAmountFlag(cmd, "min-amount")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	maxAmount, err := getAmountFlag(cmd, "max-amount")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
 	if count <= 0 {
 		fmt.Println("Error: count must be positive")
 		return
@@ -126,7 +496,16 @@ func generateTransactions(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
+	if minAmount > maxAmount {
+		fmt.Println("Error: min amount can't be greater than max amount")
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 
 	// Create wallets for testing
 	fmt.Printf("Creating %d test wallets...\n", walletCount)
@@ -136,19 +515,14 @@ func generateTransactions(cmd *cobra.Command, args []string) {
 		fmt.Printf("Wallet %d: %s\n", i+1, wallets[i].Address)
 	}
 
-	// Fund wallets if requested
+	// Fund wallets if requested, mining a block rewarding each one
 	if fundWallets {
 		fmt.Printf("\nFunding wallets with initial coins...\n")
 		for i, w := range wallets {
-			// Create coinbase-like transaction to fund each wallet
-			fundingTx := transaction.NewCoinbaseTransaction(w.Address, 1000*common.COINS_PER_UNIT) // 1000 coins each
-			blockchain.AddTransaction(fundingTx)
-			fmt.Printf("Funded wallet %d with 1000 coins\n", i+1)
+			blockchain.MineBlock(w.Address)
+			fmt.Printf("Funded wallet %d with %s coins\n", i+1, common.Amount(common.BLOCK_REWARD))
 		}
 
-		// Mine funding transactions first
-		fmt.Println("Mining funding transactions...")
-		blockchain.MineBlock(wallets[0].Address) // Use first wallet as miner
 		err := blockchain.SaveToFile(blockchainFile)
 		if err != nil {
 			fmt.Printf("Error saving blockchain: %v\n", err)
@@ -176,7 +550,7 @@ func generateTransactions(cmd *cobra.Command, args []string) {
 		receiver := wallets[receiverIdx]
 
 		// Random amount between min and max
-		amount := minAmount + rand.Float64()*(maxAmount-minAmount)
+		amount := minAmount + common.Amount(rand.Int63n(int64(maxAmount-minAmount)+1))
 
 		// Create transaction
 		tx, err := sender.CreateTransaction(
@@ -197,7 +571,11 @@ func generateTransactions(cmd *cobra.Command, args []string) {
 		}
 
 		// Sign and add transaction
-		sender.SignTransaction(tx)
+		if err := sender.SignTransaction(tx); err != nil {
+			failCount++
+			fmt.Printf("Transaction %d failed: %s\n", i+1, err.Error())
+			continue
+		}
 		blockchain.AddTransaction(tx)
 		successCount++
 
@@ -208,7 +586,7 @@ func generateTransactions(cmd *cobra.Command, args []string) {
 	}
 
 	// Save blockchain with all pending transactions
-	err := blockchain.SaveToFile(blockchainFile)
+	err = blockchain.SaveToFile(blockchainFile)
 	if err != nil {
 		fmt.Printf("Error saving blockchain: %v\n", err)
 		return
@@ -1,10 +1,20 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
 	"github.com/FilipeJohansson/go-coin/internal/wallet"
 	"github.com/FilipeJohansson/go-coin/pkg/common"
 	"github.com/spf13/cobra"
@@ -40,17 +50,72 @@ var balanceCmd = &cobra.Command{
 	Run:     getWalletBalance,
 }
 
+var historyCmd = &cobra.Command{
+	Use:     "history",
+	Aliases: []string{"h"},
+	Short:   "See the transaction history from a wallet",
+	Run:     getWalletHistory,
+}
+
+var multisigAddressCmd = &cobra.Command{
+	Use:     "multisig-address",
+	Aliases: []string{"ms"},
+	Short:   "Create an M-of-N multisig address",
+	Long:    "Create an address whose funds can only be spent with signatures from M of the N given public keys",
+	Run:     createMultisigAddress,
+}
+
+var consolidateCmd = &cobra.Command{
+	Use:   "consolidate",
+	Short: "Merge small UTXOs into one",
+	Long:  "Sweep the smallest spendable UTXOs of a wallet into a single output back to it, so later payments need fewer inputs",
+	Run:   consolidateWallet,
+}
+
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Move all the funds of a private key",
+	Long:  "Spend every spendable UTXO of a private key, such as an old paper wallet, in one transaction sending all but the fee to another address. The fee is the --fee base plus a fixed fee per input swept, as in coin selection",
+	Run:   sweepWallet,
+}
+
 func init() {
 	createWalletCmd.Flags().StringP("name", "n", "", "Name your wallet")
 	createWalletCmd.Flags().BoolP("save", "s", false, "Save the wallet in a file")
+	createWalletCmd.Flags().String("key-type", common.KEY_TYPE_P256.String(), fmt.Sprintf("Key type (%s)", strings.Join(common.KeyTypes, ", ")))
+	createWalletCmd.Flags().Bool("store", false, "Keep the key in the wallet database")
+	createWalletCmd.Flags().Bool("hd", false, "Create an extended key deriving many addresses, whose public part can be watched")
 
 	loadWalletCmd.Flags().StringP("private-key", "p", "", "Your wallet private key")
 
-	balanceCmd.Flags().StringP("address", "a", "", "Wallet address to check balance")
+	balanceCmd.Flags().StringP("address", "a", "", "Wallet address to check balance (default: the whole wallet database)")
+
+	historyCmd.Flags().StringP("address", "a", "", "Wallet address to list the history (default: the whole wallet database)")
+	historyCmd.Flags().Bool("json", false, "Print the history as JSON")
+	historyCmd.Flags().Bool("csv", false, "Print the history as CSV")
+
+	multisigAddressCmd.Flags().IntP("required", "r", 0, "Number of signatures required to spend")
+	multisigAddressCmd.Flags().StringArrayP("public-key", "k", nil, "Public key of a signer (repeatable, order matters)")
+
+	consolidateCmd.Flags().StringP("private-key", "p", "", "Private key of the wallet to consolidate")
+	consolidateCmd.Flags().String("below", "0", "Only merge UTXOs worth less than this (default: all)")
+	consolidateCmd.Flags().Int("max-inputs", 50, "Maximum number of UTXOs to merge")
+	consolidateCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Base miners fee, each input adds to it")
+	consolidateCmd.Flags().BoolP("yes", "y", false, "Sign and submit without asking for confirmation")
+
+	sweepCmd.Flags().StringP("private-key", "p", "", "Private key to sweep")
+	sweepCmd.Flags().StringP("to", "t", "", "Recipient address or contact name")
+	sweepCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), fmt.Sprintf("Base miners fee, each input adds %s to it", common.Amount(common.INPUT_FEE)))
+	sweepCmd.Flags().StringP("message", "m", "", "Optional message")
+	sweepCmd.Flags().BoolP("yes", "y", false, "Sign and submit without asking for confirmation")
 
 	walletCmd.AddCommand(createWalletCmd)
 	walletCmd.AddCommand(loadWalletCmd)
 	walletCmd.AddCommand(balanceCmd)
+	walletCmd.AddCommand(historyCmd)
+	walletCmd.AddCommand(multisigAddressCmd)
+	walletCmd.AddCommand(consolidateCmd)
+	walletCmd.AddCommand(sweepCmd)
 
 	rootCmd.AddCommand(walletCmd)
 }
@@ -63,11 +128,63 @@ func createWallet(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	wallet := wallet.NewWallet()
+	store, _ := cmd.Flags().GetBool("store")
+	hd, _ := cmd.Flags().GetBool("hd")
+	if store && hd {
+		fmt.Println("Error: extended keys can't be stored, watch their public key instead")
+		return
+	}
+
+	keyTypeName, _ := cmd.Flags().GetString("key-type")
+	keyType, err := common.ParseKeyType(keyTypeName)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	var content string
+	if hd {
+		seed := make([]byte, 32)
+		if _, err := rand.Read(seed); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		masterKey, err := wallet.NewMasterKey(seed, keyType)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		first, err := masterKey.Derive(wallet.FormatDerivationPath(wallet.RECEIVE_CHAIN, 0))
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		content = fmt.Sprintf("Wallet Name: %s\n%s", name, common.BuildBox(
+			fmt.Sprintf("Key type: %s", keyType),
+			fmt.Sprintf("Extended public key: %s", masterKey.Neuter()),
+			fmt.Sprintf("Extended private key: %s", masterKey),
+			fmt.Sprintf("First address: %s", first.Address()),
+		))
+	} else {
+		w := wallet.NewWallet(keyType)
+		content = fmt.Sprintf("Wallet Name: %s\n%s", name, w.Print())
 
-	content := fmt.Sprintf("Wallet Name: %s\n%s", name, wallet.Print())
+		if store {
+			if err := storeKey(w); err != nil {
+				fmt.Printf("Error to store key: %s\n", err.Error())
+				return
+			}
+		}
+	}
 	fmt.Println(content)
 
+	if store {
+		fmt.Printf("Key stored in %s\n", walletFile)
+	}
+
 	if save {
 		file, err := os.OpenFile("wallet.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
@@ -91,7 +208,11 @@ func loadWallet(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	wallet := wallet.LoadWallet(privateKey)
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 
 	fmt.Printf("Wallet loaded:\n%s", wallet.Print())
 }
@@ -99,11 +220,375 @@ func loadWallet(cmd *cobra.Command, args []string) {
 func getWalletBalance(cmd *cobra.Command, args []string) {
 	address, _ := cmd.Flags().GetString("address")
 
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
 	if address == "" {
-		fmt.Println("Error: address is required")
+		printDatabaseBalance(blockchain)
+		return
+	}
+
+	spendable, locked, err := blockchain.UTXOSet.GetAddressBalances(address)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	total, err := spendable.Add(locked)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Wallet balance: %s\n", total)
+	fmt.Printf("Spendable: %s\n", spendable)
+	fmt.Printf("Locked: %s\n", locked)
+
+	for _, u := range blockchain.UTXOSet.GetUTXOsByAddress(address) {
+		if lockUntil := u.LockedUntil(); lockUntil > 0 && !blockchain.UTXOSet.IsSpendable(u) {
+			fmt.Printf("  %s locked until %s\n", u.Amount, formatLock(lockUntil))
+		}
+	}
+}
+
+func formatLock(lockUntil int64) string {
+	if lockUntil < common.LOCKTIME_THRESHOLD {
+		return fmt.Sprintf("block %d", lockUntil)
+	}
+
+	return time.Unix(lockUntil, 0).Format(time.RFC3339)
+}
+
+func getWalletHistory(cmd *cobra.Command, args []string) {
+	address, _ := cmd.Flags().GetString("address")
+	asJson, _ := cmd.Flags().GetBool("json")
+	asCsv, _ := cmd.Flags().GetBool("csv")
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if address == "" {
+		d, err := loadWalletDatabase(blockchain)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		printHistory(d.GetHistory(), asJson, asCsv)
+		return
+	}
+
+	history, err := blockchain.GetAddressHistory(address)
+	if err != nil {
+		fmt.Printf("Error to load history: %s\n", err.Error())
+		return
+	}
+
+	printHistory(history, asJson, asCsv)
+}
+
+func printHistory(history []blockchain.HistoryEntry, asJson bool, asCsv bool) {
+	// Labels and contact names come from the wallet database, if there is one
+	book, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		book = wallet.NewDatabase()
+	}
+
+	for i := range history {
+		history[i].Label = book.Labels[history[i].TransactionID]
+	}
+
+	switch {
+	case asJson:
+		content, err := json.MarshalIndent(history, "", "\t")
+		if err != nil {
+			fmt.Printf("Error to format history: %s\n", err.Error())
+			return
+		}
+		fmt.Println(string(content))
+	case asCsv:
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"transactionID", "blockHeight", "type", "counterparty", "amount", "fee", "message", "balance", "label"})
+		for _, e := range history {
+			writer.Write([]string{
+				e.TransactionID,
+				strconv.Itoa(e.BlockHeight),
+				e.Type,
+				e.Counterparty,
+				formatSignedAmount(e.Amount),
+				formatAmount(e.Fee),
+				e.Message,
+				formatSignedAmount(e.Balance),
+				e.Label,
+			})
+		}
+		writer.Flush()
+	default:
+		for _, e := range history {
+			lines := []string{
+				fmt.Sprintf("Transaction ID: %s", e.TransactionID),
+				fmt.Sprintf("Block height:   %d", e.BlockHeight),
+				fmt.Sprintf("Type:           %s", e.Type),
+				fmt.Sprintf("Counterparty:   %s", nameAddresses(book, e.Counterparty)),
+				fmt.Sprintf("Amount:         %s", formatSignedAmount(e.Amount)),
+				fmt.Sprintf("Fee:            %s", formatAmount(e.Fee)),
+				fmt.Sprintf("Message:        %s", e.Message),
+				fmt.Sprintf("Balance:        %s", formatSignedAmount(e.Balance)),
+			}
+			if e.Label != "" {
+				lines = append(lines, fmt.Sprintf("Label:          %s", e.Label))
+			}
+
+			fmt.Print(common.BuildBox(lines...))
+		}
+	}
+}
+
+// Put the contact name or label next to each of the comma separated
+// addresses
+func nameAddresses(book *wallet.Database, addresses string) string {
+	named := strings.Split(addresses, ",")
+	for i, address := range named {
+		if name := book.AddressName(address); name != "" {
+			named[i] = fmt.Sprintf("%s (%s)", name, address)
+		}
+	}
+
+	return strings.Join(named, ",")
+}
+
+func createMultisigAddress(cmd *cobra.Command, args []string) {
+	required, _ := cmd.Flags().GetInt("required")
+	encodedKeys, _ := cmd.Flags().GetStringArray("public-key")
+
+	keys := make([]*common.PublicKey, 0, len(encodedKeys))
+	for _, encoded := range encodedKeys {
+		key, err := common.GetPublicKeyFromHash(encoded)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	redeemScript, err := script.NewMultisig(required, keys)
+	if err != nil {
+		fmt.Printf("Error to create multisig: %s\n", err.Error())
+		return
+	}
+
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("Multisig: %d of %d", required, len(keys)),
+		fmt.Sprintf("Address: %s", redeemScript.Address()),
+	))
+	fmt.Printf("Redeem script:\n%s\n", hex.EncodeToString(redeemScript))
+	fmt.Println("Keep the redeem script, it is needed to spend from this address")
+}
+
+func formatAmount(amount common.Amount) string {
+	return amount.String()
+}
+
+func formatSignedAmount(amount int64) string {
+	if amount < 0 {
+		return "-" + common.Amount(-amount).String()
+	}
+	return common.Amount(amount).String()
+}
+
+// Read a flag holding a decimal amount of coins
+func getAmountFlag(cmd *cobra.Command, name string) (common.Amount, error) {
+	value, _ := cmd.Flags().GetString(name)
+
+	amount, err := common.ParseAmount(value)
+	if err != nil {
+		return 0, fmt.Errorf("--%s: %w", name, err)
+	}
+
+	return amount, nil
+}
+
+func consolidateWallet(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	maxInputs, _ := cmd.Flags().GetInt("max-inputs")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	limit, err := getAmountFlag(cmd, "below")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if maxInputs < 2 {
+		fmt.Println("Error: max inputs must be at least 2")
+		return
+	}
+
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	utxos := blockchain.UTXOSet.GetSpendableUTXOsForAddress(wallet.Address)
+	sort.SliceStable(utxos, func(i, j int) bool {
+		return utxos[i].Amount < utxos[j].Amount
+	})
+
+	selected := make([]*utxo.UTXO, 0)
+	for _, u := range utxos {
+		if len(selected) == maxInputs || (limit > 0 && u.Amount >= limit) {
+			break
+		}
+		selected = append(selected, u)
+	}
+
+	if len(selected) < 2 {
+		fmt.Printf("Nothing to consolidate: %d matching UTXOs\n", len(selected))
+		return
+	}
+
+	tx, err := wallet.CreateConsolidationTransaction(selected, fee)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	fmt.Print(common.BuildBox(
+		fmt.Sprintf("UTXOs merged: %d of %d", len(selected), len(utxos)),
+		fmt.Sprintf("Total:        %s", formatAmount(tx.Outputs[0].Amount+tx.Fee)),
+		fmt.Sprintf("Fee:          %s", formatAmount(tx.Fee)),
+		fmt.Sprintf("New UTXO:     %s", formatAmount(tx.Outputs[0].Amount)),
+	))
+
+	if !yes && !confirm("Sign and submit this transaction?") {
+		fmt.Println("Aborted")
+		return
+	}
+
+	if err := wallet.SignTransaction(tx); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
 		return
 	}
 
-	blockchain := blockchain.NewBlockchain("", blockchainFile)
-	fmt.Printf("Wallet balance: %.7f", (float64(blockchain.UTXOSet.GetAddressBalance(address)) / common.COINS_PER_UNIT))
+	err = blockchain.SaveToFile(blockchainFile)
+	if err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+	}
+}
+
+func sweepWallet(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	if privateKey == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	to, _ := cmd.Flags().GetString("to")
+	if to == "" {
+		fmt.Println("Error: recipient address is required")
+		return
+	}
+
+	to, err := resolveRecipient(to)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	message, _ := cmd.Flags().GetString("message")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	wallet, err := wallet.LoadWallet(privateKey)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	utxos := blockchain.UTXOSet.GetSpendableUTXOsForAddress(wallet.Address)
+	if len(utxos) == 0 {
+		fmt.Printf("Nothing to sweep: %s has no spendable UTXOs\n", wallet.Address)
+		return
+	}
+
+	tx, err := wallet.CreateSweepTransaction(to, utxos, fee, message)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	_, locked, err := blockchain.UTXOSet.GetAddressBalances(wallet.Address)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	lines := []string{
+		fmt.Sprintf("From:   %s", wallet.Address),
+		fmt.Sprintf("To:     %s", to),
+		fmt.Sprintf("UTXOs:  %d", len(utxos)),
+		fmt.Sprintf("Total:  %s", formatAmount(tx.Outputs[0].Amount+tx.Fee)),
+		fmt.Sprintf("Fee:    %s", formatAmount(tx.Fee)),
+		fmt.Sprintf("Amount: %s", formatAmount(tx.Outputs[0].Amount)),
+	}
+	if locked > 0 {
+		lines = append(lines, fmt.Sprintf("Locked: %s left behind until unlocked", formatAmount(locked)))
+	}
+	fmt.Print(common.BuildBox(lines...))
+
+	if !yes && !confirm("Sign and submit this transaction?") {
+		fmt.Println("Aborted")
+		return
+	}
+
+	if err := wallet.SignTransaction(tx); err != nil {
+		fmt.Printf("Error to sign transaction: %s\n", err.Error())
+		return
+	}
+	if err := blockchain.AddTransaction(tx); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	err = blockchain.SaveToFile(blockchainFile)
+	if err != nil {
+		fmt.Printf("Error to save Blockchain: %v\n", err)
+	}
 }
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List the keys stored in the wallet database",
+	Run:   listWalletKeys,
+}
+
+var rescanCmd = &cobra.Command{
+	Use:   "rescan",
+	Short: "Scan the blockchain again for the wallet transactions",
+	Long:  "Forget what the wallet database learned from the given height on and scan the blocks again, to find the past transactions of imported keys",
+	Run:   rescanWallet,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Add a private key to the wallet database",
+	Long:  "Keep an existing private key in the wallet database and scan the blockchain for its past transactions",
+	Run:   importWalletKey,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print a private key in a standard format",
+	Long:  "Export a private key, given or stored in the wallet database, as checksummed WIF, PKCS #8 PEM or JWK for other tools",
+	Run:   exportWalletKey,
+}
+
+func init() {
+	importCmd.Flags().StringP("private-key", "p", "", "Private key to import")
+	importCmd.Flags().String("key-file", "", "Read the private key from a file, - for the standard input")
+	importCmd.Flags().String("format", "", fmt.Sprintf("Format of the private key (%s) (default: wif or base58)", strings.Join(common.KeyFormats, ", ")))
+	importCmd.Flags().String("key-type", "", "Key type of a secp256k1 PEM key (secp256k1 or schnorr), or of a JWK key to import it as schnorr")
+	importCmd.Flags().StringP("label", "l", "", "Label for the key address")
+	importCmd.Flags().Int("from-height", 0, "Height of the first block to scan for the key transactions")
+
+	exportCmd.Flags().StringP("private-key", "p", "", "Private key to export")
+	exportCmd.Flags().StringP("address", "a", "", "Address of a key stored in the wallet database")
+	exportCmd.Flags().String("format", "wif", fmt.Sprintf("Format of the private key (%s)", strings.Join(common.KeyFormats, ", ")))
+	exportCmd.Flags().StringP("output", "o", "", "Write the key to a file instead of printing it")
+	exportCmd.Flags().Bool("force", false, "Export a schnorr key as PEM, which loses its key type")
+
+	rescanCmd.Flags().Int("from-height", 0, "Height of the first block to scan")
+
+	walletCmd.AddCommand(keysCmd)
+	walletCmd.AddCommand(rescanCmd)
+	walletCmd.AddCommand(importCmd)
+	walletCmd.AddCommand(exportCmd)
+}
+
+// Load the wallet database and apply the blocks connected, or disconnected,
+// since it was last used
+func loadWalletDatabase(bc *blockchain.Blockchain) (*wallet.Database, error) {
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Keys) == 0 {
+		return nil, errors.New("the wallet database has no keys, create one with wallet create --store")
+	}
+
+	connected, disconnected, err := d.Sync(bc)
+	if err != nil {
+		return nil, err
+	}
+
+	if disconnected > 0 {
+		fmt.Printf("%d blocks are no longer in the blockchain, wallet rolled back to block %d\n", disconnected, d.LastBlockHeight-connected)
+	}
+
+	if connected > 0 || disconnected > 0 {
+		if err := d.SaveToFile(walletFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+func listWalletKeys(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	d, err := loadWalletDatabase(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	for _, address := range d.Addresses() {
+		spendable, locked, err := d.GetBalances(blockchain.UTXOSet, address)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		lines := []string{
+			fmt.Sprintf("Address:   %s", address),
+			fmt.Sprintf("Spendable: %s", spendable),
+			fmt.Sprintf("Locked:    %s", locked),
+		}
+		if label := d.Labels[address]; label != "" {
+			lines = append(lines, fmt.Sprintf("Label:     %s", label))
+		}
+
+		fmt.Print(common.BuildBox(lines...))
+	}
+
+	fmt.Printf("Scanned up to block %d (%s)\n", d.LastBlockHeight, d.LastBlockHash)
+}
+
+func rescanWallet(cmd *cobra.Command, args []string) {
+	fromHeight, _ := cmd.Flags().GetInt("from-height")
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	scanned, err := d.Rescan(blockchain, fromHeight)
+	if err != nil {
+		fmt.Printf("Error to rescan: %s\n", err.Error())
+		return
+	}
+
+	if err := d.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Scanned %d blocks, %d wallet transactions found\n", scanned, len(d.Transactions))
+}
+
+func importWalletKey(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	keyFile, _ := cmd.Flags().GetString("key-file")
+	if privateKey == "" && keyFile == "" {
+		fmt.Println("Error: private key is required")
+		return
+	}
+
+	label, _ := cmd.Flags().GetString("label")
+	fromHeight, _ := cmd.Flags().GetInt("from-height")
+	format, _ := cmd.Flags().GetString("format")
+	keyTypeName, _ := cmd.Flags().GetString("key-type")
+
+	if keyFile != "" {
+		data, err := readKeyFile(keyFile)
+		if err != nil {
+			fmt.Printf("Error to read key file: %s\n", err.Error())
+			return
+		}
+		privateKey = string(data)
+	}
+
+	w, err := decodeWalletKey(privateKey, format, keyTypeName)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		fmt.Printf("Error to load wallet: %s\n", err.Error())
+		return
+	}
+
+	if err := d.AddKey(w); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	d.SetLabel(w.Address, label)
+
+	// The key may have been used before, unlike a new one
+	scanned, err := d.Rescan(blockchain, fromHeight)
+	if err != nil {
+		fmt.Printf("Error to rescan: %s\n", err.Error())
+		return
+	}
+
+	if err := d.SaveToFile(walletFile); err != nil {
+		fmt.Printf("Error to save wallet: %s\n", err.Error())
+		return
+	}
+
+	spendable, locked, err := d.GetBalances(blockchain.UTXOSet, w.Address)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Imported %s, scanned %d blocks\n", w.Address, scanned)
+	fmt.Printf("Spendable: %s\n", spendable)
+	fmt.Printf("Locked: %s\n", locked)
+}
+
+func exportWalletKey(cmd *cobra.Command, args []string) {
+	privateKey, _ := cmd.Flags().GetString("private-key")
+	address, _ := cmd.Flags().GetString("address")
+	format, _ := cmd.Flags().GetString("format")
+	output, _ := cmd.Flags().GetString("output")
+	force, _ := cmd.Flags().GetBool("force")
+
+	if (privateKey == "") == (address == "") {
+		fmt.Println("Error: either a private key or a stored address is required")
+		return
+	}
+
+	var w *wallet.Wallet
+	var err error
+	if privateKey != "" {
+		w, err = wallet.LoadWallet(privateKey)
+	} else {
+		var d *wallet.Database
+		if d, err = wallet.LoadDatabase(walletFile); err == nil {
+			w, err = d.GetWallet(address)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	encoded, err := common.EncodePrivateKey(w.PrivateKey, format, force)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	if !strings.HasSuffix(encoded, "\n") {
+		encoded += "\n"
+	}
+
+	if output == "" {
+		fmt.Print(encoded)
+		return
+	}
+
+	if err := os.WriteFile(output, []byte(encoded), 0600); err != nil {
+		fmt.Printf("Error to write key: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Private key of %s written to %s\n", w.Address, output)
+}
+
+// Wallet of a private key in the given format. With no format, WIF and the
+// Base58 form printed by the wallet are both accepted
+func decodeWalletKey(encoded string, format string, keyTypeName string) (*wallet.Wallet, error) {
+	encoded = strings.TrimSpace(encoded)
+	if format == "" {
+		return wallet.LoadWallet(encoded)
+	}
+
+	keyTypes := make([]common.KeyType, 0)
+	if keyTypeName != "" {
+		keyType, err := common.ParseKeyType(keyTypeName)
+		if err != nil {
+			return nil, err
+		}
+		keyTypes = append(keyTypes, keyType)
+	}
+
+	privateKey, err := common.DecodePrivateKey(encoded, format, keyTypes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet.NewWalletFromKey(privateKey), nil
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(path)
+}
+
+// Balance of every key in the wallet database
+func printDatabaseBalance(bc *blockchain.Blockchain) {
+	d, err := loadWalletDatabase(bc)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	spendable, locked, err := d.GetBalances(bc.UTXOSet)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	total, err := spendable.Add(locked)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Wallet balance: %s\n", total)
+	fmt.Printf("Spendable: %s\n", spendable)
+	fmt.Printf("Locked: %s\n", locked)
+}
+
+// Add a new key to the wallet database. A new key has no past transactions,
+// so the wallet stays in sync without a rescan
+func storeKey(w *wallet.Wallet) error {
+	d, err := wallet.LoadDatabase(walletFile)
+	if err != nil {
+		return err
+	}
+
+	if err := d.AddKey(w); err != nil {
+		return err
+	}
+
+	return d.SaveToFile(walletFile)
+}
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/psbt"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var watchOnlyFile string
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch-only wallet operations",
+	Long:  "Follow addresses and extended public keys without their private keys: track balances and history and build unsigned transactions for an offline signer",
+}
+
+var watchImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Watch addresses or an extended public key",
+	Run:   importWatchOnly,
+}
+
+var watchAddressesCmd = &cobra.Command{
+	Use:   "addresses",
+	Short: "List the watched addresses",
+	Run:   listWatchOnlyAddresses,
+}
+
+var watchBalanceCmd = &cobra.Command{
+	Use:   "balance",
+	Short: "See the balance of every watched address",
+	Run:   getWatchOnlyBalance,
+}
+
+var watchHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "See the transaction history of the watched addresses",
+	Run:   getWatchOnlyHistory,
+}
+
+var watchSendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Build an unsigned transaction from the watched addresses",
+	Long:  "Build a PSBT spending from the watched addresses, to be signed with psbt sign on the machine holding the keys",
+	Run:   sendWatchOnly,
+}
+
+func init() {
+	watchCmd.PersistentFlags().StringVar(&watchOnlyFile, "watch-file", "watchonly.json", "Path to the watch-only wallet file")
+
+	watchImportCmd.Flags().StringArrayP("address", "a", nil, "Address to watch (repeatable)")
+	watchImportCmd.Flags().String("xpub", "", "Extended public key to watch")
+	watchImportCmd.Flags().Int("gap-limit", wallet.DEFAULT_GAP_LIMIT, "Unused addresses to derive past the last used one")
+
+	watchHistoryCmd.Flags().Bool("json", false, "Print the history as JSON")
+	watchHistoryCmd.Flags().Bool("csv", false, "Print the history as CSV")
+
+	watchSendCmd.Flags().StringP("to", "t", "", "Recipient address or contact name")
+	watchSendCmd.Flags().StringP("amount", "a", "0", "Quantity to send")
+	watchSendCmd.Flags().String("fee", common.Amount(common.MIN_FEE).String(), "Base miners fee, each input adds to it")
+	watchSendCmd.Flags().StringP("message", "m", "", "Optional message")
+	watchSendCmd.Flags().String("coin-selection", "largest-first", fmt.Sprintf("Coin selection strategy (%s)", strings.Join(utxo.CoinSelectors, ", ")))
+
+	watchCmd.AddCommand(watchImportCmd)
+	watchCmd.AddCommand(watchAddressesCmd)
+	watchCmd.AddCommand(watchBalanceCmd)
+	watchCmd.AddCommand(watchHistoryCmd)
+	watchCmd.AddCommand(watchSendCmd)
+
+	walletCmd.AddCommand(watchCmd)
+}
+
+// Load the watch-only wallet and derive the addresses of its extended keys
+// up to the gap limit
+func loadWatchOnly(bc *blockchain.Blockchain) (*wallet.WatchOnlyWallet, error) {
+	w, err := wallet.LoadWatchOnlyWallet(watchOnlyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := w.Scan(func(address string) bool {
+		return len(bc.AddressIndex[address]) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if found > 0 {
+		if err := w.SaveToFile(watchOnlyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func importWatchOnly(cmd *cobra.Command, args []string) {
+	addresses, _ := cmd.Flags().GetStringArray("address")
+	xpub, _ := cmd.Flags().GetString("xpub")
+	gapLimit, _ := cmd.Flags().GetInt("gap-limit")
+
+	if len(addresses) == 0 && xpub == "" {
+		fmt.Println("Error: an address or an extended public key is required")
+		return
+	}
+
+	w, err := wallet.LoadWatchOnlyWallet(watchOnlyFile)
+	if err != nil {
+		fmt.Printf("Error to load watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	for _, address := range addresses {
+		if err := w.ImportAddress(address); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	if xpub != "" {
+		if err := w.ImportExtendedKey(xpub, gapLimit); err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+	}
+
+	if err := w.SaveToFile(watchOnlyFile); err != nil {
+		fmt.Printf("Error to save watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if w, err = loadWatchOnly(blockchain); err != nil {
+		fmt.Printf("Error to scan addresses: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Watching %d addresses\n", len(w.AllAddresses()))
+}
+
+func listWatchOnlyAddresses(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	w, err := loadWatchOnly(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	for _, address := range w.AllAddresses() {
+		path := w.DerivationPath(address)
+		if path == "" {
+			path = "imported"
+		}
+
+		used := ""
+		if len(blockchain.AddressIndex[address]) > 0 {
+			used = " (used)"
+		}
+
+		fmt.Printf("%-10s %s%s\n", path, address, used)
+	}
+}
+
+func getWatchOnlyBalance(cmd *cobra.Command, args []string) {
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	w, err := loadWatchOnly(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	var totalSpendable, totalLocked common.Amount
+	for _, address := range w.AllAddresses() {
+		spendable, locked, err := blockchain.UTXOSet.GetAddressBalances(address)
+		if err == nil {
+			totalSpendable, err = totalSpendable.Add(spendable)
+		}
+		if err == nil {
+			totalLocked, err = totalLocked.Add(locked)
+		}
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+
+		if spendable > 0 || locked > 0 {
+			fmt.Printf("  %s: %s spendable, %s locked\n", address, spendable, locked)
+		}
+	}
+
+	total, err := totalSpendable.Add(totalLocked)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Wallet balance: %s\n", total)
+	fmt.Printf("Spendable: %s\n", totalSpendable)
+	fmt.Printf("Locked: %s\n", totalLocked)
+}
+
+func getWatchOnlyHistory(cmd *cobra.Command, args []string) {
+	asJson, _ := cmd.Flags().GetBool("json")
+	asCsv, _ := cmd.Flags().GetBool("csv")
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	w, err := loadWatchOnly(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	history, err := blockchain.GetWalletHistory(w.AllAddresses())
+	if err != nil {
+		fmt.Printf("Error to load history: %s\n", err.Error())
+		return
+	}
+
+	printHistory(history, asJson, asCsv)
+}
+
+func sendWatchOnly(cmd *cobra.Command, args []string) {
+	to, _ := cmd.Flags().GetString("to")
+	if to == "" {
+		fmt.Println("Error: recipient address is required")
+		return
+	}
+
+	to, err := resolveRecipient(to)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	amount, err := getAmountFlag(cmd, "amount")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	fee, err := getAmountFlag(cmd, "fee")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	message, _ := cmd.Flags().GetString("message")
+	coinSelection, _ := cmd.Flags().GetString("coin-selection")
+
+	selector, err := utxo.GetCoinSelector(coinSelection)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+
+	blockchain, err := blockchain.NewBlockchain("", blockchainFile)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	w, err := loadWatchOnly(blockchain)
+	if err != nil {
+		fmt.Printf("Error to load watch-only wallet: %s\n", err.Error())
+		return
+	}
+
+	payments := []transaction.Payment{{Address: to, Amount: amount}}
+	tx, selection, err := w.CreateTransaction(payments, fee, blockchain.UTXOSet, selector, message)
+	if err != nil {
+		fmt.Printf("Error to create transaction: %s\n", err.Error())
+		return
+	}
+
+	p, err := psbt.NewPSBT(tx, blockchain.UTXOSet)
+	if err != nil {
+		fmt.Printf("Error to create PSBT: %s\n", err.Error())
+		return
+	}
+
+	for i := range p.Inputs {
+		p.Inputs[i].Derivation = w.DerivationPath(p.Inputs[i].UTXO.Address)
+	}
+
+	fmt.Fprintf(os.Stderr, "Spending %d UTXOs, fee %s, change %s\n", len(selection.UTXOs), selection.Fee, selection.Change)
+	printPSBT(p)
+}
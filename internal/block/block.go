@@ -11,7 +11,14 @@ import (
 	"github.com/FilipeJohansson/go-coin/internal/transaction"
 )
 
+// Block versions signalling deployments have the top bits set to 001, leaving
+// the lower 29 bits for readiness flags. Version 0 marks blocks mined before
+// versioning
+const VERSION_TOP_BITS = 0x20000000
+const VERSION_TOP_MASK = 0xe0000000
+
 type Block struct {
+	Version       uint32                     `json:"version,omitempty"`
 	Timestamp     time.Time                  `json:"timestamp"`
 	Transactions  []*transaction.Transaction `json:"transactions"`
 	Message       string                     `json:"message"`
@@ -28,12 +35,18 @@ func NewBlock(prevBlockHash string, msg ...string) *Block {
 	}
 
 	return &Block{
+		Version:       VERSION_TOP_BITS,
 		Timestamp:     time.Now(),
 		PrevBlockHash: prevBlockHash,
 		Message:       message,
 	}
 }
 
+// Whether the block version signals readiness for the deployment bit
+func (b *Block) SignalsBit(bit uint8) bool {
+	return b.Version&VERSION_TOP_MASK == VERSION_TOP_BITS && b.Version&(1<<bit) != 0
+}
+
 func (b *Block) AddTransaction(transaction *transaction.Transaction) {
 	b.Transactions = append(b.Transactions, transaction)
 }
@@ -56,18 +69,35 @@ func (b *Block) SaveBlockHash() {
 }
 
 func (b *Block) GetHash() string {
+	if b.Version == 0 {
+		return b.legacyHash()
+	}
+
+	hasher := sha256.New()
+	hasher.Write(b.serializeHeader())
+	hashBytes := hasher.Sum(nil)
+
+	// Convert the hash to hexadecimal string
+	return hex.EncodeToString(hashBytes)
+}
+
+// Version 0 blocks keep the hash they were mined with, over their timestamp,
+// the JSON of their transactions, the previous hash and the nonce
+func (b *Block) legacyHash() string {
+	var transactions string
+	for _, t := range b.Transactions {
+		transactions += t.LegacyJson()
+	}
+
 	data := fmt.Sprintf("%v%s%s%d",
 		b.Timestamp.Unix(),
-		b.FormatTransactions(),
+		transactions,
 		b.PrevBlockHash,
 		b.Nonce)
 
 	hasher := sha256.New()
 	hasher.Write([]byte(data))
-	hashBytes := hasher.Sum(nil)
-
-	// Convert the hash to hexadecimal string
-	return hex.EncodeToString(hashBytes)
+	return hex.EncodeToString(hasher.Sum(nil))
 }
 
 func (b *Block) IsHashRight() bool {
@@ -110,11 +140,12 @@ func (b *Block) Print() string {
 
 	return fmt.Sprintf(`
 Hash: %s
+Version: 0x%08x
 Prev Block hash: %s
 Timestamp: %s
 Message: %s
 Difficulty: %d
 Nonce: %d
 Transactions:
-%s`, b.BlockHash, b.PrevBlockHash, b.Timestamp, b.Message, b.Difficulty, b.Nonce, txsStr)
+%s`, b.BlockHash, b.Version, b.PrevBlockHash, b.Timestamp, b.Message, b.Difficulty, b.Nonce, txsStr)
 }
@@ -0,0 +1,143 @@
+package block
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/encoding"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+)
+
+// Serialization version 2 adds the block version. Legacy blocks (version 0)
+// keep the version 1 encoding, and their hash doesn't come from it, see
+// legacyHash
+const SERIALIZATION_VERSION = 2
+const LEGACY_SERIALIZATION_VERSION = 1
+
+// Serialize returns the canonical binary encoding of the block. The block
+// hash is not part of it, since it is derived from the rest of the fields
+func (b *Block) Serialize() []byte {
+	w := encoding.NewWriter()
+	b.encodeHeader(w)
+
+	w.WriteVarUint(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		w.WriteBytes(tx.Serialize())
+	}
+
+	return w.Bytes()
+}
+
+// serializeHeader commits to the transactions through a digest of their full
+// encoding, so that the header is all that has to be hashed while mining
+func (b *Block) serializeHeader() []byte {
+	w := encoding.NewWriter()
+	b.encodeHeader(w)
+	w.WriteBytes(b.transactionsDigest())
+	return w.Bytes()
+}
+
+func (b *Block) encodeHeader(w *encoding.Writer) {
+	if b.Version == 0 {
+		w.WriteUint8(LEGACY_SERIALIZATION_VERSION)
+	} else {
+		w.WriteUint8(SERIALIZATION_VERSION)
+		w.WriteVarUint(uint64(b.Version))
+	}
+	w.WriteInt64(b.Timestamp.UnixNano())
+	w.WriteString(b.PrevBlockHash)
+	w.WriteString(b.Message)
+	w.WriteVarUint(uint64(b.Difficulty))
+	w.WriteInt64(int64(b.Nonce))
+}
+
+func (b *Block) transactionsDigest() []byte {
+	hasher := sha256.New()
+	for _, tx := range b.Transactions {
+		hasher.Write(tx.Serialize())
+	}
+	return hasher.Sum(nil)
+}
+
+func DeserializeBlock(data []byte) (*Block, error) {
+	r := encoding.NewReader(data)
+
+	version, err := r.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Block{}
+
+	switch version {
+	case LEGACY_SERIALIZATION_VERSION:
+	case SERIALIZATION_VERSION:
+		blockVersion, err := r.ReadVarUint()
+		if err != nil {
+			return nil, err
+		}
+
+		if blockVersion == 0 || blockVersion > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid block version %d", blockVersion)
+		}
+		b.Version = uint32(blockVersion)
+	default:
+		return nil, fmt.Errorf("unsupported serialization version %d", version)
+	}
+
+	timestamp, err := r.ReadInt64()
+	if err != nil {
+		return nil, err
+	}
+	b.Timestamp = time.Unix(0, timestamp)
+
+	if b.PrevBlockHash, err = r.ReadString(); err != nil {
+		return nil, err
+	}
+
+	if b.Message, err = r.ReadString(); err != nil {
+		return nil, err
+	}
+
+	difficulty, err := r.ReadVarUint()
+	if err != nil {
+		return nil, err
+	}
+	b.Difficulty = int(difficulty)
+
+	nonce, err := r.ReadInt64()
+	if err != nil {
+		return nil, err
+	}
+	b.Nonce = int(nonce)
+
+	txCount, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	b.Transactions = make([]*transaction.Transaction, 0, txCount)
+	for i := 0; i < txCount; i++ {
+		data, err := r.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := transaction.DeserializeTransaction(data)
+		if err != nil {
+			return nil, err
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+
+	if r.Remaining() != 0 {
+		return nil, errors.New("unexpected trailing bytes")
+	}
+
+	b.SaveBlockHash()
+
+	return b, nil
+}
@@ -0,0 +1,98 @@
+package block
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+)
+
+func testCoinbase() *transaction.Transaction {
+	return &transaction.Transaction{
+		Inputs:  []transaction.TransactionInput{},
+		Outputs: []transaction.TransactionOutput{{Address: "miner", Amount: 50000000}},
+		Message: "Coinbase reward for block 3",
+	}
+}
+
+func testBlock(version uint32) *Block {
+	return &Block{
+		Version:       version,
+		Timestamp:     time.Unix(1700000000, 5),
+		Transactions:  []*transaction.Transaction{testCoinbase()},
+		Message:       "block",
+		PrevBlockHash: "00ab",
+		Nonce:         7,
+		Difficulty:    2,
+	}
+}
+
+func TestBlockSerializeVectors(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *Block
+		hex   string
+		hash  string
+	}{
+		{
+			name:  "legacy",
+			block: testBlock(0),
+			hex:   "0117979cfe362a0005043030616205626c6f636b0200000000000000070135010001056d696e65720000000002faf08000000000000000001b436f696e626173652072657761726420666f7220626c6f636b2033",
+			hash:  "d0c603a0a36f39b09ec6d5f455088db41396006b12d93df253b723e4200458ba",
+		},
+		{
+			name:  "versioned",
+			block: testBlock(VERSION_TOP_BITS),
+			hex:   "02808080800217979cfe362a0005043030616205626c6f636b0200000000000000070135010001056d696e65720000000002faf08000000000000000001b436f696e626173652072657761726420666f7220626c6f636b2033",
+			hash:  "9e4f7b6417cc550178ad0e427fa63d1286a5b22db9aa698252a439bce4b40ae0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := hex.EncodeToString(test.block.Serialize())
+			if encoded != test.hex {
+				t.Errorf("Serialize() = %s, want %s", encoded, test.hex)
+			}
+
+			if hash := test.block.GetHash(); hash != test.hash {
+				t.Errorf("GetHash() = %s, want %s", hash, test.hash)
+			}
+		})
+	}
+}
+
+func TestBlockSerializeRoundTrip(t *testing.T) {
+	for _, b := range []*Block{testBlock(0), testBlock(VERSION_TOP_BITS)} {
+		encoded := b.Serialize()
+
+		decoded, err := DeserializeBlock(encoded)
+		if err != nil {
+			t.Fatalf("DeserializeBlock() error: %s", err)
+		}
+
+		if !bytes.Equal(decoded.Serialize(), encoded) {
+			t.Errorf("round trip changed the encoding of version %d block", b.Version)
+		}
+
+		if decoded.GetHash() != b.GetHash() {
+			t.Errorf("round trip changed the hash of version %d block", b.Version)
+		}
+	}
+}
+
+func TestDeserializeBlockRejects(t *testing.T) {
+	valid := testBlock(VERSION_TOP_BITS).Serialize()
+
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"truncated":      valid[:len(valid)-1],
+		"trailing bytes": append(append([]byte{}, valid...), 0),
+	} {
+		if _, err := DeserializeBlock(data); err == nil {
+			t.Errorf("%s: DeserializeBlock() succeeded, want an error", name)
+		}
+	}
+}
@@ -1,159 +1,200 @@
 package blockchain
 
 import (
-	"crypto/elliptic"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/FilipeJohansson/go-coin/internal/block"
 	"github.com/FilipeJohansson/go-coin/internal/mempool"
+	"github.com/FilipeJohansson/go-coin/internal/script"
 	"github.com/FilipeJohansson/go-coin/internal/transaction"
 	"github.com/FilipeJohansson/go-coin/internal/utxo"
-	"github.com/FilipeJohansson/go-coin/internal/wallet"
 	"github.com/FilipeJohansson/go-coin/pkg/common"
 )
 
 type Blockchain struct {
-	Blocks  []*block.Block   `json:"blocks"`
-	UTXOSet *utxo.UTXOSet    `json:"-"`
-	Mempool *mempool.Mempool `json:"mempool"`
+	Blocks       []*block.Block        `json:"blocks"`
+	UTXOSet      *utxo.UTXOSet         `json:"-"`
+	Mempool      *mempool.Mempool      `json:"mempool"`
+	TxIndex      map[string]TxLocation `json:"-"`
+	AddressIndex map[string][]string   `json:"-"`
 }
 
-func NewBlockchain(genesisWalletAddress string, filename ...string) *Blockchain {
+// Load the blockchain from the file, or start a new one rewarding the genesis
+// address when there is no file yet. A file that fails to load is never
+// replaced
+func NewBlockchain(genesisWalletAddress string, filename ...string) (*Blockchain, error) {
 	if len(filename) > 0 && filename[0] != "" {
 		blockchain, err := LoadFromFile(filename[0])
-		if err != nil {
-			// err
-		} else {
-			return blockchain
+		if err == nil {
+			return blockchain, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load %s: %w", filename[0], err)
 		}
 	}
 
 	blockchain := &Blockchain{
-		UTXOSet: utxo.NewUTXOSet(),
-		Mempool: mempool.NewMempool(),
+		UTXOSet:      utxo.NewUTXOSet(),
+		Mempool:      mempool.NewMempool(),
+		TxIndex:      make(map[string]TxLocation),
+		AddressIndex: make(map[string][]string),
 	}
 
 	blockchain.MineBlock(genesisWalletAddress)
 
-	return blockchain
+	return blockchain, nil
 }
 
-func (bc *Blockchain) AddTransaction(tx *transaction.Transaction) {
-	if tx == nil {
-		return
+func (bc *Blockchain) AddTransaction(tx *transaction.Transaction) error {
+	if err := tx.CheckTransaction(); err != nil {
+		fmt.Printf("[INVALID] %s\n", err.Error())
+		return err
 	}
 
-	var from string
 	to := tx.Outputs[0].Address
-	amount := float64(tx.Outputs[0].Amount) / common.COINS_PER_UNIT
-	if len(tx.Inputs) == 0 {
-		from = "Coinbase"
-	} else {
-		from = common.GetAddressFromPublicKey(*tx.Inputs[0].PublicKey.GetPublicKey())
+	amount := tx.Outputs[0].Amount
+
+	// Their signature hash doesn't commit to the outputs, anyone could
+	// redirect them
+	if tx.Version == 0 {
+		fmt.Print("[INVALID] Version 0 transactions are only valid in legacy blocks\n")
+		return errors.New("version 0 transactions are only valid in legacy blocks")
 	}
 
-	fmt.Printf("%s -> %s:\n", from, to)
-	fmt.Printf("Amount: %.7f\n", amount)
-	fmt.Printf("Message: %s\n", tx.Message)
+	if tx.Version > transaction.MAX_STANDARD_VERSION {
+		fmt.Printf("[INVALID] Non-standard transaction version %d\n", tx.Version)
+		return fmt.Errorf("non-standard transaction version %d", tx.Version)
+	}
 
+	// Coinbases are only created by the miner of a block, relayed they would
+	// mint coins
 	if len(tx.Inputs) == 0 {
-		// Coinbase
-		bc.Mempool.AddTransaction(tx)
-		return
+		fmt.Print("[INVALID] Transaction has no inputs\n")
+		return errors.New("transaction has no inputs")
 	}
 
-	if tx.Fee < common.MIN_FEE {
-		// err
-		return
+	utxos := make([]*utxo.UTXO, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		utxos[i] = bc.UTXOSet.GetUTXO(input.TransactionID, input.OutputIndex)
+		if utxos[i] == nil {
+			fmt.Print("[INVALID] Input UTXO does not exist\n")
+			return errors.New("input UTXO does not exist")
+		}
 	}
+	from := inputAddresses(utxos)
 
-	var totalOutputs uint64
-	for _, o := range tx.Outputs {
-		totalOutputs += o.Amount
+	fmt.Printf("%s -> %s:\n", from, to)
+	fmt.Printf("Amount: %s\n", amount)
+	fmt.Printf("Message: %s\n", tx.Message)
+
+	if tx.Fee < tx.MinimumFee() {
+		return errors.New("fee less than min")
 	}
 
-	if amount <= 0 {
-		fmt.Printf("[INVALID] Invalid amount: %.7f\n", amount)
-		return
+	if !tx.IsFinal(len(bc.Blocks), time.Now()) {
+		fmt.Printf("[INVALID] Transaction is locked until %d\n", tx.LockTime)
+		return fmt.Errorf("transaction is locked until %d", tx.LockTime)
 	}
 
-	if from == to {
-		fmt.Printf("[INVALID] Cannot send to yourself\n")
-		return
+	totalOutputs, err := tx.TotalOutputs()
+	if err != nil {
+		fmt.Printf("[INVALID] Invalid outputs: %s\n", err.Error())
+		return err
 	}
 
-	if !wallet.ValidateTransactionSignature(*tx) {
-		// err
-		fmt.Print("[INVALID] Transaction signature invalid\n")
-		return
+	for i, output := range tx.Outputs {
+		if output.IsDust() {
+			fmt.Printf("[INVALID] Output %d is dust: %s\n", i, output.Amount)
+			return fmt.Errorf("output %d is below the dust threshold", i)
+		}
 	}
 
-	var totalInputs uint64
-	for _, input := range tx.Inputs {
-		if !bc.UTXOSet.UTXOExists(input.TransactionID, input.OutputIndex) {
-			fmt.Print("[INVALID] Input UTXO does not exist\n")
-			return
+	// Each input proves ownership of the UTXO it spends on its own, so a
+	// transaction can spend from several addresses
+	var totalInputs common.Amount
+	for i, utxo := range utxos {
+		if err := bc.verifyInputScript(tx, i, utxo, len(bc.Blocks)); err != nil {
+			fmt.Printf("[INVALID] Input %d script failed: %s\n", i, err.Error())
+			return fmt.Errorf("input %d script failed: %w", i, err)
 		}
 
-		utxo := bc.UTXOSet.GetUTXO(input.TransactionID, input.OutputIndex)
-		if utxo.Address != from {
-			fmt.Print("[INVAID] Input UTXO does not belong to sender\n")
-			return
+		if totalInputs, err = totalInputs.Add(utxo.Amount); err != nil {
+			fmt.Printf("[INVALID] Invalid inputs: %s\n", err.Error())
+			return err
 		}
-		totalInputs += utxo.Amount
 	}
 
-	if totalInputs < totalOutputs+tx.Fee {
+	spent, err := totalOutputs.Add(tx.Fee)
+	if err != nil || totalInputs < spent {
 		fmt.Print("[INVALID] Insuficient funds\n")
-		return
+		return errors.New("insuficient funds")
 	}
 
-	fmt.Printf("[VALID] %s -> %s: %.7f\n", from, to, amount)
+	fmt.Printf("[VALID] %s -> %s: %s\n", from, to, amount)
 
 	bc.Mempool.AddTransaction(tx)
+
+	return nil
 }
 
 func (bc *Blockchain) MineBlock(minerAddress string) {
-	if bc.Mempool.Size() == 0 && len(bc.Blocks) > 0 {
-		return
-	}
-
 	var prevHash string
 	if len(bc.Blocks) > 0 {
 		prevHash = bc.Blocks[len(bc.Blocks)-1].BlockHash
 	}
 
 	newBlock := block.NewBlock(prevHash)
+	newBlock.Version = bc.ComputeBlockVersion(len(bc.Blocks))
 
 	usedUTXOs := make(map[string]bool)
 
-	var totalFees uint64
+	var totalFees common.Amount
 	transactions := bc.Mempool.GetTransactions()
 	sort.Slice(transactions, func(i, j int) bool {
 		return transactions[i].Fee > transactions[j].Fee
 	})
 
-	// Select transactions for the block
+	// Select transactions for the block. Coinbases, version 0 transactions
+	// left from a legacy mempool and spends of outputs an earlier block spent
+	// can never be mined, they are dropped
 	selectedTransactions := 0
+	dropped := make([]*transaction.Transaction, 0)
 	for _, tx := range transactions {
 		if len(newBlock.Transactions) == common.MAX_TXS_PER_BLOCK {
 			break
 		}
 
+		if len(tx.Inputs) == 0 || tx.Version == 0 || bc.spendsMissingUTXOs(tx) {
+			dropped = append(dropped, tx)
+			continue
+		}
+
 		if bc.hasConflictingInputs(tx, usedUTXOs) {
 			continue
 		}
 
+		if !tx.IsFinal(len(bc.Blocks), newBlock.Timestamp) {
+			continue
+		}
+
+		fees, err := totalFees.Add(tx.Fee)
+		if err != nil {
+			continue
+		}
+
 		bc.markUTXOsAsUsed(tx, usedUTXOs)
 		newBlock.AddTransaction(tx)
-		totalFees += tx.Fee
+		totalFees = fees
 		selectedTransactions++
 	}
 
@@ -176,17 +217,20 @@ func (bc *Blockchain) MineBlock(minerAddress string) {
 		fmt.Printf(" ✓ Block mined in %v\n", miningTime)
 		fmt.Printf("Block hash: %s\n", newBlock.BlockHash)
 		fmt.Printf("Nonce: %d\n", newBlock.Nonce)
-		fmt.Printf("Total fees collected: %.7f coins\n", float64(totalFees)/common.COINS_PER_UNIT)
+		fmt.Printf("Total fees collected: %s coins\n", totalFees)
 	}
 
 	bc.Blocks = append(bc.Blocks, newBlock)
+	bc.indexBlockTransactions(len(bc.Blocks)-1, newBlock)
+	bc.indexBlockAddresses(len(bc.Blocks)-1, newBlock)
 
 	for _, tx := range newBlock.Transactions {
-		bc.updateUTXOSet(tx)
+		bc.updateUTXOSet(tx, len(bc.Blocks)-1)
 	}
 
 	// Clean processed transactions from mempool
 	bc.Mempool.CleanProcessedTransactions(newBlock.Transactions)
+	bc.Mempool.CleanProcessedTransactions(dropped)
 }
 
 func (bc *Blockchain) IsBlockchainValid() bool {
@@ -205,19 +249,79 @@ func (bc *Blockchain) IsBlockchainValid() bool {
 			return false
 		}
 
-		for _, tx := range b.Transactions {
-			if !bc.validateTransactionInContext(tx, tempUTXOSet) {
+		// Blocks mined before versioning can only precede versioned ones,
+		// they follow the rules of their time
+		legacy := b.Version == 0
+		if legacy && i > 0 && bc.Blocks[i-1].Version != 0 {
+			return false
+		}
+
+		// Exactly one coinbase, first in the block. Legacy blocks also funded
+		// wallets with extra coinbases
+		if len(b.Transactions) == 0 || len(b.Transactions[0].Inputs) != 0 {
+			return false
+		}
+
+		// Schnorr signatures of the block are checked together once all its
+		// transactions are
+		batch := common.NewSchnorrBatch()
+
+		var fees common.Amount
+		for j, tx := range b.Transactions {
+			if j > 0 && len(tx.Inputs) == 0 && !legacy {
+				return false
+			}
+
+			// The signature hash of version 0 transactions doesn't commit to
+			// their outputs, only legacy blocks can hold them
+			if tx.Version == 0 && !legacy {
+				return false
+			}
+
+			if !bc.validateTransactionInContext(tx, tempUTXOSet, i, b.Timestamp, batch) {
 				return false
 			}
 
-			bc.applyTransactionToUTXOSet(tx, tempUTXOSet)
+			if j > 0 {
+				var err error
+				if fees, err = fees.Add(tx.Fee); err != nil {
+					return false
+				}
+			}
+
+			bc.applyTransactionToUTXOSet(tx, tempUTXOSet, i)
+		}
+
+		if !batch.Verify() {
+			return false
+		}
+
+		if legacy {
+			continue
+		}
+
+		// The coinbase can claim the block reward and the fees, nothing more
+		reward, err := fees.Add(common.BLOCK_REWARD)
+		if err != nil {
+			return false
+		}
+
+		minted, err := b.Transactions[0].TotalOutputs()
+		if err != nil || minted > reward {
+			return false
 		}
 	}
 
 	return true
 }
 
+// The chain is stored in its binary encoding. Files named .json keep the JSON
+// format they were first saved in
 func (bc *Blockchain) SaveToFile(filename string) error {
+	if filepath.Ext(filename) != ".json" {
+		return os.WriteFile(filename, bc.Serialize(), 0644)
+	}
+
 	json, err := json.MarshalIndent(bc, "", "\t")
 	if err != nil {
 		return err
@@ -244,96 +348,140 @@ func (bc *Blockchain) Print() string {
 	return content
 }
 
-func (bc *Blockchain) createCoinbaseTransaction(address string, totalFees uint64) *transaction.Transaction {
-	return transaction.NewCoinbaseTransaction(address, (50*common.COINS_PER_UNIT)+totalFees)
+func (bc *Blockchain) createCoinbaseTransaction(address string, totalFees common.Amount) *transaction.Transaction {
+	return transaction.NewCoinbaseTransaction(address, common.BLOCK_REWARD+totalFees, len(bc.Blocks))
 }
 
 func (bc *Blockchain) rebuildUTXOSet() {
 	bc.UTXOSet = utxo.NewUTXOSet()
-	for _, block := range bc.Blocks {
+	for height, block := range bc.Blocks {
 		for _, tx := range block.Transactions {
-			bc.updateUTXOSet(tx)
+			bc.updateUTXOSet(tx, height)
 		}
 	}
 }
 
-func (bc *Blockchain) updateUTXOSet(tx *transaction.Transaction) {
-	for _, i := range tx.Inputs {
-		bc.UTXOSet.RemoveUTXOByID(i.TransactionID, i.OutputIndex)
-	}
+func (bc *Blockchain) updateUTXOSet(tx *transaction.Transaction, height int) {
+	bc.applyTransactionToUTXOSet(tx, bc.UTXOSet, height)
+}
 
-	txID := hex.EncodeToString(tx.GetHash())
-	for i, o := range tx.Outputs {
-		newUTXO := &utxo.UTXO{
-			TransactionID: txID,
-			OutputIndex:   uint(i),
-			Address:       o.Address,
-			Amount:        o.Amount,
-		}
-		bc.UTXOSet.AddUTXO(newUTXO)
+func (bc *Blockchain) validateTransactionInContext(tx *transaction.Transaction, tempUTXOSet *utxo.UTXOSet, height int, blockTime time.Time, batch *common.SchnorrBatch) bool {
+	if tx.CheckTransaction() != nil {
+		return false
 	}
-}
 
-func (bc *Blockchain) validateTransactionInContext(tx *transaction.Transaction, tempUTXOSet *utxo.UTXOSet) bool {
 	if len(tx.Inputs) == 0 {
-		if len(tx.Outputs) != 1 {
-			return false
-		}
-
 		return true
 	}
 
-	if tx.Fee < common.MIN_FEE {
+	if tx.Fee < tx.MinimumFee() {
 		return false
 	}
 
-	if !wallet.ValidateTransactionSignature(*tx) {
+	if !tx.IsFinal(height, blockTime) {
 		return false
 	}
 
-	var totalInputs uint64
-	for _, input := range tx.Inputs {
+	var totalInputs common.Amount
+	for i, input := range tx.Inputs {
 		if !tempUTXOSet.UTXOExists(input.TransactionID, input.OutputIndex) {
 			return false
 		}
 
 		utxo := tempUTXOSet.GetUTXO(input.TransactionID, input.OutputIndex)
 
-		from := common.GetAddressFromPublicKey(*input.PublicKey.GetPublicKey())
-		if utxo.Address != from {
+		if bc.verifyInputScript(tx, i, utxo, height, batch) != nil {
 			return false
 		}
 
-		totalInputs += utxo.Amount
+		var err error
+		if totalInputs, err = totalInputs.Add(utxo.Amount); err != nil {
+			return false
+		}
 	}
 
-	var totalOutputs uint64
-	for _, output := range tx.Outputs {
-		totalOutputs += output.Amount
+	totalOutputs, err := tx.TotalOutputs()
+	if err != nil {
+		return false
 	}
 
-	if totalInputs < totalOutputs+tx.Fee {
+	spent, err := totalOutputs.Add(tx.Fee)
+	if err != nil || totalInputs < spent {
 		return false
 	}
 
 	return true
 }
 
-func (bc *Blockchain) applyTransactionToUTXOSet(tx *transaction.Transaction, tempUTXOSet *utxo.UTXOSet) {
+// Check the input relative lock and run its unlocking script against the
+// locking script of the output it spends, as if the transaction was confirmed
+// at the given height. Schnorr signatures go to the batch, if one is given,
+// for the caller to verify
+func (bc *Blockchain) verifyInputScript(tx *transaction.Transaction, index int, spent *utxo.UTXO, height int, batch ...*common.SchnorrBatch) error {
+	input := tx.Inputs[index]
+	if age := height - spent.Height; age < int(input.Sequence) {
+		return fmt.Errorf("input is locked for %d more blocks", int(input.Sequence)-age)
+	}
+
+	lockingScript, err := spent.GetLockingScript()
+	if err != nil {
+		return err
+	}
+
+	unlockingScript, err := input.GetUnlockingScript()
+	if err != nil {
+		return err
+	}
+
+	context := &script.Context{
+		SignatureHash: tx.GetSignatureHash(index),
+		LockTime:      int64(tx.LockTime),
+		Sequence:      int64(input.Sequence),
+	}
+	if len(batch) > 0 {
+		context.Batch = batch[0]
+	}
+
+	return script.Verify(unlockingScript, lockingScript, context)
+}
+
+func (bc *Blockchain) applyTransactionToUTXOSet(tx *transaction.Transaction, tempUTXOSet *utxo.UTXOSet, height int) {
 	for _, input := range tx.Inputs {
 		tempUTXOSet.RemoveUTXOByID(input.TransactionID, input.OutputIndex)
 	}
 
 	txID := hex.EncodeToString(tx.GetHash())
 	for i, output := range tx.Outputs {
+		// Data carriers can never be spent
+		if output.IsDataCarrier() {
+			continue
+		}
+
 		newUTXO := &utxo.UTXO{
 			TransactionID: txID,
 			OutputIndex:   uint(i),
 			Address:       output.Address,
 			Amount:        output.Amount,
+			Script:        output.Script,
+			Height:        height,
 		}
 		tempUTXOSet.AddUTXO(newUTXO)
 	}
+	tempUTXOSet.Height = height
+}
+
+// Distinct addresses of the spent UTXOs, for display
+func inputAddresses(utxos []*utxo.UTXO) string {
+	addresses := make([]string, 0, len(utxos))
+	seen := make(map[string]bool)
+	for _, u := range utxos {
+		if !seen[u.Address] {
+			seen[u.Address] = true
+			addresses = append(addresses, u.Address)
+		}
+	}
+
+	return strings.Join(addresses, ", ")
 }
 
 func (bc *Blockchain) hasConflictingInputs(tx *transaction.Transaction, usedUTXOs map[string]bool) bool {
@@ -346,6 +494,15 @@ func (bc *Blockchain) hasConflictingInputs(tx *transaction.Transaction, usedUTXO
 	return false
 }
 
+func (bc *Blockchain) spendsMissingUTXOs(tx *transaction.Transaction) bool {
+	for _, input := range tx.Inputs {
+		if !bc.UTXOSet.UTXOExists(input.TransactionID, input.OutputIndex) {
+			return true
+		}
+	}
+	return false
+}
+
 func (bc *Blockchain) markUTXOsAsUsed(tx *transaction.Transaction, usedUTXOs map[string]bool) {
 	for _, input := range tx.Inputs {
 		key := input.TransactionID + ":" + strconv.Itoa(int(input.OutputIndex))
@@ -384,34 +541,30 @@ func (bc *Blockchain) calculateDifficulty() int {
 	}
 }
 
-func (bc *Blockchain) fixPublicKeyCurves() {
-	for _, block := range bc.Blocks {
-		for _, tx := range block.Transactions {
-			for i := range tx.Inputs {
-				tx.Inputs[i].PublicKey.Curve = elliptic.P256()
-			}
-		}
-	}
-}
-
 func LoadFromFile(filename string) (*Blockchain, error) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	var blockchain Blockchain
-	err = json.Unmarshal(content, &blockchain)
+	// Whatever its name, a file is read in the format it was saved in
+	blockchain := &Blockchain{}
+	if IsSerializedBlockchain(content) {
+		blockchain, err = DeserializeBlockchain(content)
+	} else {
+		err = json.Unmarshal(content, blockchain)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	blockchain.rebuildUTXOSet()
-	blockchain.fixPublicKeyCurves()
+	blockchain.rebuildTxIndex()
+	blockchain.rebuildAddressIndex()
 
 	if !blockchain.IsBlockchainValid() {
-		return nil, errors.New("Blockchain saved is invalid")
+		return nil, errors.New("the saved blockchain is invalid")
 	}
 
-	return &blockchain, nil
+	return blockchain, nil
 }
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/internal/block"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Saved before the binary encoding and versioning existed: the genesis block
+// rewards LEGACY_MINER, which pays LEGACY_RECIPIENT in block 1 and again from
+// the mempool
+const LEGACY_CHAIN = "testdata/legacy.json"
+const LEGACY_MINER = "2VF3cYQnjFj7g5psvYfAm5XQsszcGXPVkGLAvcurAjrm"
+const LEGACY_RECIPIENT = "CfCVKa2dEBuuzQpchouaNCzYiRV5MdsAAcHu2k7jChhk"
+
+func TestLoadLegacyBlockchain(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+
+	for i, b := range bc.Blocks {
+		if b.Version != 0 {
+			t.Errorf("block %d has version %d, want 0", i, b.Version)
+		}
+
+		if hash := b.GetHash(); hash != b.BlockHash {
+			t.Errorf("block %d hash = %s, want the stored %s", i, hash, b.BlockHash)
+		}
+	}
+
+	balances := map[string]common.Amount{
+		LEGACY_MINER:     90 * common.COINS_PER_UNIT,
+		LEGACY_RECIPIENT: 10 * common.COINS_PER_UNIT,
+	}
+	for address, want := range balances {
+		if balance, _ := bc.UTXOSet.GetAddressBalance(address); balance != want {
+			t.Errorf("balance of %s = %s, want %s", address, balance, want)
+		}
+	}
+}
+
+func TestMineOnLegacyBlockchain(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+
+	pending := bc.Mempool.GetTransactions()
+	if len(pending) != 1 || pending[0].Version != 0 {
+		t.Fatalf("want the legacy payment pending, got %d transactions", len(pending))
+	}
+
+	if err := bc.AddTransaction(pending[0]); err == nil {
+		t.Error("AddTransaction() accepted a version 0 transaction")
+	}
+
+	bc.MineBlock(LEGACY_MINER)
+
+	mined := bc.Blocks[len(bc.Blocks)-1]
+	if mined.Version == 0 || len(mined.Transactions) != 1 {
+		t.Errorf("mined a version %d block with %d transactions, want a versioned block with only its coinbase", mined.Version, len(mined.Transactions))
+	}
+
+	if bc.Mempool.Size() != 0 {
+		t.Error("the legacy payment is still pending")
+	}
+
+	if !bc.IsBlockchainValid() {
+		t.Fatal("the chain is invalid after mining on it")
+	}
+
+	// Legacy blocks can't follow a versioned one
+	legacy := block.NewBlock(mined.BlockHash)
+	legacy.Version = 0
+	legacy.AddTransaction(bc.Blocks[0].Transactions[0])
+	legacy.Mine(mined.Difficulty)
+	bc.Blocks = append(bc.Blocks, legacy)
+	if bc.IsBlockchainValid() {
+		t.Error("accepted a legacy block after a versioned one")
+	}
+}
+
+func TestLegacyBlockHashCommitsToTransactions(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+
+	bc.Blocks[1].Transactions[1].Outputs[0].Amount++
+	if bc.Blocks[1].IsHashRight() {
+		t.Error("changing a payment kept the legacy block hash")
+	}
+}
+
+func TestBlockSchnorrSignaturesAreBatched(t *testing.T) {
+	d := sha256.Sum256([]byte("schnorr miner"))
+	key, err := common.NewPrivateKey(common.KEY_TYPE_SCHNORR, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := key.GetPublicKey()
+	address := common.GetAddressFromPublicKey(*publicKey)
+
+	bc, err := NewBlockchain(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := transaction.NewTransaction(address, LEGACY_RECIPIENT, 10*common.COINS_PER_UNIT, common.MIN_FEE, bc.UTXOSet, *publicKey)
+	if err != nil {
+		t.Fatalf("NewTransaction() error: %s", err)
+	}
+
+	for i := range tx.Inputs {
+		signature, err := key.SignHash(tx.GetSignatureHash(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Inputs[i].Signature = hex.EncodeToString(signature)
+	}
+
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction() error: %s", err)
+	}
+
+	bc.MineBlock(address)
+	if !bc.IsBlockchainValid() {
+		t.Fatal("the chain is invalid with a Schnorr spend")
+	}
+
+	// A well formed signature of another hash only fails with the batch
+	mined := bc.Blocks[len(bc.Blocks)-1]
+	other := sha256.Sum256([]byte("other transaction"))
+	signature, err := key.SignHash(other[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	mined.Transactions[1].Inputs[0].Signature = hex.EncodeToString(signature)
+	mined.Mine(mined.Difficulty)
+
+	if bc.IsBlockchainValid() {
+		t.Error("accepted a block with an invalid Schnorr signature")
+	}
+}
@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/block"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+type DeploymentState int
+
+const (
+	DEPLOYMENT_DEFINED DeploymentState = iota
+	DEPLOYMENT_STARTED
+	DEPLOYMENT_LOCKED_IN
+	DEPLOYMENT_ACTIVE
+	DEPLOYMENT_FAILED
+)
+
+func (s DeploymentState) String() string {
+	switch s {
+	case DEPLOYMENT_DEFINED:
+		return "defined"
+	case DEPLOYMENT_STARTED:
+		return "started"
+	case DEPLOYMENT_LOCKED_IN:
+		return "locked_in"
+	case DEPLOYMENT_ACTIVE:
+		return "active"
+	case DEPLOYMENT_FAILED:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Soft fork deployment, signalled by miners through a bit of the block
+// version. States only change at window boundaries: once a window after
+// StartHeight has enough signalling blocks the deployment locks in, and one
+// window later it is active. Reaching TimeoutHeight first makes it fail
+type Deployment struct {
+	Name          string
+	Bit           uint8
+	StartHeight   int
+	TimeoutHeight int
+}
+
+var Deployments = []Deployment{
+	// Carries no rules, exercises the signalling machinery
+	{Name: "testdummy", Bit: 28, StartHeight: 0, TimeoutHeight: 1000000},
+}
+
+type DeploymentStatus struct {
+	Deployment Deployment
+	State      DeploymentState
+	// First height of the window the state applies to
+	Since int
+	// Signalling blocks so far in the current window, while started
+	Signalling int
+}
+
+func GetDeployment(name string) (*Deployment, error) {
+	for i := range Deployments {
+		if Deployments[i].Name == name {
+			return &Deployments[i], nil
+		}
+	}
+
+	return nil, errors.New("unknown deployment")
+}
+
+// State of the deployment for the block at the given height
+func (bc *Blockchain) GetDeploymentState(d Deployment, height int) DeploymentState {
+	state, _ := bc.deploymentState(d, height)
+	return state
+}
+
+func (bc *Blockchain) IsDeploymentActive(name string, height int) bool {
+	d, err := GetDeployment(name)
+	if err != nil {
+		return false
+	}
+
+	return bc.GetDeploymentState(*d, height) == DEPLOYMENT_ACTIVE
+}
+
+// Walk the windows up to the one holding the height, returning its state and
+// first height
+func (bc *Blockchain) deploymentState(d Deployment, height int) (DeploymentState, int) {
+	state := DEPLOYMENT_DEFINED
+	windowStart := 0
+
+	for start := common.DEPLOYMENT_WINDOW; start <= height; start += common.DEPLOYMENT_WINDOW {
+		next := state
+
+		switch state {
+		case DEPLOYMENT_DEFINED:
+			if start >= d.TimeoutHeight {
+				next = DEPLOYMENT_FAILED
+			} else if start >= d.StartHeight {
+				next = DEPLOYMENT_STARTED
+			}
+		case DEPLOYMENT_STARTED:
+			if start >= d.TimeoutHeight {
+				next = DEPLOYMENT_FAILED
+			} else if bc.countSignalling(d, start-common.DEPLOYMENT_WINDOW, start) >= common.DEPLOYMENT_THRESHOLD {
+				next = DEPLOYMENT_LOCKED_IN
+			}
+		case DEPLOYMENT_LOCKED_IN:
+			next = DEPLOYMENT_ACTIVE
+		}
+
+		if next != state {
+			state = next
+			windowStart = start
+		}
+	}
+
+	return state, windowStart
+}
+
+func (bc *Blockchain) countSignalling(d Deployment, from int, to int) int {
+	count := 0
+	for height := from; height < to && height < len(bc.Blocks); height++ {
+		if bc.Blocks[height].SignalsBit(d.Bit) {
+			count++
+		}
+	}
+	return count
+}
+
+// Version for a block mined at the given height, signalling every deployment
+// that is started or locked in
+func (bc *Blockchain) ComputeBlockVersion(height int) uint32 {
+	version := uint32(block.VERSION_TOP_BITS)
+	for _, d := range Deployments {
+		state := bc.GetDeploymentState(d, height)
+		if state == DEPLOYMENT_STARTED || state == DEPLOYMENT_LOCKED_IN {
+			version |= 1 << d.Bit
+		}
+	}
+	return version
+}
+
+// Status of every known deployment for the next block
+func (bc *Blockchain) GetDeploymentStatuses() []DeploymentStatus {
+	height := len(bc.Blocks)
+	windowStart := height - height%common.DEPLOYMENT_WINDOW
+
+	statuses := make([]DeploymentStatus, 0, len(Deployments))
+	for _, d := range Deployments {
+		state, since := bc.deploymentState(d, height)
+
+		status := DeploymentStatus{
+			Deployment: d,
+			State:      state,
+			Since:      since,
+		}
+		if state == DEPLOYMENT_STARTED {
+			status.Signalling = bc.countSignalling(d, windowStart, height)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func (s DeploymentStatus) Print() string {
+	lines := []string{
+		fmt.Sprintf("Name:    %s", s.Deployment.Name),
+		fmt.Sprintf("Bit:     %d", s.Deployment.Bit),
+		fmt.Sprintf("Start:   %d", s.Deployment.StartHeight),
+		fmt.Sprintf("Timeout: %d", s.Deployment.TimeoutHeight),
+		fmt.Sprintf("State:   %s (since block %d)", s.State, s.Since),
+	}
+
+	if s.State == DEPLOYMENT_STARTED {
+		lines = append(lines, fmt.Sprintf("Signals: %d this window, %d of %d needed",
+			s.Signalling, common.DEPLOYMENT_THRESHOLD, common.DEPLOYMENT_WINDOW))
+	}
+
+	return common.BuildBox(lines...)
+}
@@ -0,0 +1,185 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/block"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+type HistoryEntry struct {
+	TransactionID string        `json:"transactionID"`
+	BlockHeight   int           `json:"blockHeight"`
+	Type          string        `json:"type"` // credit or debit
+	Counterparty  string        `json:"counterparty"`
+	Amount        int64         `json:"amount"`
+	Fee           common.Amount `json:"fee"`
+	Message       string        `json:"message"`
+	Balance       int64         `json:"balance"`
+	Label         string        `json:"label,omitempty"`
+}
+
+func (bc *Blockchain) rebuildAddressIndex() {
+	bc.AddressIndex = make(map[string][]string)
+	for height, b := range bc.Blocks {
+		bc.indexBlockAddresses(height, b)
+	}
+}
+
+// Must run after the block transactions are indexed, so a transaction ID
+// already used by an earlier block isn't added twice
+func (bc *Blockchain) indexBlockAddresses(height int, b *block.Block) {
+	if bc.AddressIndex == nil {
+		bc.AddressIndex = make(map[string][]string)
+	}
+
+	for position, tx := range b.Transactions {
+		txID := hex.EncodeToString(tx.GetHash())
+		if bc.TxIndex[txID] != (TxLocation{BlockHeight: height, Position: position}) {
+			continue
+		}
+
+		for _, address := range bc.transactionAddresses(tx) {
+			bc.AddressIndex[address] = append(bc.AddressIndex[address], txID)
+		}
+	}
+}
+
+// Returns every address touched by the transaction, either by receiving an
+// output or by spending a previous one
+func (bc *Blockchain) transactionAddresses(tx *transaction.Transaction) []string {
+	seen := make(map[string]bool)
+	addresses := make([]string, 0)
+
+	add := func(address string) {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, input := range tx.Inputs {
+		prevOutput, err := bc.GetPreviousOutput(input)
+		if err != nil {
+			continue
+		}
+		add(prevOutput.Address)
+	}
+
+	for _, output := range tx.Outputs {
+		add(output.Address)
+	}
+
+	return addresses
+}
+
+func (bc *Blockchain) GetAddressHistory(address string) ([]HistoryEntry, error) {
+	return bc.GetWalletHistory([]string{address})
+}
+
+// History of a set of addresses seen as a single wallet: payments between
+// them only cost the fee, and the counterparties are the outside addresses
+func (bc *Blockchain) GetWalletHistory(addresses []string) ([]HistoryEntry, error) {
+	own := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		own[address] = true
+	}
+
+	txIDs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		for _, txID := range bc.AddressIndex[address] {
+			if !seen[txID] {
+				seen[txID] = true
+				txIDs = append(txIDs, txID)
+			}
+		}
+	}
+
+	sort.SliceStable(txIDs, func(i, j int) bool {
+		a, b := bc.TxIndex[txIDs[i]], bc.TxIndex[txIDs[j]]
+		if a.BlockHeight != b.BlockHeight {
+			return a.BlockHeight < b.BlockHeight
+		}
+		return a.Position < b.Position
+	})
+
+	entries := make([]HistoryEntry, 0)
+
+	var balance int64
+	for _, txID := range txIDs {
+		info, err := bc.GetTransaction(txID)
+		if err != nil {
+			return nil, err
+		}
+		tx := info.Transaction
+
+		var spent, received common.Amount
+		senders := make([]string, 0)
+		for _, input := range tx.Inputs {
+			prevOutput, err := bc.GetPreviousOutput(input)
+			if err != nil {
+				return nil, err
+			}
+
+			if own[prevOutput.Address] {
+				if spent, err = spent.Add(prevOutput.Amount); err != nil {
+					return nil, err
+				}
+			} else {
+				senders = appendUnique(senders, prevOutput.Address)
+			}
+		}
+
+		recipients := make([]string, 0)
+		for _, output := range tx.Outputs {
+			if own[output.Address] {
+				if received, err = received.Add(output.Amount); err != nil {
+					return nil, err
+				}
+			} else {
+				recipients = appendUnique(recipients, output.Address)
+			}
+		}
+
+		entry := HistoryEntry{
+			TransactionID: txID,
+			BlockHeight:   info.BlockHeight,
+			Message:       tx.Message,
+		}
+
+		if spent > 0 {
+			entry.Type = "debit"
+			entry.Counterparty = strings.Join(recipients, ",")
+			entry.Amount = int64(received) - int64(spent)
+			entry.Fee = tx.Fee
+		} else {
+			entry.Type = "credit"
+			entry.Counterparty = strings.Join(senders, ",")
+			if len(tx.Inputs) == 0 {
+				entry.Counterparty = "Coinbase"
+			}
+			entry.Amount = int64(received)
+		}
+
+		balance += entry.Amount
+		entry.Balance = balance
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+
+	return append(list, value)
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/block"
+	"github.com/FilipeJohansson/go-coin/internal/encoding"
+	"github.com/FilipeJohansson/go-coin/internal/mempool"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+)
+
+// Chain files start with the magic and the storage version, so they can't be
+// mistaken for the JSON files saved before
+const STORAGE_MAGIC = "GOCOIN"
+const STORAGE_VERSION = 1
+
+// Serialize returns the stored form of the blockchain: the binary encoding of
+// every block, then of every pending transaction. The UTXO set and indexes
+// are rebuilt from the blocks when loading
+func (bc *Blockchain) Serialize() []byte {
+	w := encoding.NewWriter()
+	w.WriteUint8(STORAGE_VERSION)
+
+	w.WriteVarUint(uint64(len(bc.Blocks)))
+	for _, b := range bc.Blocks {
+		w.WriteBytes(b.Serialize())
+	}
+
+	var pending []*transaction.Transaction
+	if bc.Mempool != nil {
+		pending = bc.Mempool.GetTransactions()
+	}
+
+	w.WriteVarUint(uint64(len(pending)))
+	for _, tx := range pending {
+		w.WriteBytes(tx.Serialize())
+	}
+
+	return append([]byte(STORAGE_MAGIC), w.Bytes()...)
+}
+
+func IsSerializedBlockchain(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(STORAGE_MAGIC))
+}
+
+// DeserializeBlockchain decodes the blocks and mempool of a chain file. It
+// doesn't validate the chain
+func DeserializeBlockchain(data []byte) (*Blockchain, error) {
+	if !IsSerializedBlockchain(data) {
+		return nil, errors.New("not a blockchain file")
+	}
+
+	r := encoding.NewReader(data[len(STORAGE_MAGIC):])
+
+	version, err := r.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	if version != STORAGE_VERSION {
+		return nil, fmt.Errorf("unsupported storage version %d", version)
+	}
+
+	blockCount, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &Blockchain{
+		Blocks:  make([]*block.Block, 0, blockCount),
+		Mempool: mempool.NewMempool(),
+	}
+
+	for i := 0; i < blockCount; i++ {
+		encoded, err := r.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := block.DeserializeBlock(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		bc.Blocks = append(bc.Blocks, b)
+	}
+
+	pendingCount, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < pendingCount; i++ {
+		encoded, err := r.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := transaction.DeserializeTransaction(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("pending transaction %d: %w", i, err)
+		}
+		bc.Mempool.AddTransaction(tx)
+	}
+
+	if r.Remaining() != 0 {
+		return nil, errors.New("unexpected trailing bytes")
+	}
+
+	return bc, nil
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockchainSerializeRoundTrip(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+	bc.MineBlock(LEGACY_MINER)
+	encoded := bc.Serialize()
+
+	decoded, err := DeserializeBlockchain(encoded)
+	if err != nil {
+		t.Fatalf("DeserializeBlockchain() error: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Serialize(), encoded) {
+		t.Error("round trip changed the encoding")
+	}
+
+	if len(decoded.Blocks) != len(bc.Blocks) {
+		t.Fatalf("round trip kept %d of %d blocks", len(decoded.Blocks), len(bc.Blocks))
+	}
+
+	for i, b := range decoded.Blocks {
+		if b.BlockHash != bc.Blocks[i].BlockHash {
+			t.Errorf("round trip changed the hash of version %d block %d", b.Version, i)
+		}
+	}
+}
+
+func TestSaveToFileFormats(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"chain.dat", "chain.json"} {
+		filename := filepath.Join(dir, name)
+		if err := bc.SaveToFile(filename); err != nil {
+			t.Fatalf("SaveToFile(%s) error: %s", name, err)
+		}
+
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if binary := IsSerializedBlockchain(content); binary != (filepath.Ext(name) != ".json") {
+			t.Errorf("%s saved in the wrong format", name)
+		}
+
+		loaded, err := LoadFromFile(filename)
+		if err != nil {
+			t.Fatalf("LoadFromFile(%s) error: %s", name, err)
+		}
+
+		if len(loaded.Blocks) != len(bc.Blocks) || loaded.Mempool.Size() != bc.Mempool.Size() {
+			t.Errorf("%s: loaded %d blocks and %d pending transactions, want %d and %d",
+				name, len(loaded.Blocks), loaded.Mempool.Size(), len(bc.Blocks), bc.Mempool.Size())
+		}
+	}
+}
+
+func TestDeserializeBlockchainRejects(t *testing.T) {
+	bc, err := LoadFromFile(LEGACY_CHAIN)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error: %s", err)
+	}
+	valid := bc.Serialize()
+
+	unknownVersion := append([]byte{}, valid...)
+	unknownVersion[len(STORAGE_MAGIC)] = 9
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"JSON", []byte(`{"blocks": []}`)},
+		{"unknown version", unknownVersion},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DeserializeBlockchain(test.data); err == nil {
+				t.Error("DeserializeBlockchain() succeeded, want an error")
+			}
+		})
+	}
+}
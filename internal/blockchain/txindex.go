@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/FilipeJohansson/go-coin/internal/block"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+)
+
+type TxLocation struct {
+	BlockHeight int `json:"blockHeight"`
+	Position    int `json:"position"`
+}
+
+type TxInfo struct {
+	Transaction   *transaction.Transaction
+	TransactionID string
+	BlockHeight   int
+	BlockHash     string
+	Position      int
+	Confirmations int
+}
+
+func (bc *Blockchain) rebuildTxIndex() {
+	bc.TxIndex = make(map[string]TxLocation)
+	for height, b := range bc.Blocks {
+		bc.indexBlockTransactions(height, b)
+	}
+}
+
+func (bc *Blockchain) indexBlockTransactions(height int, b *block.Block) {
+	if bc.TxIndex == nil {
+		bc.TxIndex = make(map[string]TxLocation)
+	}
+
+	for position, tx := range b.Transactions {
+		// Old coinbases paying the same reward to the same miner share an ID,
+		// the first one keeps it
+		txID := hex.EncodeToString(tx.GetHash())
+		if _, ok := bc.TxIndex[txID]; ok {
+			continue
+		}
+
+		bc.TxIndex[txID] = TxLocation{
+			BlockHeight: height,
+			Position:    position,
+		}
+	}
+}
+
+func (bc *Blockchain) GetTransaction(txID string) (*TxInfo, error) {
+	location, ok := bc.TxIndex[txID]
+	if !ok {
+		return nil, errors.New("transaction not found")
+	}
+
+	b := bc.Blocks[location.BlockHeight]
+
+	return &TxInfo{
+		Transaction:   b.Transactions[location.Position],
+		TransactionID: txID,
+		BlockHeight:   location.BlockHeight,
+		BlockHash:     b.BlockHash,
+		Position:      location.Position,
+		Confirmations: len(bc.Blocks) - location.BlockHeight,
+	}, nil
+}
+
+// Returns the first confirmed transaction carrying the given payload
+func (bc *Blockchain) FindDataTransaction(data []byte) (*TxInfo, error) {
+	for _, b := range bc.Blocks {
+		for _, tx := range b.Transactions {
+			payload, ok := tx.GetData()
+			if !ok || !bytes.Equal(payload, data) {
+				continue
+			}
+
+			return bc.GetTransaction(hex.EncodeToString(tx.GetHash()))
+		}
+	}
+
+	return nil, errors.New("no transaction carries this data")
+}
+
+// Returns the output spent by the input, looking it up in the transaction index
+func (bc *Blockchain) GetPreviousOutput(input transaction.TransactionInput) (*transaction.TransactionOutput, error) {
+	info, err := bc.GetTransaction(input.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(input.OutputIndex) >= len(info.Transaction.Outputs) {
+		return nil, errors.New("output index out of range")
+	}
+
+	return &info.Transaction.Outputs[input.OutputIndex], nil
+}
@@ -0,0 +1,123 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Upper bound for any length prefix, so a corrupted or hostile payload can't
+// make the reader allocate arbitrary amounts of memory
+const MAX_FIELD_LENGTH = 1 << 24
+
+var ErrFieldTooLong = errors.New("field length exceeds limit")
+
+type Writer struct {
+	buf bytes.Buffer
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) WriteUint8(v uint8) {
+	w.buf.WriteByte(v)
+}
+
+func (w *Writer) WriteUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *Writer) WriteInt64(v int64) {
+	w.WriteUint64(uint64(v))
+}
+
+func (w *Writer) WriteVarUint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf.Write(b[:n])
+}
+
+func (w *Writer) WriteBytes(data []byte) {
+	w.WriteVarUint(uint64(len(data)))
+	w.buf.Write(data)
+}
+
+func (w *Writer) WriteString(s string) {
+	w.WriteBytes([]byte(s))
+}
+
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+type Reader struct {
+	r *bytes.Reader
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{r: bytes.NewReader(data)}
+}
+
+func (r *Reader) ReadUint8() (uint8, error) {
+	return r.r.ReadByte()
+}
+
+func (r *Reader) ReadUint64() (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r.r, b[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (r *Reader) ReadInt64() (int64, error) {
+	v, err := r.ReadUint64()
+	return int64(v), err
+}
+
+func (r *Reader) ReadVarUint() (uint64, error) {
+	return binary.ReadUvarint(r.r)
+}
+
+// Reads a length prefix and checks it against both the limit and the bytes
+// actually left in the payload
+func (r *Reader) ReadLength() (int, error) {
+	length, err := r.ReadVarUint()
+	if err != nil {
+		return 0, err
+	}
+
+	if length > MAX_FIELD_LENGTH || length > uint64(r.r.Len()) {
+		return 0, ErrFieldTooLong
+	}
+
+	return int(length), nil
+}
+
+func (r *Reader) ReadBytes() ([]byte, error) {
+	length, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *Reader) ReadString() (string, error) {
+	data, err := r.ReadBytes()
+	return string(data), err
+}
+
+func (r *Reader) Remaining() int {
+	return r.r.Len()
+}
@@ -0,0 +1,470 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+const VERSION = 1
+
+type PartialSignature struct {
+	PublicKey transaction.CustomPublicKey `json:"publicKey"`
+	Signature string                      `json:"signature"`
+}
+
+type PSBTInput struct {
+	UTXO             *utxo.UTXO        `json:"utxo"`
+	PartialSignature *PartialSignature `json:"partialSignature,omitempty"`
+	// Multisig script revealed when spending a script address, and the
+	// signatures collected for it, keyed by the hex encoded public key
+	RedeemScript       script.Script     `json:"redeemScript,omitempty"`
+	MultisigSignatures map[string]string `json:"multisigSignatures,omitempty"`
+	// Path from the extended key of a watch-only wallet to the key owning
+	// the UTXO, so an offline signer can derive it
+	Derivation string `json:"derivation,omitempty"`
+}
+
+// A partially signed transaction: the unsigned transaction plus everything
+// each signer needs to check what they are signing without access to the
+// blockchain, and the signatures collected so far
+type PSBT struct {
+	Version     int                      `json:"version"`
+	Transaction *transaction.Transaction `json:"transaction"`
+	Inputs      []PSBTInput              `json:"inputs"`
+	Metadata    map[string]string        `json:"metadata,omitempty"`
+	Finalized   bool                     `json:"finalized"`
+}
+
+func NewPSBT(tx *transaction.Transaction, utxoSet *utxo.UTXOSet) (*PSBT, error) {
+	if tx == nil || len(tx.Inputs) == 0 {
+		return nil, errors.New("transaction has no inputs")
+	}
+
+	unsigned := *tx
+	unsigned.Inputs = make([]transaction.TransactionInput, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		unsigned.Inputs[i] = transaction.TransactionInput{
+			TransactionID: input.TransactionID,
+			OutputIndex:   input.OutputIndex,
+			Sequence:      input.Sequence,
+		}
+	}
+
+	inputs := make([]PSBTInput, len(unsigned.Inputs))
+	for i, input := range unsigned.Inputs {
+		u := utxoSet.GetUTXO(input.TransactionID, input.OutputIndex)
+		if u == nil {
+			return nil, fmt.Errorf("UTXO %s:%d does not exist", input.TransactionID, input.OutputIndex)
+		}
+
+		utxoCopy := *u
+		inputs[i] = PSBTInput{UTXO: &utxoCopy}
+	}
+
+	return &PSBT{
+		Version:     VERSION,
+		Transaction: &unsigned,
+		Inputs:      inputs,
+		Metadata:    make(map[string]string),
+	}, nil
+}
+
+// Attach the multisig script behind a script address to every input
+// spending from it
+func (p *PSBT) AddRedeemScript(redeemScript script.Script) (int, error) {
+	if _, _, err := script.ParseMultisig(redeemScript); err != nil {
+		return 0, err
+	}
+
+	address := redeemScript.Address()
+
+	added := 0
+	for i, input := range p.Inputs {
+		if input.UTXO.Address != address {
+			continue
+		}
+
+		p.Inputs[i].RedeemScript = redeemScript
+		p.Inputs[i].MultisigSignatures = make(map[string]string)
+		added++
+	}
+
+	if added == 0 {
+		return 0, fmt.Errorf("no input spends from %s", address)
+	}
+
+	return added, nil
+}
+
+// Sign every input owned by the wallet, returning how many were signed
+func (p *PSBT) Sign(w *wallet.Wallet) (int, error) {
+	if p.Finalized {
+		return 0, errors.New("PSBT is already finalized")
+	}
+
+	if err := p.checkUTXOs(); err != nil {
+		return 0, err
+	}
+
+	signed := 0
+	for i, input := range p.Inputs {
+		if len(input.RedeemScript) > 0 {
+			ok, err := p.signMultisig(w, i)
+			if err != nil {
+				return signed, err
+			}
+			if ok {
+				signed++
+			}
+			continue
+		}
+
+		if input.UTXO.Address != w.Address {
+			continue
+		}
+
+		if err := p.signInput(w, i); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+
+	return signed, nil
+}
+
+// Sign every input with a derivation path whose key, derived from the
+// extended private key, owns the UTXO
+func (p *PSBT) SignWithExtendedKey(key *wallet.ExtendedKey) (int, error) {
+	if p.Finalized {
+		return 0, errors.New("PSBT is already finalized")
+	}
+
+	if err := p.checkUTXOs(); err != nil {
+		return 0, err
+	}
+
+	if !key.IsPrivate() {
+		return 0, errors.New("an extended private key is required to sign")
+	}
+
+	signed := 0
+	for i, input := range p.Inputs {
+		if input.Derivation == "" {
+			continue
+		}
+
+		child, err := key.Derive(input.Derivation)
+		if err != nil {
+			return signed, fmt.Errorf("input %d: %w", i, err)
+		}
+
+		w, err := child.Wallet()
+		if err != nil {
+			return signed, err
+		}
+
+		if input.UTXO.Address != w.Address {
+			continue
+		}
+
+		if err := p.signInput(w, i); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+
+	return signed, nil
+}
+
+func (p *PSBT) signInput(w *wallet.Wallet, index int) error {
+	signature, err := w.SignInput(p.Transaction, index)
+	if err != nil {
+		return err
+	}
+
+	p.Inputs[index].PartialSignature = &PartialSignature{
+		PublicKey: w.GetCustomPublicKey(),
+		Signature: signature,
+	}
+	return nil
+}
+
+func (p *PSBT) signMultisig(w *wallet.Wallet, index int) (bool, error) {
+	_, keys, err := script.ParseMultisig(p.Inputs[index].RedeemScript)
+	if err != nil {
+		return false, err
+	}
+
+	walletKey := script.EncodePublicKey(&w.PublicKey)
+	for _, key := range keys {
+		if !bytes.Equal(key, walletKey) {
+			continue
+		}
+
+		signature, err := w.SignInput(p.Transaction, index)
+		if err != nil {
+			return false, err
+		}
+
+		p.Inputs[index].MultisigSignatures[hex.EncodeToString(key)] = signature
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Merge the signatures and metadata of other copies of the same PSBT
+func (p *PSBT) Combine(others ...*PSBT) error {
+	txID := p.GetTransactionID()
+
+	for _, other := range others {
+		if other.GetTransactionID() != txID {
+			return errors.New("PSBTs are for different transactions")
+		}
+
+		for i, input := range other.Inputs {
+			if input.PartialSignature != nil && p.Inputs[i].PartialSignature == nil {
+				p.Inputs[i].PartialSignature = input.PartialSignature
+			}
+
+			if len(input.RedeemScript) > 0 && len(p.Inputs[i].RedeemScript) == 0 {
+				p.Inputs[i].RedeemScript = input.RedeemScript
+			}
+
+			if len(input.MultisigSignatures) > 0 && p.Inputs[i].MultisigSignatures == nil {
+				p.Inputs[i].MultisigSignatures = make(map[string]string)
+			}
+
+			for key, signature := range input.MultisigSignatures {
+				if _, ok := p.Inputs[i].MultisigSignatures[key]; !ok {
+					p.Inputs[i].MultisigSignatures[key] = signature
+				}
+			}
+		}
+
+		for k, v := range other.Metadata {
+			if _, ok := p.Metadata[k]; !ok {
+				p.Metadata[k] = v
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check every partial signature and move them into the transaction
+func (p *PSBT) Finalize() error {
+	unlockingScripts := make([]script.Script, len(p.Inputs))
+	for i, input := range p.Inputs {
+		if len(input.RedeemScript) > 0 {
+			unlockingScript, err := p.finalizeMultisig(i)
+			if err != nil {
+				return err
+			}
+			unlockingScripts[i] = unlockingScript
+			continue
+		}
+
+		if input.PartialSignature == nil {
+			return fmt.Errorf("input %d is not signed", i)
+		}
+
+		if err := p.verifyInput(i); err != nil {
+			return err
+		}
+	}
+
+	for i, input := range p.Inputs {
+		if unlockingScripts[i] != nil {
+			p.Transaction.Inputs[i].UnlockingScript = unlockingScripts[i]
+			continue
+		}
+
+		p.Transaction.Inputs[i].PublicKey = input.PartialSignature.PublicKey
+		p.Transaction.Inputs[i].Signature = input.PartialSignature.Signature
+	}
+	p.Finalized = true
+
+	return nil
+}
+
+// Pick the first m valid signatures in key order and build the unlocking
+// script revealing the multisig script
+func (p *PSBT) finalizeMultisig(index int) (script.Script, error) {
+	input := p.Inputs[index]
+
+	if input.RedeemScript.Address() != input.UTXO.Address {
+		return nil, fmt.Errorf("input %d redeem script doesn't match its address", index)
+	}
+
+	m, keys, err := script.ParseMultisig(input.RedeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([][]byte, 0, m)
+	for _, key := range keys {
+		if len(signatures) == m {
+			break
+		}
+
+		signature, ok := input.MultisigSignatures[hex.EncodeToString(key)]
+		if !ok {
+			continue
+		}
+
+		publicKey, err := script.DecodePublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		customKey := transaction.NewCustomPublicKey(*publicKey)
+		if !wallet.ValidateInputSignature(*p.Transaction, index, customKey, signature) {
+			continue
+		}
+
+		signatureBytes, _ := hex.DecodeString(signature)
+		signatures = append(signatures, signatureBytes)
+	}
+
+	if len(signatures) < m {
+		return nil, fmt.Errorf("input %d has %d of %d required valid signatures", index, len(signatures), m)
+	}
+
+	return script.NewPayToScriptHashUnlock(script.NewMultisigUnlock(signatures), input.RedeemScript), nil
+}
+
+func (p *PSBT) Extract() (*transaction.Transaction, error) {
+	if !p.Finalized {
+		return nil, errors.New("PSBT is not finalized")
+	}
+
+	return p.Transaction, nil
+}
+
+func (p *PSBT) verifyInput(index int) error {
+	partial := p.Inputs[index].PartialSignature
+
+	from := common.GetAddressFromPublicKey(*partial.PublicKey.GetPublicKey())
+	if from != p.Inputs[index].UTXO.Address {
+		return fmt.Errorf("input %d signed by a key that doesn't own it", index)
+	}
+
+	if !wallet.ValidateInputSignature(*p.Transaction, index, partial.PublicKey, partial.Signature) {
+		return fmt.Errorf("input %d has an invalid signature", index)
+	}
+
+	return nil
+}
+
+func (p *PSBT) GetTransactionID() string {
+	return hex.EncodeToString(p.Transaction.GetHash())
+}
+
+func (p *PSBT) Encode() (string, error) {
+	content, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(content), nil
+}
+
+func Decode(encoded string) (*PSBT, error) {
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	var p PSBT
+	if err := decoder.Decode(&p); err != nil {
+		return nil, err
+	}
+
+	if p.Version != VERSION {
+		return nil, fmt.Errorf("unsupported PSBT version %d", p.Version)
+	}
+
+	if p.Transaction == nil || len(p.Inputs) != len(p.Transaction.Inputs) {
+		return nil, errors.New("PSBT inputs don't match its transaction")
+	}
+
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]string)
+	}
+
+	if err := p.checkUTXOs(); err != nil {
+		return nil, err
+	}
+
+	for i := range p.Inputs {
+		if len(p.Inputs[i].RedeemScript) > 0 && p.Inputs[i].MultisigSignatures == nil {
+			p.Inputs[i].MultisigSignatures = make(map[string]string)
+		}
+	}
+
+	return &p, nil
+}
+
+// Every input must carry the UTXO its transaction input spends, or a signer
+// would be shown the wrong address and amount
+func (p *PSBT) checkUTXOs() error {
+	for i, input := range p.Inputs {
+		if input.UTXO == nil {
+			return fmt.Errorf("input %d is missing its UTXO", i)
+		}
+
+		txInput := p.Transaction.Inputs[i]
+		if input.UTXO.TransactionID != txInput.TransactionID || input.UTXO.OutputIndex != txInput.OutputIndex {
+			return fmt.Errorf("input %d UTXO %s:%d doesn't match the spent output %s:%d", i, input.UTXO.TransactionID, input.UTXO.OutputIndex, txInput.TransactionID, txInput.OutputIndex)
+		}
+	}
+
+	return nil
+}
+
+func (p *PSBT) Print() string {
+	var inputs string
+	for i, input := range p.Inputs {
+		status := "unsigned"
+		if input.PartialSignature != nil {
+			status = "signed"
+		}
+
+		if len(input.RedeemScript) > 0 {
+			m, keys, _ := script.ParseMultisig(input.RedeemScript)
+			status = fmt.Sprintf("%d of %d signatures (%d keys)", len(input.MultisigSignatures), m, len(keys))
+		}
+
+		lines := []string{
+			fmt.Sprintf("Input %d: %s:%d", i, input.UTXO.TransactionID, input.UTXO.OutputIndex),
+			fmt.Sprintf("Address: %s", input.UTXO.Address),
+			fmt.Sprintf("Amount:  %s", input.UTXO.Amount),
+			fmt.Sprintf("Status:  %s", status),
+		}
+		if input.Derivation != "" {
+			lines = append(lines, fmt.Sprintf("Path:    %s", input.Derivation))
+		}
+
+		inputs += common.BuildBox(lines...)
+	}
+
+	return fmt.Sprintf(`
+Transaction ID: %s
+Finalized: %t
+Inputs:
+%s`, p.GetTransactionID(), p.Finalized, inputs)
+}
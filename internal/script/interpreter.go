@@ -0,0 +1,513 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+const MAX_STACK_SIZE = 1000
+const MAX_OPS = 201
+const MAX_NUMBER_SIZE = 8
+
+var ErrScriptFailed = errors.New("script evaluated to false")
+
+// Everything about the spending transaction the script can look at
+type Context struct {
+	// Hash the signatures of the input must sign
+	SignatureHash []byte
+	// Lock time of the spending transaction
+	LockTime int64
+	// Relative lock, in blocks, of the input being verified
+	Sequence int64
+	// When set, the Schnorr signatures of OP_CHECKSIG are added to it to be
+	// checked together, instead of one by one
+	Batch *common.SchnorrBatch
+}
+
+type interpreter struct {
+	stack   [][]byte
+	context *Context
+	ops     int
+}
+
+// Run the unlocking script followed by the locking script over the same
+// stack. The spend is valid if nothing fails and the top of the stack ends
+// up true. For pay-to-script-hash outputs, the revealed script is then run
+// over what the unlocking script left below it
+func Verify(unlocking Script, locking Script, context *Context) error {
+	if !unlocking.IsPushOnly() {
+		return errors.New("unlocking script must only push data")
+	}
+
+	in := &interpreter{context: context}
+
+	if err := in.execute(unlocking); err != nil {
+		return err
+	}
+
+	redeemStack := append([][]byte{}, in.stack...)
+
+	if err := in.execute(locking); err != nil {
+		return err
+	}
+
+	if err := in.checkResult(); err != nil {
+		return err
+	}
+
+	if _, ok := locking.PayToScriptHashTarget(); !ok {
+		return nil
+	}
+
+	redeem := &interpreter{context: context, stack: redeemStack}
+	redeemScript, err := redeem.pop()
+	if err != nil {
+		return err
+	}
+
+	if err := redeem.execute(redeemScript); err != nil {
+		return err
+	}
+
+	return redeem.checkResult()
+}
+
+func (in *interpreter) checkResult() error {
+	if len(in.stack) == 0 || !isTrue(in.stack[len(in.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+func (in *interpreter) execute(s Script) error {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return err
+	}
+
+	// Each entry tells if the branch of an enclosing OP_IF is being executed
+	conditions := make([]bool, 0)
+	executing := func() bool {
+		for _, c := range conditions {
+			if !c {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, instruction := range instructions {
+		if len(instruction.Data) > MAX_PUSH_SIZE {
+			return errors.New("push exceeds maximum size")
+		}
+
+		if instruction.Opcode > OP_16 {
+			in.ops++
+			if in.ops > MAX_OPS {
+				return errors.New("too many operations")
+			}
+		}
+
+		switch instruction.Opcode {
+		case OP_IF, OP_NOTIF:
+			condition := false
+			if executing() {
+				value, err := in.pop()
+				if err != nil {
+					return err
+				}
+				condition = isTrue(value) == (instruction.Opcode == OP_IF)
+			}
+			conditions = append(conditions, condition)
+			continue
+		case OP_ELSE:
+			if len(conditions) == 0 {
+				return errors.New("OP_ELSE without OP_IF")
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OP_ENDIF:
+			if len(conditions) == 0 {
+				return errors.New("OP_ENDIF without OP_IF")
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+
+		if !executing() {
+			continue
+		}
+
+		if err := in.step(instruction); err != nil {
+			return err
+		}
+
+		if len(in.stack) > MAX_STACK_SIZE {
+			return errors.New("stack overflow")
+		}
+	}
+
+	if len(conditions) != 0 {
+		return errors.New("unbalanced conditional")
+	}
+
+	return nil
+}
+
+func (in *interpreter) step(instruction Instruction) error {
+	opcode := instruction.Opcode
+
+	switch {
+	case instruction.Data != nil:
+		in.push(instruction.Data)
+		return nil
+	case opcode == OP_0:
+		in.push([]byte{})
+		return nil
+	case opcode == OP_1NEGATE:
+		in.push(encodeNumber(-1))
+		return nil
+	case opcode >= OP_1 && opcode <= OP_16:
+		in.push(encodeNumber(int64(opcode - OP_1 + 1)))
+		return nil
+	}
+
+	switch opcode {
+	case OP_VERIFY:
+		return in.verify()
+	case OP_RETURN:
+		return errors.New("OP_RETURN executed")
+	case OP_DROP:
+		_, err := in.pop()
+		return err
+	case OP_DUP:
+		value, err := in.peek()
+		if err != nil {
+			return err
+		}
+		in.push(value)
+	case OP_SWAP:
+		a, err := in.pop()
+		if err != nil {
+			return err
+		}
+		b, err := in.pop()
+		if err != nil {
+			return err
+		}
+		in.push(a)
+		in.push(b)
+	case OP_SIZE:
+		value, err := in.peek()
+		if err != nil {
+			return err
+		}
+		in.push(encodeNumber(int64(len(value))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := in.pop()
+		if err != nil {
+			return err
+		}
+		b, err := in.pop()
+		if err != nil {
+			return err
+		}
+		in.pushBool(bytes.Equal(a, b))
+		if opcode == OP_EQUALVERIFY {
+			return in.verify()
+		}
+	case OP_SHA256:
+		value, err := in.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(value)
+		in.push(hash[:])
+	case OP_HASH256:
+		value, err := in.pop()
+		if err != nil {
+			return err
+		}
+		first := sha256.Sum256(value)
+		second := sha256.Sum256(first[:])
+		in.push(second[:])
+	case OP_ADDRESSHASH:
+		value, err := in.pop()
+		if err != nil {
+			return err
+		}
+		key, err := DecodePublicKey(value)
+		if err != nil {
+			return err
+		}
+		in.push(key.AddressHash())
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		keyBytes, err := in.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := in.pop()
+		if err != nil {
+			return err
+		}
+		valid, err := in.checkSingleSignature(signature, keyBytes)
+		if err != nil {
+			return err
+		}
+		in.pushBool(valid)
+		if opcode == OP_CHECKSIGVERIFY {
+			return in.verify()
+		}
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := in.checkMultisig()
+		if err != nil {
+			return err
+		}
+		in.pushBool(valid)
+		if opcode == OP_CHECKMULTISIGVERIFY {
+			return in.verify()
+		}
+	case OP_CHECKLOCKTIMEVERIFY:
+		value, err := in.peek()
+		if err != nil {
+			return err
+		}
+		required, err := decodeNumber(value)
+		if err != nil {
+			return err
+		}
+		if (required < common.LOCKTIME_THRESHOLD) != (in.context.LockTime < common.LOCKTIME_THRESHOLD) {
+			return errors.New("lock time type mismatch")
+		}
+		return in.checkLock(in.context.LockTime, "lock time")
+	case OP_CHECKSEQUENCEVERIFY:
+		return in.checkLock(in.context.Sequence, "sequence")
+	default:
+		return fmt.Errorf("unknown opcode %#x", opcode)
+	}
+
+	return nil
+}
+
+func (in *interpreter) checkSignature(signature []byte, keyBytes []byte) bool {
+	key, err := DecodePublicKey(keyBytes)
+	if err != nil {
+		return false
+	}
+
+	return key.VerifyHash(in.context.SignatureHash, signature)
+}
+
+// A Schnorr signature must be valid or empty, so it can be assumed valid
+// until the batch it goes to is checked. Other keys keep failing with false
+func (in *interpreter) checkSingleSignature(signature []byte, keyBytes []byte) (bool, error) {
+	key, err := DecodePublicKey(keyBytes)
+	if err != nil || key.Type != common.KEY_TYPE_SCHNORR || len(signature) == 0 {
+		return in.checkSignature(signature, keyBytes), nil
+	}
+
+	if in.context.Batch != nil {
+		if err := in.context.Batch.Add(key, in.context.SignatureHash, signature); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if !key.VerifyHash(in.context.SignatureHash, signature) {
+		return false, errors.New("invalid schnorr signature")
+	}
+
+	return true, nil
+}
+
+// Stack: <sig 1> ... <sig m> <m> <key 1> ... <key n> <n>. Signatures must be
+// in the same order as the keys they belong to
+func (in *interpreter) checkMultisig() (bool, error) {
+	n, err := in.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > 16 {
+		return false, errors.New("invalid number of multisig keys")
+	}
+
+	keys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if keys[i], err = in.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := in.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, errors.New("invalid number of multisig signatures")
+	}
+
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if signatures[i], err = in.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	k := 0
+	for _, signature := range signatures {
+		for k < len(keys) && !in.checkSignature(signature, keys[k]) {
+			k++
+		}
+		if k == len(keys) {
+			return false, nil
+		}
+		k++
+	}
+
+	return true, nil
+}
+
+// Leaves the required value on the stack, as OP_CHECKLOCKTIMEVERIFY and
+// OP_CHECKSEQUENCEVERIFY are usually followed by OP_DROP
+func (in *interpreter) checkLock(current int64, name string) error {
+	value, err := in.peek()
+	if err != nil {
+		return err
+	}
+
+	required, err := decodeNumber(value)
+	if err != nil {
+		return err
+	}
+
+	if required < 0 {
+		return fmt.Errorf("negative %s", name)
+	}
+
+	if current < required {
+		return fmt.Errorf("%s not reached: %d < %d", name, current, required)
+	}
+
+	return nil
+}
+
+func (in *interpreter) verify() error {
+	value, err := in.pop()
+	if err != nil {
+		return err
+	}
+
+	if !isTrue(value) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+func (in *interpreter) push(value []byte) {
+	in.stack = append(in.stack, value)
+}
+
+func (in *interpreter) pushBool(value bool) {
+	if value {
+		in.push([]byte{1})
+	} else {
+		in.push([]byte{})
+	}
+}
+
+func (in *interpreter) pop() ([]byte, error) {
+	value, err := in.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	in.stack = in.stack[:len(in.stack)-1]
+	return value, nil
+}
+
+func (in *interpreter) peek() ([]byte, error) {
+	if len(in.stack) == 0 {
+		return nil, errors.New("stack underflow")
+	}
+
+	return in.stack[len(in.stack)-1], nil
+}
+
+func (in *interpreter) popNumber() (int64, error) {
+	value, err := in.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeNumber(value)
+}
+
+func isTrue(value []byte) bool {
+	for i, b := range value {
+		if b != 0 {
+			// Negative zero is false
+			return !(i == len(value)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+// Numbers are little endian with the sign in the most significant bit
+func encodeNumber(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+
+	result := make([]byte, 0, 9)
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+func decodeNumber(value []byte) (int64, error) {
+	if len(value) > MAX_NUMBER_SIZE {
+		return 0, errors.New("number too large")
+	}
+
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range value {
+		result |= int64(b) << (8 * i)
+	}
+
+	if value[len(value)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << (8 * (len(value) - 1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
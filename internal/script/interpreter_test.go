@@ -0,0 +1,356 @@
+package script
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+var testSignatureHash = sha256.Sum256([]byte("spending transaction"))
+
+func testKey(t *testing.T, keyType common.KeyType, seed int) *common.PrivateKey {
+	t.Helper()
+
+	d := sha256.Sum256([]byte(fmt.Sprintf("script key %d", seed)))
+	key, err := common.NewPrivateKey(keyType, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testSign(t *testing.T, key *common.PrivateKey, hash []byte) []byte {
+	t.Helper()
+
+	signature, err := key.SignHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signature
+}
+
+func testPayToPubKeyHash(t *testing.T, key *common.PrivateKey) Script {
+	t.Helper()
+
+	locking, err := NewPayToPubKeyHash(common.GetAddressFromPublicKey(*key.GetPublicKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return locking
+}
+
+// Locking script of count operations, alternating OP_DUP and OP_DROP on top
+// of OP_1
+func countedOps(count int) Script {
+	builder := NewBuilder().AddOp(OP_1)
+	for i := 0; i < count; i++ {
+		if i%2 == 0 {
+			builder.AddOp(OP_DUP)
+		} else {
+			builder.AddOp(OP_DROP)
+		}
+	}
+
+	return builder.Script()
+}
+
+type verifyTest struct {
+	name      string
+	unlocking Script
+	locking   Script
+	context   Context
+	valid     bool
+}
+
+func runVerifyTests(t *testing.T, tests []verifyTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := tt.context
+			if context.SignatureHash == nil {
+				context.SignatureHash = testSignatureHash[:]
+			}
+
+			err := Verify(tt.unlocking, tt.locking, &context)
+			if tt.valid && err != nil {
+				t.Errorf("Verify() error: %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Verify() should fail")
+			}
+		})
+	}
+}
+
+func TestVerifyPayToPubKeyHash(t *testing.T) {
+	tests := make([]verifyTest, 0)
+	for _, keyType := range []common.KeyType{common.KEY_TYPE_P256, common.KEY_TYPE_SECP256K1, common.KEY_TYPE_SCHNORR} {
+		key := testKey(t, keyType, 1)
+		other := testKey(t, keyType, 2)
+		locking := testPayToPubKeyHash(t, key)
+		otherHash := sha256.Sum256([]byte("other transaction"))
+
+		tests = append(tests,
+			verifyTest{
+				name:      fmt.Sprintf("%s valid", keyType),
+				unlocking: NewPayToPubKeyHashUnlock(testSign(t, key, testSignatureHash[:]), key.GetPublicKey()),
+				locking:   locking,
+				valid:     true,
+			},
+			verifyTest{
+				name:      fmt.Sprintf("%s other key", keyType),
+				unlocking: NewPayToPubKeyHashUnlock(testSign(t, other, testSignatureHash[:]), other.GetPublicKey()),
+				locking:   locking,
+			},
+			verifyTest{
+				name:      fmt.Sprintf("%s signature of another hash", keyType),
+				unlocking: NewPayToPubKeyHashUnlock(testSign(t, key, otherHash[:]), key.GetPublicKey()),
+				locking:   locking,
+			},
+			verifyTest{
+				name:      fmt.Sprintf("%s empty signature", keyType),
+				unlocking: NewPayToPubKeyHashUnlock(nil, key.GetPublicKey()),
+				locking:   locking,
+			},
+		)
+	}
+
+	runVerifyTests(t, tests)
+}
+
+func TestVerifyPayToScriptHash(t *testing.T) {
+	preimage := []byte("swap secret")
+	secretHash := sha256.Sum256(preimage)
+	redeem := NewHashLock(secretHash[:])
+
+	keys := []*common.PrivateKey{
+		testKey(t, common.KEY_TYPE_P256, 1),
+		testKey(t, common.KEY_TYPE_SECP256K1, 2),
+		testKey(t, common.KEY_TYPE_SCHNORR, 3),
+	}
+	publicKeys := make([]*common.PublicKey, len(keys))
+	for i, key := range keys {
+		publicKeys[i] = key.GetPublicKey()
+	}
+
+	multisig, err := NewMultisig(2, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures := NewMultisigUnlock([][]byte{
+		testSign(t, keys[0], testSignatureHash[:]),
+		testSign(t, keys[2], testSignatureHash[:]),
+	})
+
+	runVerifyTests(t, []verifyTest{
+		{
+			name:      "hash lock redeem",
+			unlocking: NewPayToScriptHashUnlock(NewHashLockUnlock(preimage), redeem),
+			locking:   NewPayToScriptHash(redeem.Hash()),
+			valid:     true,
+		},
+		{
+			name:      "wrong preimage",
+			unlocking: NewPayToScriptHashUnlock(NewHashLockUnlock([]byte("guess")), redeem),
+			locking:   NewPayToScriptHash(redeem.Hash()),
+		},
+		{
+			name:      "redeem script of another hash",
+			unlocking: NewPayToScriptHashUnlock(NewHashLockUnlock(preimage), redeem),
+			locking:   NewPayToScriptHash(multisig.Hash()),
+		},
+		{
+			name:      "multisig redeem",
+			unlocking: NewPayToScriptHashUnlock(signatures, multisig),
+			locking:   NewPayToScriptHash(multisig.Hash()),
+			valid:     true,
+		},
+		{
+			name:      "no redeem script",
+			unlocking: NewHashLockUnlock(preimage),
+			locking:   NewPayToScriptHash(redeem.Hash()),
+		},
+	})
+}
+
+func TestVerifyMultisig(t *testing.T) {
+	keys := make([]*common.PrivateKey, 3)
+	publicKeys := make([]*common.PublicKey, 3)
+	signatures := make([][]byte, 3)
+	for i := range keys {
+		keys[i] = testKey(t, common.KEY_TYPE_SECP256K1, i+1)
+		publicKeys[i] = keys[i].GetPublicKey()
+		signatures[i] = testSign(t, keys[i], testSignatureHash[:])
+	}
+
+	locking, err := NewMultisig(2, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outsider := testSign(t, testKey(t, common.KEY_TYPE_SECP256K1, 9), testSignatureHash[:])
+
+	runVerifyTests(t, []verifyTest{
+		{
+			name:      "first and last keys",
+			unlocking: NewMultisigUnlock([][]byte{signatures[0], signatures[2]}),
+			locking:   locking,
+			valid:     true,
+		},
+		{
+			name:      "first two keys",
+			unlocking: NewMultisigUnlock([][]byte{signatures[0], signatures[1]}),
+			locking:   locking,
+			valid:     true,
+		},
+		{
+			name:      "out of key order",
+			unlocking: NewMultisigUnlock([][]byte{signatures[2], signatures[0]}),
+			locking:   locking,
+		},
+		{
+			name:      "same signature twice",
+			unlocking: NewMultisigUnlock([][]byte{signatures[1], signatures[1]}),
+			locking:   locking,
+		},
+		{
+			name:      "signature of another key",
+			unlocking: NewMultisigUnlock([][]byte{signatures[0], outsider}),
+			locking:   locking,
+		},
+		{
+			name:      "too few signatures",
+			unlocking: NewMultisigUnlock([][]byte{signatures[0]}),
+			locking:   locking,
+		},
+	})
+}
+
+func TestVerifyLocks(t *testing.T) {
+	succeed := Script{OP_1}
+	timestamp := int64(common.LOCKTIME_THRESHOLD + 1000)
+	sequenceLock := NewBuilder().AddInt(10).AddOp(OP_CHECKSEQUENCEVERIFY).AddOp(OP_DROP).AddOp(OP_1).Script()
+
+	runVerifyTests(t, []verifyTest{
+		{
+			name:    "height lock reached",
+			locking: NewTimeLock(100, succeed),
+			context: Context{LockTime: 100},
+			valid:   true,
+		},
+		{
+			name:    "height lock not reached",
+			locking: NewTimeLock(100, succeed),
+			context: Context{LockTime: 99},
+		},
+		{
+			name:    "height lock with a timestamp lock time",
+			locking: NewTimeLock(100, succeed),
+			context: Context{LockTime: timestamp},
+		},
+		{
+			name:    "time lock reached",
+			locking: NewTimeLock(timestamp, succeed),
+			context: Context{LockTime: timestamp},
+			valid:   true,
+		},
+		{
+			name:    "time lock with a height lock time",
+			locking: NewTimeLock(timestamp, succeed),
+			context: Context{LockTime: common.LOCKTIME_THRESHOLD - 1},
+		},
+		{
+			name:    "negative lock",
+			locking: NewBuilder().AddInt(-1).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).AddOp(OP_1).Script(),
+			context: Context{LockTime: 100},
+		},
+		{
+			name:    "sequence reached",
+			locking: sequenceLock,
+			context: Context{Sequence: 10},
+			valid:   true,
+		},
+		{
+			name:    "sequence not reached",
+			locking: sequenceLock,
+			context: Context{Sequence: 9},
+		},
+	})
+}
+
+func TestVerifyLimits(t *testing.T) {
+	pushes := func(count int) Script {
+		builder := NewBuilder()
+		for i := 0; i < count; i++ {
+			builder.AddOp(OP_1)
+		}
+		return builder.Script()
+	}
+
+	push := func(size int) Script {
+		return NewBuilder().AddData(make([]byte, size)).AddOp(OP_DROP).AddOp(OP_1).Script()
+	}
+
+	runVerifyTests(t, []verifyTest{
+		{
+			name:    "MAX_OPS operations",
+			locking: countedOps(MAX_OPS),
+			valid:   true,
+		},
+		{
+			name:    "more than MAX_OPS operations",
+			locking: countedOps(MAX_OPS + 1),
+		},
+		{
+			name:      "MAX_STACK_SIZE items",
+			unlocking: pushes(MAX_STACK_SIZE),
+			locking:   Script{},
+			valid:     true,
+		},
+		{
+			name:      "more than MAX_STACK_SIZE items",
+			unlocking: pushes(MAX_STACK_SIZE + 1),
+			locking:   Script{},
+		},
+		{
+			name:    "MAX_PUSH_SIZE push",
+			locking: push(MAX_PUSH_SIZE),
+			valid:   true,
+		},
+		{
+			name:    "push above MAX_PUSH_SIZE",
+			locking: push(MAX_PUSH_SIZE + 1),
+		},
+	})
+}
+
+func TestVerifyUnlockingMustBePushOnly(t *testing.T) {
+	key := testKey(t, common.KEY_TYPE_P256, 1)
+	unlocking := NewPayToPubKeyHashUnlock(testSign(t, key, testSignatureHash[:]), key.GetPublicKey())
+
+	runVerifyTests(t, []verifyTest{
+		{
+			name:      "pushes only",
+			unlocking: unlocking,
+			locking:   testPayToPubKeyHash(t, key),
+			valid:     true,
+		},
+		{
+			name:      "with an operation",
+			unlocking: append(append(Script{}, unlocking...), OP_DUP, OP_DROP),
+			locking:   testPayToPubKeyHash(t, key),
+		},
+		{
+			name:      "small integers",
+			unlocking: Script{OP_1NEGATE, OP_16},
+			locking:   Script{OP_DROP, OP_DROP, OP_1},
+			valid:     true,
+		},
+	})
+}
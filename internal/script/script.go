@@ -0,0 +1,583 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const MAX_SCRIPT_SIZE = 10000
+const MAX_PUSH_SIZE = 520
+
+// Prefix of script addresses. It makes them one byte longer than plain
+// addresses, so the two can't be mistaken for each other
+const SCRIPT_ADDRESS_VERSION = 0x05
+
+// Script is a sequence of opcodes and data pushes. It is stored as hex in
+// JSON so blockchain files stay readable
+type Script []byte
+
+type Instruction struct {
+	Opcode byte
+	Data   []byte
+}
+
+func (s Script) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(s))
+}
+
+func (s *Script) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+
+	*s = decoded
+	return nil
+}
+
+func (s Script) Instructions() ([]Instruction, error) {
+	if len(s) > MAX_SCRIPT_SIZE {
+		return nil, errors.New("script too large")
+	}
+
+	instructions := make([]Instruction, 0)
+	for i := 0; i < len(s); {
+		opcode := s[i]
+		i++
+
+		var length int
+		switch {
+		case opcode > OP_0 && opcode < OP_PUSHDATA1:
+			length = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, errors.New("truncated push")
+			}
+			length = int(s[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, errors.New("truncated push")
+			}
+			length = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		default:
+			instructions = append(instructions, Instruction{Opcode: opcode})
+			continue
+		}
+
+		if i+length > len(s) {
+			return nil, errors.New("truncated push")
+		}
+
+		instructions = append(instructions, Instruction{Opcode: opcode, Data: s[i : i+length]})
+		i += length
+	}
+
+	return instructions, nil
+}
+
+func (s Script) IsPushOnly() bool {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return false
+	}
+
+	for _, in := range instructions {
+		if in.Opcode > OP_16 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s Script) String() string {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return fmt.Sprintf("[invalid script: %s]", err.Error())
+	}
+
+	parts := make([]string, 0, len(instructions))
+	for _, in := range instructions {
+		switch {
+		case in.Data != nil:
+			parts = append(parts, hex.EncodeToString(in.Data))
+		case in.Opcode >= OP_1 && in.Opcode <= OP_16:
+			parts = append(parts, fmt.Sprintf("OP_%d", in.Opcode-OP_1+1))
+		default:
+			name, ok := opcodeNames[in.Opcode]
+			if !ok {
+				name = fmt.Sprintf("OP_UNKNOWN_%#x", in.Opcode)
+			}
+			parts = append(parts, name)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Address identifying the script in the UTXO set. Pay-to-pubkey-hash scripts
+// map back to the address they pay to, any other script to the script address
+// paying to its hash, so both forms of the same script share an address
+func (s Script) Address() string {
+	if hash, ok := s.PayToPubKeyHashTarget(); ok {
+		return base58.Encode(hash)
+	}
+
+	if hash, ok := s.PayToScriptHashTarget(); ok {
+		return EncodeScriptAddress(hash)
+	}
+
+	return EncodeScriptAddress(s.Hash())
+}
+
+func (s Script) Hash() []byte {
+	first := sha256.Sum256(s)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+func EncodeScriptAddress(hash []byte) string {
+	return base58.Encode(append([]byte{SCRIPT_ADDRESS_VERSION}, hash...))
+}
+
+func DecodeScriptAddress(address string) ([]byte, error) {
+	decoded := base58.Decode(address)
+	if len(decoded) != sha256.Size+1 || decoded[0] != SCRIPT_ADDRESS_VERSION {
+		return nil, fmt.Errorf("invalid script address %q", address)
+	}
+
+	return decoded[1:], nil
+}
+
+func IsScriptAddress(address string) bool {
+	_, err := DecodeScriptAddress(address)
+	return err == nil
+}
+
+// Locking script paying to an address of either form
+func NewPayToAddress(address string) (Script, error) {
+	if hash, err := DecodeScriptAddress(address); err == nil {
+		return NewPayToScriptHash(hash), nil
+	}
+
+	return NewPayToPubKeyHash(address)
+}
+
+// Returns the script hash a pay-to-script-hash script pays to
+func (s Script) PayToScriptHashTarget() ([]byte, bool) {
+	instructions, err := s.Instructions()
+	if err != nil || len(instructions) != 3 {
+		return nil, false
+	}
+
+	if instructions[0].Opcode != OP_HASH256 ||
+		len(instructions[1].Data) != sha256.Size ||
+		instructions[2].Opcode != OP_EQUAL {
+		return nil, false
+	}
+
+	return instructions[1].Data, true
+}
+
+// Returns the address hash a pay-to-pubkey-hash script pays to
+func (s Script) PayToPubKeyHashTarget() ([]byte, bool) {
+	instructions, err := s.Instructions()
+	if err != nil || len(instructions) != 5 {
+		return nil, false
+	}
+
+	if instructions[0].Opcode != OP_DUP ||
+		instructions[1].Opcode != OP_ADDRESSHASH ||
+		len(instructions[2].Data) != sha256.Size ||
+		instructions[3].Opcode != OP_EQUALVERIFY ||
+		instructions[4].Opcode != OP_CHECKSIG {
+		return nil, false
+	}
+
+	return instructions[2].Data, true
+}
+
+type Builder struct {
+	script Script
+}
+
+func NewBuilder() *Builder {
+	return &Builder{script: Script{}}
+}
+
+func (b *Builder) AddOp(opcode byte) *Builder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, OP_0)
+	case len(data) < int(OP_PUSHDATA1):
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(len(data)))
+	default:
+		var length [2]byte
+		binary.LittleEndian.PutUint16(length[:], uint16(len(data)))
+		b.script = append(b.script, OP_PUSHDATA2)
+		b.script = append(b.script, length[:]...)
+	}
+
+	b.script = append(b.script, data...)
+	return b
+}
+
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + byte(n-1))
+	}
+
+	return b.AddData(encodeNumber(n))
+}
+
+func (b *Builder) Script() Script {
+	return b.script
+}
+
+// Encoding of a public key as pushed in scripts, see common.PublicKey.Encode
+func EncodePublicKey(key *common.PublicKey) []byte {
+	return key.Encode()
+}
+
+func DecodePublicKey(data []byte) (*common.PublicKey, error) {
+	return common.DecodePublicKey(data)
+}
+
+// Default locking script of an address: the public key must hash to the
+// address and the signature must verify against it
+func NewPayToPubKeyHash(address string) (Script, error) {
+	hash, err := common.DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBuilder().
+		AddOp(OP_DUP).
+		AddOp(OP_ADDRESSHASH).
+		AddData(hash).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).
+		Script(), nil
+}
+
+func NewPayToPubKeyHashUnlock(signature []byte, key *common.PublicKey) Script {
+	return NewBuilder().
+		AddData(signature).
+		AddData(EncodePublicKey(key)).
+		Script()
+}
+
+// Spendable by revealing a script with the given hash, which is then run
+// against the rest of the unlocking stack
+func NewPayToScriptHash(hash []byte) Script {
+	return NewBuilder().
+		AddOp(OP_HASH256).
+		AddData(hash).
+		AddOp(OP_EQUAL).
+		Script()
+}
+
+func NewPayToScriptHashUnlock(redeemUnlock Script, redeemScript Script) Script {
+	unlock := append(Script{}, redeemUnlock...)
+	return append(unlock, NewBuilder().AddData(redeemScript).Script()...)
+}
+
+// Spendable by whoever reveals the preimage of the SHA-256 hash
+func NewHashLock(hash []byte) Script {
+	return NewBuilder().
+		AddOp(OP_SHA256).
+		AddData(hash).
+		AddOp(OP_EQUAL).
+		Script()
+}
+
+func NewHashLockUnlock(preimage []byte) Script {
+	return NewBuilder().AddData(preimage).Script()
+}
+
+// Spendable with signatures from m of the given public keys, given in the
+// same order as the keys
+func NewMultisig(m int, keys []*common.PublicKey) (Script, error) {
+	if m < 1 || m > len(keys) || len(keys) > 16 {
+		return nil, errors.New("invalid multisig parameters")
+	}
+
+	builder := NewBuilder().AddInt(int64(m))
+	for _, key := range keys {
+		builder.AddData(EncodePublicKey(key))
+	}
+
+	return builder.
+		AddInt(int64(len(keys))).
+		AddOp(OP_CHECKMULTISIG).
+		Script(), nil
+}
+
+func NewMultisigUnlock(signatures [][]byte) Script {
+	builder := NewBuilder()
+	for _, signature := range signatures {
+		builder.AddData(signature)
+	}
+
+	return builder.Script()
+}
+
+// Provably unspendable script carrying an arbitrary payload
+func NewDataCarrier(data []byte) (Script, error) {
+	if len(data) > common.MAX_DATA_CARRIER_SIZE {
+		return nil, fmt.Errorf("data carrier payload is limited to %d bytes", common.MAX_DATA_CARRIER_SIZE)
+	}
+
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script(), nil
+}
+
+func (s Script) IsDataCarrier() bool {
+	return len(s) > 0 && s[0] == OP_RETURN
+}
+
+// Returns the payload of a script built by NewDataCarrier
+func (s Script) DataCarrierPayload() ([]byte, error) {
+	if !s.IsDataCarrier() {
+		return nil, errors.New("not a data carrier script")
+	}
+
+	pushed, err := s[1:].PushedData()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pushed) != 1 {
+		return nil, errors.New("data carrier must push exactly one payload")
+	}
+
+	return pushed[0], nil
+}
+
+// Hash time-locked contract: the recipient can spend it revealing the
+// preimage of the secret hash, the refund address once the lock time passes
+func NewHTLC(secretHash []byte, recipientAddress string, refundAddress string, lockTime int64) (Script, error) {
+	recipientHash, err := common.DecodeAddress(recipientAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	refundHash, err := common.DecodeAddress(refundAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secretHash) != sha256.Size {
+		return nil, errors.New("secret hash must be a SHA-256 hash")
+	}
+
+	return NewBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SHA256).
+		AddData(secretHash).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).
+		AddOp(OP_ADDRESSHASH).
+		AddData(recipientHash).
+		AddOp(OP_ELSE).
+		AddInt(lockTime).
+		AddOp(OP_CHECKLOCKTIMEVERIFY).
+		AddOp(OP_DROP).
+		AddOp(OP_DUP).
+		AddOp(OP_ADDRESSHASH).
+		AddData(refundHash).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).
+		Script(), nil
+}
+
+// Returns the secret hash, recipient and refund address hashes and lock time
+// of a script built by NewHTLC
+func ParseHTLC(s Script) ([]byte, []byte, []byte, int64, error) {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	expected := []byte{OP_IF, OP_SHA256, 0, OP_EQUALVERIFY, OP_DUP, OP_ADDRESSHASH, 0, OP_ELSE, 0,
+		OP_CHECKLOCKTIMEVERIFY, OP_DROP, OP_DUP, OP_ADDRESSHASH, 0, OP_ENDIF, OP_EQUALVERIFY, OP_CHECKSIG}
+	if len(instructions) != len(expected) {
+		return nil, nil, nil, 0, errors.New("not a hash time-locked contract")
+	}
+
+	for i, opcode := range expected {
+		if opcode != 0 && instructions[i].Opcode != opcode {
+			return nil, nil, nil, 0, errors.New("not a hash time-locked contract")
+		}
+	}
+
+	secretHash := instructions[2].Data
+	recipientHash := instructions[6].Data
+	refundHash := instructions[13].Data
+	if len(secretHash) != sha256.Size || len(recipientHash) != sha256.Size || len(refundHash) != sha256.Size {
+		return nil, nil, nil, 0, errors.New("not a hash time-locked contract")
+	}
+
+	lockTime := int64(smallInt(instructions[8]))
+	if instructions[8].Data != nil {
+		if lockTime, err = decodeNumber(instructions[8].Data); err != nil {
+			return nil, nil, nil, 0, err
+		}
+	}
+	if lockTime <= 0 {
+		return nil, nil, nil, 0, errors.New("invalid contract lock time")
+	}
+
+	return secretHash, recipientHash, refundHash, lockTime, nil
+}
+
+func NewHTLCRedeemUnlock(signature []byte, key *common.PublicKey, secret []byte) Script {
+	return NewBuilder().
+		AddData(signature).
+		AddData(EncodePublicKey(key)).
+		AddData(secret).
+		AddInt(1).
+		Script()
+}
+
+func NewHTLCRefundUnlock(signature []byte, key *common.PublicKey) Script {
+	return NewBuilder().
+		AddData(signature).
+		AddData(EncodePublicKey(key)).
+		AddInt(0).
+		Script()
+}
+
+// Returns the data pushed by a push only script
+func (s Script) PushedData() ([][]byte, error) {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([][]byte, 0, len(instructions))
+	for _, in := range instructions {
+		switch {
+		case in.Data != nil:
+			data = append(data, in.Data)
+		case in.Opcode == OP_0:
+			data = append(data, []byte{})
+		case smallInt(in) > 0:
+			data = append(data, encodeNumber(int64(smallInt(in))))
+		default:
+			return nil, errors.New("script is not push only")
+		}
+	}
+
+	return data, nil
+}
+
+// Returns the number of required signatures and the encoded public keys of a
+// multisig script
+func ParseMultisig(s Script) (int, [][]byte, error) {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(instructions) < 4 || instructions[len(instructions)-1].Opcode != OP_CHECKMULTISIG {
+		return 0, nil, errors.New("not a multisig script")
+	}
+
+	m := smallInt(instructions[0])
+	n := smallInt(instructions[len(instructions)-2])
+	keys := instructions[1 : len(instructions)-2]
+	if m < 1 || n != len(keys) || m > n {
+		return 0, nil, errors.New("not a multisig script")
+	}
+
+	encodedKeys := make([][]byte, 0, n)
+	for _, key := range keys {
+		if _, err := DecodePublicKey(key.Data); err != nil {
+			return 0, nil, err
+		}
+		encodedKeys = append(encodedKeys, key.Data)
+	}
+
+	return m, encodedKeys, nil
+}
+
+func smallInt(in Instruction) int {
+	if in.Data == nil && in.Opcode >= OP_1 && in.Opcode <= OP_16 {
+		return int(in.Opcode-OP_1) + 1
+	}
+
+	return -1
+}
+
+// Wrap a locking script so it can only be spent by a transaction whose lock
+// time is at least the given height or timestamp
+func NewTimeLock(lockUntil int64, inner Script) Script {
+	script := NewBuilder().
+		AddInt(lockUntil).
+		AddOp(OP_CHECKLOCKTIMEVERIFY).
+		AddOp(OP_DROP).
+		Script()
+
+	return append(script, inner...)
+}
+
+// Returns the lock and the wrapped script of a script built by NewTimeLock
+func ParseTimeLock(s Script) (int64, Script, bool) {
+	instructions, err := s.Instructions()
+	if err != nil || len(instructions) < 3 {
+		return 0, nil, false
+	}
+
+	if instructions[1].Opcode != OP_CHECKLOCKTIMEVERIFY || instructions[2].Opcode != OP_DROP {
+		return 0, nil, false
+	}
+
+	var lockUntil int64
+	switch first := instructions[0]; {
+	case first.Data != nil:
+		if lockUntil, err = decodeNumber(first.Data); err != nil {
+			return 0, nil, false
+		}
+	case smallInt(first) > 0:
+		lockUntil = int64(smallInt(first))
+	default:
+		return 0, nil, false
+	}
+
+	// Skip the three instructions, whatever size the push took
+	prefix := NewBuilder().AddInt(lockUntil).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).Script()
+	if len(prefix) > len(s) || !bytes.Equal(s[:len(prefix)], prefix) {
+		return 0, nil, false
+	}
+
+	return lockUntil, s[len(prefix):], true
+}
@@ -0,0 +1,167 @@
+package swap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/wallet"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const SECRET_SIZE = 32
+
+// A hash time-locked contract, paid to the script address of its script
+type Contract struct {
+	Script           script.Script
+	SecretHash       []byte
+	RecipientAddress string
+	RefundAddress    string
+	LockTime         int64
+}
+
+func NewSecret() ([]byte, []byte, error) {
+	secret := make([]byte, SECRET_SIZE)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha256.Sum256(secret)
+	return secret, hash[:], nil
+}
+
+func NewContract(secretHash []byte, recipientAddress string, refundAddress string, lockTime int64) (*Contract, error) {
+	contractScript, err := script.NewHTLC(secretHash, recipientAddress, refundAddress, lockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseContract(contractScript)
+}
+
+func ParseContract(contractScript script.Script) (*Contract, error) {
+	secretHash, recipientHash, refundHash, lockTime, err := script.ParseHTLC(contractScript)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Contract{
+		Script:           contractScript,
+		SecretHash:       secretHash,
+		RecipientAddress: base58.Encode(recipientHash),
+		RefundAddress:    base58.Encode(refundHash),
+		LockTime:         lockTime,
+	}, nil
+}
+
+func (c *Contract) Address() string {
+	return c.Script.Address()
+}
+
+// Returns the index of the output paying to the contract
+func (c *Contract) FindOutput(tx *transaction.Transaction) (int, error) {
+	for i, output := range tx.Outputs {
+		if output.Address == c.Address() {
+			return i, nil
+		}
+	}
+
+	return 0, errors.New("transaction doesn't pay to the contract")
+}
+
+// Spend the contract output to the recipient revealing the secret
+func (c *Contract) NewRedeemTransaction(contractTxID string, outputIndex int, amount common.Amount, fee common.Amount, w *wallet.Wallet, secret []byte) (*transaction.Transaction, error) {
+	hash := sha256.Sum256(secret)
+	if !bytes.Equal(hash[:], c.SecretHash) {
+		return nil, errors.New("secret doesn't match the contract secret hash")
+	}
+
+	if w.Address != c.RecipientAddress {
+		return nil, errors.New("wallet is not the contract recipient")
+	}
+
+	tx, err := c.newSpendTransaction(contractTxID, outputIndex, amount, fee, c.RecipientAddress, "Swap redeem")
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signInput(w, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := script.NewHTLCRedeemUnlock(signature, &w.PublicKey, secret)
+	tx.Inputs[0].UnlockingScript = script.NewPayToScriptHashUnlock(unlock, c.Script)
+
+	return tx, nil
+}
+
+// Spend the contract output back to the refund address, only valid once the
+// contract lock time is reached
+func (c *Contract) NewRefundTransaction(contractTxID string, outputIndex int, amount common.Amount, fee common.Amount, w *wallet.Wallet) (*transaction.Transaction, error) {
+	if w.Address != c.RefundAddress {
+		return nil, errors.New("wallet is not the contract refund address")
+	}
+
+	tx, err := c.newSpendTransaction(contractTxID, outputIndex, amount, fee, c.RefundAddress, "Swap refund")
+	if err != nil {
+		return nil, err
+	}
+	tx.LockTime = uint64(c.LockTime)
+
+	signature, err := signInput(w, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := script.NewHTLCRefundUnlock(signature, &w.PublicKey)
+	tx.Inputs[0].UnlockingScript = script.NewPayToScriptHashUnlock(unlock, c.Script)
+
+	return tx, nil
+}
+
+func (c *Contract) newSpendTransaction(contractTxID string, outputIndex int, amount common.Amount, fee common.Amount, to string, message string) (*transaction.Transaction, error) {
+	if amount <= fee {
+		return nil, errors.New("contract amount doesn't cover the fee")
+	}
+
+	return transaction.NewRawTransaction(
+		[]transaction.TransactionInput{{TransactionID: contractTxID, OutputIndex: uint(outputIndex)}},
+		[]transaction.TransactionOutput{{Address: to, Amount: amount - fee}},
+		fee,
+		message,
+	)
+}
+
+// Look for the secret in a transaction redeeming the contract
+func (c *Contract) ExtractSecret(tx *transaction.Transaction) ([]byte, error) {
+	for _, input := range tx.Inputs {
+		pushed, err := input.UnlockingScript.PushedData()
+		if err != nil {
+			continue
+		}
+
+		for _, data := range pushed {
+			hash := sha256.Sum256(data)
+			if bytes.Equal(hash[:], c.SecretHash) {
+				return data, nil
+			}
+		}
+	}
+
+	return nil, errors.New("transaction doesn't reveal the secret")
+}
+
+func signInput(w *wallet.Wallet, tx *transaction.Transaction) ([]byte, error) {
+	signature, err := w.SignInput(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(signature)
+}
@@ -0,0 +1,192 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Sanity checks needing nothing but the transaction itself. They hold for
+// every valid transaction, in the mempool as much as in a block
+func (t *Transaction) CheckTransaction() error {
+	if t == nil {
+		return errors.New("transaction is nil")
+	}
+
+	if len(t.Outputs) == 0 {
+		return errors.New("transaction has no outputs")
+	}
+
+	if len(t.Message) > common.MAX_MESSAGE_LENGTH {
+		return fmt.Errorf("message is limited to %d bytes", common.MAX_MESSAGE_LENGTH)
+	}
+
+	// Their encoding can't hold these fields, so their ID wouldn't commit to
+	// them
+	if t.Version == 0 && t.usesVersionedFields() {
+		return errors.New("version 0 transactions can't use scripts, sequences, lock times or new key types")
+	}
+
+	if len(t.Inputs) == 0 {
+		if err := t.checkCoinbase(); err != nil {
+			return err
+		}
+	}
+
+	if err := t.checkInputs(); err != nil {
+		return err
+	}
+
+	for i, output := range t.Outputs {
+		if output.IsDataCarrier() {
+			continue
+		}
+
+		if output.Amount == 0 {
+			return fmt.Errorf("output %d has no value", i)
+		}
+
+		if !output.Amount.IsValid() {
+			return fmt.Errorf("output %d: %w", i, common.ErrAmountOverflow)
+		}
+	}
+
+	if err := t.checkOutputAddresses(); err != nil {
+		return err
+	}
+
+	if err := t.checkDataOutputs(); err != nil {
+		return err
+	}
+
+	totalOutputs, err := t.TotalOutputs()
+	if err != nil {
+		return err
+	}
+
+	if _, err := totalOutputs.Add(t.Fee); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// A coinbase pays a single output, at most the whole money supply, and has
+// no inputs to pay a fee from. The block it is in bounds it further to the
+// block reward and fees
+func (t *Transaction) checkCoinbase() error {
+	if len(t.Outputs) != 1 {
+		return errors.New("coinbase must have exactly one output")
+	}
+
+	if t.Fee != 0 {
+		return errors.New("coinbase can't pay a fee")
+	}
+
+	output := t.Outputs[0]
+	if output.IsDataCarrier() {
+		return errors.New("coinbase output can't be a data carrier")
+	}
+
+	if output.Amount == 0 || output.Amount > common.MAX_MONEY {
+		return fmt.Errorf("coinbase output must be between 1 and %d", common.MAX_MONEY)
+	}
+
+	return nil
+}
+
+// Every outpoint is spent once. Inputs may belong to different owners, with
+// keys of different types, the unlocking script of each one proves its own
+// ownership
+func (t *Transaction) checkInputs() error {
+	outpoints := make(map[string]bool, len(t.Inputs))
+	for i, input := range t.Inputs {
+		if input.TransactionID == "" {
+			return fmt.Errorf("input %d has no outpoint", i)
+		}
+
+		outpoint := fmt.Sprintf("%s:%d", input.TransactionID, input.OutputIndex)
+		if outpoints[outpoint] {
+			return fmt.Errorf("input %d spends %s twice", i, outpoint)
+		}
+		outpoints[outpoint] = true
+
+		if input.PublicKey.X == nil && input.PublicKey.Y == nil {
+			continue
+		}
+
+		if err := input.PublicKey.GetPublicKey().Validate(); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Outputs are credited to their address, so it must be the one of the script
+// locking them. A time lock keeps the address of the script it wraps, and
+// outputs without a script pay to a plain address
+func (t *Transaction) checkOutputAddresses() error {
+	for i, output := range t.Outputs {
+		if output.IsDataCarrier() {
+			continue
+		}
+
+		// A coinbase may burn its reward, as the genesis block of a chain
+		// created without a miner address does
+		if len(t.Inputs) == 0 && output.Address == "" && len(output.Script) == 0 {
+			continue
+		}
+
+		if len(output.Script) == 0 {
+			if _, err := common.DecodeAddress(output.Address); err != nil {
+				return fmt.Errorf("output %d: %w", i, err)
+			}
+			continue
+		}
+
+		lockingScript := output.Script
+		if _, inner, ok := script.ParseTimeLock(lockingScript); ok {
+			lockingScript = inner
+		}
+
+		if output.Address != lockingScript.Address() {
+			return fmt.Errorf("output %d is credited to %s but its script pays to %s", i, output.Address, lockingScript.Address())
+		}
+	}
+
+	return nil
+}
+
+// Data carrier outputs must be empty of value, within the size cap and at
+// most one per transaction
+func (t *Transaction) checkDataOutputs() error {
+	found := false
+	for _, output := range t.Outputs {
+		if !output.IsDataCarrier() {
+			continue
+		}
+
+		if found {
+			return errors.New("only one data carrier output is allowed")
+		}
+		found = true
+
+		if output.Amount != 0 {
+			return errors.New("data carrier output can't hold value")
+		}
+
+		data, err := output.Script.DataCarrierPayload()
+		if err != nil {
+			return err
+		}
+
+		if len(data) > common.MAX_DATA_CARRIER_SIZE {
+			return fmt.Errorf("data carrier payload is limited to %d bytes", common.MAX_DATA_CARRIER_SIZE)
+		}
+	}
+
+	return nil
+}
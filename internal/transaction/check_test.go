@@ -0,0 +1,237 @@
+package transaction
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+func testAddress(t *testing.T, seed byte) string {
+	key := testPublicKey(t, common.KEY_TYPE_P256, seed)
+	return common.GetAddressFromPublicKey(*key.GetPublicKey())
+}
+
+// The legacy test transaction, paying to well formed addresses
+func checkTestTransaction(t *testing.T) *Transaction {
+	tx := legacyTestTransaction(t)
+	tx.Outputs[0].Address = testAddress(t, 3)
+	tx.Outputs[1].Address = testAddress(t, 4)
+	return tx
+}
+
+func TestCheckTransaction(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(tx *Transaction)
+		valid  bool
+	}{
+		{"valid", func(tx *Transaction) {}, true},
+		{"no outputs", func(tx *Transaction) {
+			tx.Outputs = nil
+		}, false},
+		{"zero value output", func(tx *Transaction) {
+			tx.Outputs[1].Amount = 0
+		}, false},
+		{"output above the money supply", func(tx *Transaction) {
+			tx.Outputs[0].Amount = common.MAX_MONEY + 1
+		}, false},
+		{"outputs and fee above the money supply", func(tx *Transaction) {
+			tx.Outputs[0].Amount = common.MAX_MONEY
+			tx.Fee = 1
+		}, false},
+		{"message too long", func(tx *Transaction) {
+			tx.Message = strings.Repeat("a", common.MAX_MESSAGE_LENGTH+1)
+		}, false},
+		{"input without outpoint", func(tx *Transaction) {
+			tx.Inputs[0].TransactionID = ""
+		}, false},
+		{"same outpoint twice", func(tx *Transaction) {
+			tx.Inputs = append(tx.Inputs, tx.Inputs[0])
+		}, false},
+		{"same transaction, other output", func(tx *Transaction) {
+			input := tx.Inputs[0]
+			input.OutputIndex = 2
+			tx.Inputs = append(tx.Inputs, input)
+		}, true},
+		{"inputs signed by different keys", func(tx *Transaction) {
+			input := tx.Inputs[0]
+			input.OutputIndex = 2
+			input.PublicKey = testPublicKey(t, common.KEY_TYPE_P256, 2)
+			tx.Inputs = append(tx.Inputs, input)
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := checkTestTransaction(t)
+			test.modify(tx)
+
+			err := tx.CheckTransaction()
+			if test.valid && err != nil {
+				t.Errorf("CheckTransaction() error: %s", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("CheckTransaction() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCheckTransactionCoinbase(t *testing.T) {
+	tests := []struct {
+		name  string
+		tx    func() *Transaction
+		valid bool
+	}{
+		{"block reward", func() *Transaction {
+			return NewCoinbaseTransaction(testAddress(t, 3), common.BLOCK_REWARD, 1)
+		}, true},
+		{"whole money supply", func() *Transaction {
+			return NewCoinbaseTransaction(testAddress(t, 3), common.MAX_MONEY, 1)
+		}, true},
+		{"above the money supply", func() *Transaction {
+			return NewCoinbaseTransaction(testAddress(t, 3), common.MAX_MONEY+1, 1)
+		}, false},
+		{"no value", func() *Transaction {
+			return NewCoinbaseTransaction(testAddress(t, 3), 0, 1)
+		}, false},
+		{"fee", func() *Transaction {
+			tx := NewCoinbaseTransaction(testAddress(t, 3), common.BLOCK_REWARD, 1)
+			tx.Fee = common.MIN_FEE
+			return tx
+		}, false},
+		{"burned reward", func() *Transaction {
+			return NewCoinbaseTransaction("", common.BLOCK_REWARD, 1)
+		}, true},
+		{"invalid address", func() *Transaction {
+			return NewCoinbaseTransaction("miner", common.BLOCK_REWARD, 1)
+		}, false},
+		{"two outputs", func() *Transaction {
+			tx := NewCoinbaseTransaction(testAddress(t, 3), common.BLOCK_REWARD, 1)
+			tx.Outputs = append(tx.Outputs, TransactionOutput{Address: testAddress(t, 4), Amount: 1})
+			return tx
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.tx().CheckTransaction()
+			if test.valid && err != nil {
+				t.Errorf("CheckTransaction() error: %s", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("CheckTransaction() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCheckTransactionOutputAddresses(t *testing.T) {
+	address := testAddress(t, 3)
+	scriptHash := script.NewHashLock(make([]byte, 32)).Hash()
+
+	tests := []struct {
+		name   string
+		modify func(tx *Transaction)
+		valid  bool
+	}{
+		{"plain address", func(tx *Transaction) {}, true},
+		{"invalid plain address", func(tx *Transaction) {
+			tx.Outputs[0].Address = "alice"
+		}, false},
+		{"script address without a script", func(tx *Transaction) {
+			tx.Outputs[0].Address = script.EncodeScriptAddress(scriptHash)
+		}, false},
+		{"pay to pubkey hash", func(tx *Transaction) {
+			tx.Outputs[0].Script, _ = script.NewPayToPubKeyHash(address)
+		}, true},
+		{"pay to pubkey hash of another address", func(tx *Transaction) {
+			tx.Outputs[0].Script, _ = script.NewPayToPubKeyHash(testAddress(t, 5))
+		}, false},
+		{"pay to script hash", func(tx *Transaction) {
+			tx.Outputs[0] = NewScriptOutput(script.NewPayToScriptHash(scriptHash), tx.Outputs[0].Amount)
+		}, true},
+		{"pay to script hash credited to a plain address", func(tx *Transaction) {
+			tx.Outputs[0].Script = script.NewPayToScriptHash(scriptHash)
+		}, false},
+		{"time lock", func(tx *Transaction) {
+			tx.LockOutput(0, 100)
+		}, true},
+		{"time lock credited to another address", func(tx *Transaction) {
+			tx.LockOutput(0, 100)
+			tx.Outputs[0].Address = testAddress(t, 5)
+		}, false},
+		{"time lock credited to its own script address", func(tx *Transaction) {
+			tx.LockOutput(0, 100)
+			tx.Outputs[0].Address = tx.Outputs[0].Script.Address()
+		}, false},
+		{"time locked pay to script hash", func(tx *Transaction) {
+			tx.Outputs[0] = NewScriptOutput(script.NewPayToScriptHash(scriptHash), tx.Outputs[0].Amount)
+			tx.LockOutput(0, 100)
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := checkTestTransaction(t)
+			tx.Version = CURRENT_VERSION
+			test.modify(tx)
+
+			err := tx.CheckTransaction()
+			if test.valid && err != nil {
+				t.Errorf("CheckTransaction() error: %s", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("CheckTransaction() succeeded, want an error")
+			}
+		})
+	}
+}
+
+// Any decodable transaction passing the checks has outputs, spends each
+// outpoint once and keeps its totals within the money supply, and a coinbase
+// can't mint more than it
+func FuzzCheckTransaction(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := DeserializeTransaction(data)
+		if err != nil {
+			return
+		}
+
+		if tx.CheckTransaction() != nil {
+			return
+		}
+
+		if len(tx.Outputs) == 0 {
+			t.Fatal("accepted a transaction without outputs")
+		}
+
+		outpoints := make(map[string]bool)
+		for _, input := range tx.Inputs {
+			outpoint := fmt.Sprintf("%s:%d", input.TransactionID, input.OutputIndex)
+			if outpoints[outpoint] {
+				t.Fatalf("accepted %s spent twice", input.TransactionID)
+			}
+			outpoints[outpoint] = true
+		}
+
+		totalOutputs, err := tx.TotalOutputs()
+		if err != nil {
+			t.Fatalf("accepted outputs that overflow: %s", err)
+		}
+
+		if _, err := totalOutputs.Add(tx.Fee); err != nil {
+			t.Fatalf("accepted outputs and fee that overflow: %s", err)
+		}
+
+		if len(tx.Inputs) == 0 && (len(tx.Outputs) != 1 || tx.Fee != 0 || totalOutputs > common.MAX_MONEY) {
+			t.Fatalf("accepted a coinbase minting %d with fee %d", totalOutputs, tx.Fee)
+		}
+	})
+}
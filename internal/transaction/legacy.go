@@ -0,0 +1,98 @@
+package transaction
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Version 0 transactions were identified, signed and hashed into blocks
+// before the binary encoding existed. They keep those hashes, so chains
+// stored back then still validate
+
+type legacyJSONTransaction struct {
+	Inputs  []legacyJSONInput  `json:"inputs"`
+	Outputs []legacyJSONOutput `json:"outputs"`
+	Fee     uint64             `json:"fee"`
+	Message string             `json:"message,omitempty"`
+}
+
+type legacyJSONInput struct {
+	TransactionID string              `json:"transactionID"`
+	OutputIndex   uint                `json:"outputIndex"`
+	Signature     string              `json:"signature"`
+	PublicKey     legacyJSONPublicKey `json:"publicKey"`
+}
+
+type legacyJSONPublicKey struct {
+	X *big.Int `json:"X"`
+	Y *big.Int `json:"Y"`
+}
+
+type legacyJSONOutput struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+// ID of a version 0 transaction: the hashes of its outpoints and outputs,
+// followed by its message and fee
+func (t *Transaction) legacyHash() []byte {
+	var data []byte
+	for _, input := range t.Inputs {
+		data = append(data, input.legacyHash()...)
+	}
+	for _, output := range t.Outputs {
+		data = append(data, output.legacyHash()...)
+	}
+	data = fmt.Appendf(data, "%s%d", t.Message, uint64(t.Fee))
+
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// Version 0 inputs signed the hash of their outpoint alone
+func (t *TransactionInput) legacyHash() []byte {
+	hash := sha256.Sum256(fmt.Appendf(nil, "%s%d", t.TransactionID, t.OutputIndex))
+	return hash[:]
+}
+
+func (t *TransactionOutput) legacyHash() []byte {
+	hash := sha256.Sum256(fmt.Appendf(nil, "%s%d", t.Address, uint64(t.Amount)))
+	return hash[:]
+}
+
+// JSON of the transaction as first stored, which the hash of a version 0
+// block commits to
+func (t *Transaction) LegacyJson() string {
+	legacy := legacyJSONTransaction{
+		Inputs:  make([]legacyJSONInput, 0, len(t.Inputs)),
+		Outputs: make([]legacyJSONOutput, 0, len(t.Outputs)),
+		Fee:     uint64(t.Fee),
+		Message: t.Message,
+	}
+
+	for _, input := range t.Inputs {
+		legacy.Inputs = append(legacy.Inputs, legacyJSONInput{
+			TransactionID: input.TransactionID,
+			OutputIndex:   input.OutputIndex,
+			Signature:     input.Signature,
+			PublicKey:     legacyJSONPublicKey{X: input.PublicKey.X, Y: input.PublicKey.Y},
+		})
+	}
+
+	for _, output := range t.Outputs {
+		legacy.Outputs = append(legacy.Outputs, legacyJSONOutput{
+			Address: output.Address,
+			Amount:  uint64(output.Amount),
+		})
+	}
+
+	json, err := json.Marshal(legacy)
+	if err != nil {
+		// error
+		return ""
+	}
+
+	return fmt.Sprintf("%s\n", json)
+}
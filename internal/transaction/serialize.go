@@ -0,0 +1,323 @@
+package transaction
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/FilipeJohansson/go-coin/internal/encoding"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Serialization version 2 adds the transaction version, input sequences,
+// scripts, the lock time and compressed keys. Legacy transactions (version 0)
+// can't use any of them and keep the version 1 encoding. Their IDs don't come
+// from it, see legacyHash
+const SERIALIZATION_VERSION = 2
+const LEGACY_SERIALIZATION_VERSION = 1
+
+// Serialize returns the canonical binary encoding of the transaction,
+// including signatures and public keys
+func (t *Transaction) Serialize() []byte {
+	w := encoding.NewWriter()
+	t.encode(w, true)
+	return w.Bytes()
+}
+
+// serializeForHash leaves out signatures and public keys, so the transaction
+// ID doesn't change when the inputs are signed
+func (t *Transaction) serializeForHash() []byte {
+	w := encoding.NewWriter()
+	t.encode(w, false)
+	return w.Bytes()
+}
+
+func (t *Transaction) serializationVersion() uint8 {
+	if t.Version == 0 {
+		return LEGACY_SERIALIZATION_VERSION
+	}
+
+	return SERIALIZATION_VERSION
+}
+
+// Whether the transaction uses a field the version 1 encoding can't hold
+func (t *Transaction) usesVersionedFields() bool {
+	if t.LockTime != 0 {
+		return true
+	}
+
+	for _, input := range t.Inputs {
+		if input.Sequence != 0 || len(input.UnlockingScript) > 0 || (input.PublicKey.X != nil && input.PublicKey.Type != common.KEY_TYPE_P256) {
+			return true
+		}
+	}
+
+	for _, output := range t.Outputs {
+		if len(output.Script) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Transaction) encode(w *encoding.Writer, withWitness bool) {
+	version := t.serializationVersion()
+	w.WriteUint8(version)
+	if version == SERIALIZATION_VERSION {
+		w.WriteVarUint(uint64(t.Version))
+	}
+
+	w.WriteVarUint(uint64(len(t.Inputs)))
+	for _, input := range t.Inputs {
+		input.encodeOutpoint(w)
+		if version == SERIALIZATION_VERSION {
+			w.WriteVarUint(uint64(input.Sequence))
+		}
+		if withWitness {
+			w.WriteString(input.Signature)
+			input.PublicKey.encode(w)
+			if version == SERIALIZATION_VERSION {
+				w.WriteBytes(input.UnlockingScript)
+			}
+		}
+	}
+
+	w.WriteVarUint(uint64(len(t.Outputs)))
+	for _, output := range t.Outputs {
+		output.encode(w, version)
+	}
+
+	w.WriteUint64(uint64(t.Fee))
+	w.WriteString(t.Message)
+	if version == SERIALIZATION_VERSION {
+		w.WriteUint64(t.LockTime)
+	}
+}
+
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	r := encoding.NewReader(data)
+
+	tx, err := decodeTransaction(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Remaining() != 0 {
+		return nil, errors.New("unexpected trailing bytes")
+	}
+
+	return tx, nil
+}
+
+func decodeTransaction(r *encoding.Reader) (*Transaction, error) {
+	version, err := r.ReadUint8()
+	if err != nil {
+		return nil, err
+	}
+
+	var txVersion uint64
+	switch version {
+	case LEGACY_SERIALIZATION_VERSION:
+	case SERIALIZATION_VERSION:
+		if txVersion, err = r.ReadVarUint(); err != nil {
+			return nil, err
+		}
+
+		if txVersion == 0 || txVersion > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid transaction version %d", txVersion)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported serialization version %d", version)
+	}
+
+	inputCount, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		Version: uint32(txVersion),
+		Inputs:  make([]TransactionInput, inputCount),
+		Outputs: make([]TransactionOutput, 0),
+	}
+
+	for i := range tx.Inputs {
+		if err := tx.Inputs[i].decode(r, version); err != nil {
+			return nil, err
+		}
+	}
+
+	outputCount, err := r.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	tx.Outputs = make([]TransactionOutput, outputCount)
+	for i := range tx.Outputs {
+		if err := tx.Outputs[i].decode(r, version); err != nil {
+			return nil, err
+		}
+	}
+
+	fee, err := r.ReadUint64()
+	if err != nil {
+		return nil, err
+	}
+	tx.Fee = common.Amount(fee)
+
+	if tx.Message, err = r.ReadString(); err != nil {
+		return nil, err
+	}
+
+	if version == SERIALIZATION_VERSION {
+		if tx.LockTime, err = r.ReadUint64(); err != nil {
+			return nil, err
+		}
+	} else if tx.usesVersionedFields() {
+		return nil, errors.New("legacy transaction with a compressed public key")
+	}
+
+	return tx, nil
+}
+
+func (t *TransactionInput) encodeOutpoint(w *encoding.Writer) {
+	w.WriteString(t.TransactionID)
+	w.WriteVarUint(uint64(t.OutputIndex))
+}
+
+func (t *TransactionInput) decode(r *encoding.Reader, version uint8) error {
+	var err error
+	if t.TransactionID, err = r.ReadString(); err != nil {
+		return err
+	}
+
+	outputIndex, err := r.ReadVarUint()
+	if err != nil {
+		return err
+	}
+	t.OutputIndex = uint(outputIndex)
+
+	if version == SERIALIZATION_VERSION {
+		sequence, err := r.ReadVarUint()
+		if err != nil {
+			return err
+		}
+		if sequence > math.MaxUint32 {
+			return errors.New("sequence out of range")
+		}
+		t.Sequence = uint32(sequence)
+	}
+
+	if t.Signature, err = r.ReadString(); err != nil {
+		return err
+	}
+
+	if err := t.PublicKey.decode(r); err != nil {
+		return err
+	}
+
+	if version != SERIALIZATION_VERSION {
+		return nil
+	}
+
+	unlockingScript, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	if len(unlockingScript) > 0 {
+		t.UnlockingScript = unlockingScript
+	}
+
+	return nil
+}
+
+func (t *TransactionOutput) encode(w *encoding.Writer, version uint8) {
+	w.WriteString(t.Address)
+	w.WriteUint64(uint64(t.Amount))
+	if version == SERIALIZATION_VERSION {
+		w.WriteBytes(t.Script)
+	}
+}
+
+func (t *TransactionOutput) decode(r *encoding.Reader, version uint8) error {
+	var err error
+	if t.Address, err = r.ReadString(); err != nil {
+		return err
+	}
+
+	amount, err := r.ReadUint64()
+	if err != nil {
+		return err
+	}
+	t.Amount = common.Amount(amount)
+
+	if version != SERIALIZATION_VERSION {
+		return nil
+	}
+
+	lockingScript, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	if len(lockingScript) > 0 {
+		t.Script = lockingScript
+	}
+
+	return nil
+}
+
+// P-256 keys are written as their two coordinates, as they always were.
+// Other keys are written compressed, with an empty second field
+func (c *CustomPublicKey) encode(w *encoding.Writer) {
+	if c.X != nil && c.Type != common.KEY_TYPE_P256 {
+		w.WriteBytes(c.GetPublicKey().Encode())
+		w.WriteBytes(nil)
+		return
+	}
+
+	var x, y []byte
+	if c.X != nil {
+		x = c.X.Bytes()
+	}
+	if c.Y != nil {
+		y = c.Y.Bytes()
+	}
+
+	w.WriteBytes(x)
+	w.WriteBytes(y)
+}
+
+func (c *CustomPublicKey) decode(r *encoding.Reader) error {
+	x, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+
+	y, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+
+	if len(x) == 0 && len(y) == 0 {
+		return nil
+	}
+
+	if len(y) == 0 {
+		key, err := common.DecodePublicKey(x)
+		if err != nil {
+			return err
+		}
+
+		*c = NewCustomPublicKey(*key)
+		return nil
+	}
+
+	c.Curve = elliptic.P256()
+	c.X = new(big.Int).SetBytes(x)
+	c.Y = new(big.Int).SetBytes(y)
+
+	return nil
+}
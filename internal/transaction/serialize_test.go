@@ -0,0 +1,142 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+func testPublicKey(t *testing.T, keyType common.KeyType, seed byte) CustomPublicKey {
+	t.Helper()
+
+	privateKey, err := common.NewPrivateKey(keyType, bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCustomPublicKey(*privateKey.GetPublicKey())
+}
+
+// A version 0 transaction, written with the version 1 encoding
+func legacyTestTransaction(t *testing.T) *Transaction {
+	return &Transaction{
+		Inputs: []TransactionInput{{
+			TransactionID: "7d1a2f",
+			OutputIndex:   1,
+			Signature:     "3045",
+			PublicKey:     testPublicKey(t, common.KEY_TYPE_P256, 1),
+		}},
+		Outputs: []TransactionOutput{
+			{Address: "alice", Amount: 1500000},
+			{Address: "bob", Amount: 250},
+		},
+		Fee:     1000,
+		Message: "hi",
+	}
+}
+
+func versionedTestTransaction(t *testing.T) *Transaction {
+	return &Transaction{
+		Version: 1,
+		Inputs: []TransactionInput{{
+			TransactionID:   "7d1a2f",
+			OutputIndex:     0,
+			Sequence:        6,
+			Signature:       "ab",
+			PublicKey:       testPublicKey(t, common.KEY_TYPE_SCHNORR, 2),
+			UnlockingScript: []byte{0x51},
+		}},
+		Outputs: []TransactionOutput{
+			{Address: "carol", Amount: 42, Script: []byte{0x76, 0xa9}},
+		},
+		Fee:      1100,
+		LockTime: 500,
+	}
+}
+
+func TestTransactionSerializeVectors(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   *Transaction
+		hex  string
+		id   string
+	}{
+		{
+			name: "legacy",
+			tx:   legacyTestTransaction(t),
+			hex:  "010106376431613266010433303435206ff03b949241ce1dadd43519e6960e0a85b41a69a05c328103aa2bce1594ca16203c4f753a55bf01dc53f6c0b0c7eee78b40c6ff7d25a96e2282b989cef71c144a0205616c696365000000000016e36003626f6200000000000000fa00000000000003e8026869",
+			id:   "bef88098cefc2b2bec901bd2b99d41e636671f4891db620388ffa6d275b65afa",
+		},
+		{
+			name: "versioned",
+			tx:   versionedTestTransaction(t),
+			hex:  "02010106376431613266000602616221024d4b6cd1361032ca9bd2aeb9d900aa4d45d9ead80ac9423374c451a7254d076600015101056361726f6c000000000000002a0276a9000000000000044c0000000000000001f4",
+			id:   "fa01c5babe322a9f0355f554edad271e2209d45626cb854fcf63b787bb7659c6",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := hex.EncodeToString(test.tx.Serialize())
+			if encoded != test.hex {
+				t.Errorf("Serialize() = %s, want %s", encoded, test.hex)
+			}
+
+			if id := hex.EncodeToString(test.tx.GetHash()); id != test.id {
+				t.Errorf("GetHash() = %s, want %s", id, test.id)
+			}
+		})
+	}
+}
+
+func TestTransactionSerializeRoundTrip(t *testing.T) {
+	for _, tx := range []*Transaction{legacyTestTransaction(t), versionedTestTransaction(t)} {
+		encoded := tx.Serialize()
+
+		decoded, err := DeserializeTransaction(encoded)
+		if err != nil {
+			t.Fatalf("DeserializeTransaction() error: %s", err)
+		}
+
+		if !bytes.Equal(decoded.Serialize(), encoded) {
+			t.Errorf("round trip changed the encoding of version %d transaction", tx.Version)
+		}
+
+		if !bytes.Equal(decoded.GetHash(), tx.GetHash()) {
+			t.Errorf("round trip changed the ID of version %d transaction", tx.Version)
+		}
+	}
+}
+
+func TestDeserializeTransactionRejects(t *testing.T) {
+	valid := versionedTestTransaction(t).Serialize()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown version", append([]byte{9}, valid[1:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DeserializeTransaction(test.data); err == nil {
+				t.Error("DeserializeTransaction() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLegacyTransactionCannotUseVersionedFields(t *testing.T) {
+	tx := legacyTestTransaction(t)
+	tx.LockTime = 10
+
+	if err := tx.CheckTransaction(); err == nil {
+		t.Error("CheckTransaction() accepted a version 0 transaction with a lock time")
+	}
+}
@@ -4,41 +4,71 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/FilipeJohansson/go-coin/internal/encoding"
+	"github.com/FilipeJohansson/go-coin/internal/script"
 	"github.com/FilipeJohansson/go-coin/internal/utxo"
 	"github.com/FilipeJohansson/go-coin/pkg/common"
 )
 
 type CustomPublicKey struct {
+	Type  common.KeyType `json:"type,omitempty"`
 	Curve elliptic.Curve `json:"-"`
 	X     *big.Int       `json:"X"`
 	Y     *big.Int       `json:"Y"`
 }
 
 type TransactionInput struct {
-	TransactionID string          `json:"transactionID"`
-	OutputIndex   uint            `json:"outputIndex"`
-	Signature     string          `json:"signature"`
-	PublicKey     CustomPublicKey `json:"publicKey"`
+	TransactionID string `json:"transactionID"`
+	OutputIndex   uint   `json:"outputIndex"`
+	// Number of blocks the spent output must have been confirmed for
+	Sequence  uint32          `json:"sequence,omitempty"`
+	Signature string          `json:"signature"`
+	PublicKey CustomPublicKey `json:"publicKey"`
+	// Only set when the spent output isn't locked to a plain address,
+	// otherwise it is built from the signature and public key
+	UnlockingScript script.Script `json:"unlockingScript,omitempty"`
 }
 
 type TransactionOutput struct {
-	Address string `json:"address"` // Recipient
-	Amount  uint64 `json:"amount"`
+	Address string        `json:"address"` // Recipient
+	Amount  common.Amount `json:"amount"`
+	// Empty for outputs paying to an address, which are locked by the
+	// pay-to-pubkey-hash template
+	Script script.Script `json:"script,omitempty"`
 }
 
+// Version given to new transactions, and the highest one relayed by the
+// mempool. Version 0 marks transactions created before versioning
+const CURRENT_VERSION = 1
+const MAX_STANDARD_VERSION = 1
+
 type Transaction struct {
+	Version uint32              `json:"version,omitempty"`
 	Inputs  []TransactionInput  `json:"inputs"`
 	Outputs []TransactionOutput `json:"outputs"`
-	Fee     uint64              `json:"fee"`
+	Fee     common.Amount       `json:"fee"`
 	Message string              `json:"message,omitempty"`
+	// Block height (below common.LOCKTIME_THRESHOLD) or Unix timestamp
+	// before which the transaction can't be confirmed
+	LockTime uint64 `json:"lockTime,omitempty"`
+}
+
+// Amount paid to an address by a transaction output
+type Payment struct {
+	Address string
+	Amount  common.Amount
 }
 
-func NewTransaction(senderAddress string, recipientAddress string, amount uint64, fee uint64, utxoSet *utxo.UTXOSet, senderPublicKey ecdsa.PublicKey, msg ...string) (*Transaction, error) {
+func NewTransaction(senderAddress string, recipientAddress string, amount common.Amount, fee common.Amount, utxoSet *utxo.UTXOSet, senderPublicKey common.PublicKey, msg ...string) (*Transaction, error) {
 	if amount <= 0 {
 		return nil, errors.New("amount must be positive")
 	}
@@ -51,45 +81,327 @@ func NewTransaction(senderAddress string, recipientAddress string, amount uint64
 		return nil, errors.New("sender and recipient cannot be the same")
 	}
 
+	payments := []Payment{{Address: recipientAddress, Amount: amount}}
+	return NewBatchTransaction(senderAddress, payments, fee, utxoSet, senderPublicKey, msg...)
+}
+
+// Transaction paying every recipient at once, with a single fee and the
+// change back to the sender as the last output
+func NewBatchTransaction(senderAddress string, payments []Payment, fee common.Amount, utxoSet *utxo.UTXOSet, senderPublicKey common.PublicKey, msg ...string) (*Transaction, error) {
+	if len(payments) == 0 {
+		return nil, errors.New("at least one payment is required")
+	}
+
+	var message string
+	if len(msg) > 0 {
+		message = msg[0]
+	}
+
+	total := fee
+	for _, p := range payments {
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	spendableUTXOs, err := utxoSet.FindSpendableUTXOsForAddress(senderAddress, total)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTransactionFromUTXOs(senderAddress, spendableUTXOs, payments, fee, senderPublicKey, message)
+}
+
+// Transaction spending exactly the given sender UTXOs. Whatever they hold
+// beyond the payments and the fee goes back to the sender as change
+func NewTransactionFromUTXOs(senderAddress string, utxos []*utxo.UTXO, payments []Payment, fee common.Amount, senderPublicKey common.PublicKey, msg ...string) (*Transaction, error) {
+	owners := map[string]common.PublicKey{senderAddress: senderPublicKey}
+	return NewMultiOwnerTransaction(utxos, owners, payments, fee, senderAddress, msg...)
+}
+
+// Transaction spending exactly the given UTXOs, each one owned by the public
+// key mapped to its address. Whatever they hold beyond the payments and the
+// fee goes to the change address. With no owners the inputs are left without
+// public keys, for a signer that holds them
+func NewMultiOwnerTransaction(utxos []*utxo.UTXO, owners map[string]common.PublicKey, payments []Payment, fee common.Amount, changeAddress string, msg ...string) (*Transaction, error) {
+	if len(payments) == 0 {
+		return nil, errors.New("at least one payment is required")
+	}
+
+	if len(utxos) == 0 {
+		return nil, errors.New("at least one UTXO is required")
+	}
+
 	var message string
 	if len(msg) > 0 {
 		message = msg[0]
 	}
 
-	spendableUTXOs, err := utxoSet.FindSpendableUTXOsForAddress(senderAddress, amount+fee)
+	var total common.Amount
+	outputs := make([]TransactionOutput, 0, len(payments)+1)
+	for i, p := range payments {
+		if err := ValidatePayment(changeAddress, p); err != nil {
+			return nil, fmt.Errorf("payment %d: %w", i+1, err)
+		}
+
+		output, err := NewOutput(p.Address, p.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("payment %d: %w", i+1, err)
+		}
+
+		if total, err = total.Add(p.Amount); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+
+	lockTime, err := lockTimeForUTXOs(utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	var utxosAmount common.Amount
+	inputs := make([]TransactionInput, 0)
+	for _, u := range utxos {
+		input := TransactionInput{
+			TransactionID: u.TransactionID,
+			OutputIndex:   u.OutputIndex,
+		}
+
+		if owners != nil {
+			publicKey, ok := owners[u.Address]
+			if !ok {
+				return nil, fmt.Errorf("UTXO %s:%d does not belong to sender", u.TransactionID, u.OutputIndex)
+			}
+			input.PublicKey = NewCustomPublicKey(publicKey)
+		}
+
+		if utxosAmount, err = utxosAmount.Add(u.Amount); err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	spent, err := total.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := utxosAmount.Sub(spent)
+	if err != nil {
+		return nil, errors.New("insuficient funds")
+	}
+
+	// Change too small to be worth spending goes to the miner
+	if change >= common.DUST_THRESHOLD {
+		outputs = append(outputs, TransactionOutput{
+			Address: changeAddress,
+			Amount:  change,
+		})
+	} else if fee, err = fee.Add(change); err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		Version:  CURRENT_VERSION,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		Fee:      fee,
+		Message:  message,
+		LockTime: lockTime,
+	}, nil
+}
+
+// Check a payment before building its output: a positive amount to a well
+// formed address other than the sender
+func ValidatePayment(senderAddress string, p Payment) error {
+	if p.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+
+	if p.Amount < common.DUST_THRESHOLD {
+		return fmt.Errorf("amount below the dust threshold of %d", common.DUST_THRESHOLD)
+	}
+
+	if p.Address == "" {
+		return errors.New("recipient address cannot be empty")
+	}
+
+	if p.Address == senderAddress {
+		return errors.New("sender and recipient cannot be the same")
+	}
+
+	if _, err := script.NewPayToAddress(p.Address); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Transaction that only anchors a payload on chain, paying the fee from the
+// sender UTXOs and returning the change to the sender
+func NewDataTransaction(senderAddress string, data []byte, fee common.Amount, utxoSet *utxo.UTXOSet, senderPublicKey common.PublicKey) (*Transaction, error) {
+	if len(data) == 0 {
+		return nil, errors.New("data cannot be empty")
+	}
+
+	spendableUTXOs, err := utxoSet.FindSpendableUTXOsForAddress(senderAddress, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	lockTime, err := lockTimeForUTXOs(spendableUTXOs)
 	if err != nil {
 		return nil, err
 	}
 
-	var spendableUTXOsAmount uint64 = 0
+	var spendableUTXOsAmount common.Amount
 	inputs := make([]TransactionInput, 0)
 	for _, u := range spendableUTXOs {
+		if spendableUTXOsAmount, err = spendableUTXOsAmount.Add(u.Amount); err != nil {
+			return nil, err
+		}
+
 		inputs = append(inputs, TransactionInput{
 			TransactionID: u.TransactionID,
 			OutputIndex:   u.OutputIndex,
-			PublicKey: CustomPublicKey{
-				Curve: senderPublicKey.Curve,
-				X:     senderPublicKey.X,
-				Y:     senderPublicKey.Y,
-			},
+			PublicKey:     NewCustomPublicKey(senderPublicKey),
 		})
-		spendableUTXOsAmount += u.Amount
 	}
 
-	outputs := make([]TransactionOutput, 0)
-	outputs = append(outputs, TransactionOutput{
-		Address: recipientAddress,
-		Amount:  amount,
-	})
+	change, err := spendableUTXOsAmount.Sub(fee)
+	if err != nil {
+		return nil, errors.New("insuficient funds")
+	}
 
-	if spendableUTXOsAmount > (amount + fee) {
+	outputs := make([]TransactionOutput, 0)
+	if change >= common.DUST_THRESHOLD {
 		outputs = append(outputs, TransactionOutput{
 			Address: senderAddress,
-			Amount:  spendableUTXOsAmount - amount - fee,
+			Amount:  change,
+		})
+	} else if fee, err = fee.Add(change); err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		Version:  CURRENT_VERSION,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		Fee:      fee,
+		LockTime: lockTime,
+	}
+
+	if err := tx.AttachData(data); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Transaction merging the sender UTXOs into a single output back to the
+// sender, so later payments need fewer inputs
+func NewConsolidationTransaction(senderAddress string, utxos []*utxo.UTXO, fee common.Amount, senderPublicKey common.PublicKey) (*Transaction, error) {
+	if len(utxos) < 2 {
+		return nil, errors.New("at least two UTXOs are needed to consolidate")
+	}
+
+	lockTime, err := lockTimeForUTXOs(utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	var utxosAmount common.Amount
+	inputs := make([]TransactionInput, 0)
+	for _, u := range utxos {
+		if u.Address != senderAddress {
+			return nil, fmt.Errorf("UTXO %s:%d does not belong to sender", u.TransactionID, u.OutputIndex)
+		}
+
+		if utxosAmount, err = utxosAmount.Add(u.Amount); err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, TransactionInput{
+			TransactionID: u.TransactionID,
+			OutputIndex:   u.OutputIndex,
+			PublicKey:     NewCustomPublicKey(senderPublicKey),
 		})
 	}
 
+	minimum, err := fee.Add(common.DUST_THRESHOLD)
+	if err != nil {
+		return nil, err
+	}
+
+	if utxosAmount < minimum {
+		return nil, errors.New("UTXOs are worth less than the fee to consolidate them")
+	}
+
+	amount, err := utxosAmount.Sub(fee)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Transaction{
+		Version: CURRENT_VERSION,
+		Inputs:  inputs,
+		Outputs: []TransactionOutput{
+			{
+				Address: senderAddress,
+				Amount:  amount,
+			},
+		},
+		Fee:      fee,
+		LockTime: lockTime,
+	}, nil
+}
+
+// Several inputs merged into a single output
+func (t *Transaction) IsConsolidation() bool {
+	return len(t.Inputs) > 1 && len(t.Outputs) == 1
+}
+
+// Time locked outputs can only be spent by a transaction with a lock time at
+// least as high as theirs
+func lockTimeForUTXOs(utxos []*utxo.UTXO) (uint64, error) {
+	var lockTime uint64
+	for _, u := range utxos {
+		lockUntil := uint64(u.LockedUntil())
+		if lockUntil == 0 {
+			continue
+		}
+
+		if lockTime != 0 && (lockTime < common.LOCKTIME_THRESHOLD) != (lockUntil < common.LOCKTIME_THRESHOLD) {
+			return 0, errors.New("cannot spend height and time locked outputs together")
+		}
+
+		lockTime = max(lockTime, lockUntil)
+	}
+
+	return lockTime, nil
+}
+
+// Build an unsigned transaction spending exactly the given outpoints, for
+// signing later, possibly on another machine
+func NewRawTransaction(inputs []TransactionInput, outputs []TransactionOutput, fee common.Amount, msg ...string) (*Transaction, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("at least one input is required")
+	}
+
+	if len(outputs) == 0 {
+		return nil, errors.New("at least one output is required")
+	}
+
+	var message string
+	if len(msg) > 0 {
+		message = msg[0]
+	}
+
+	return &Transaction{
+		Version: CURRENT_VERSION,
 		Inputs:  inputs,
 		Outputs: outputs,
 		Fee:     fee,
@@ -97,31 +409,163 @@ func NewTransaction(senderAddress string, recipientAddress string, amount uint64
 	}, nil
 }
 
-func NewCoinbaseTransaction(recipientAddress string, amount uint64) *Transaction {
+// Output paying to an address of either form. Script addresses get an
+// explicit pay-to-script-hash script, plain ones keep the default template
+func NewOutput(address string, amount common.Amount) (TransactionOutput, error) {
+	if !script.IsScriptAddress(address) {
+		return TransactionOutput{Address: address, Amount: amount}, nil
+	}
+
+	lockingScript, err := script.NewPayToAddress(address)
+	if err != nil {
+		return TransactionOutput{}, err
+	}
+
+	return NewScriptOutput(lockingScript, amount), nil
+}
+
+func NewScriptOutput(lockingScript script.Script, amount common.Amount) TransactionOutput {
+	return TransactionOutput{
+		Address: lockingScript.Address(),
+		Amount:  amount,
+		Script:  lockingScript,
+	}
+}
+
+// Whether the transaction can be confirmed in a block at the given height
+// and time
+func (t *Transaction) IsFinal(height int, blockTime time.Time) bool {
+	if t.LockTime == 0 {
+		return true
+	}
+
+	if t.LockTime < common.LOCKTIME_THRESHOLD {
+		return t.LockTime <= uint64(height)
+	}
+
+	return t.LockTime <= uint64(blockTime.Unix())
+}
+
+// Wrap the locking script of an output in a time lock, keeping its address so
+// it is still credited to the recipient
+func (t *Transaction) LockOutput(index int, lockUntil int64) error {
+	if index < 0 || index >= len(t.Outputs) {
+		return errors.New("output index out of range")
+	}
+
+	if lockUntil <= 0 {
+		return errors.New("lock must be positive")
+	}
+
+	lockingScript, err := t.Outputs[index].GetLockingScript()
+	if err != nil {
+		return err
+	}
+
+	t.Outputs[index].Script = script.NewTimeLock(lockUntil, lockingScript)
+	return nil
+}
+
+// Zero value output carrying a payload. It can never be spent, so it is
+// never added to the UTXO set
+func NewDataOutput(data []byte) (TransactionOutput, error) {
+	dataScript, err := script.NewDataCarrier(data)
+	if err != nil {
+		return TransactionOutput{}, err
+	}
+
+	return TransactionOutput{Script: dataScript}, nil
+}
+
+// Attach a payload to the transaction. It has to happen before signing, as
+// signatures commit to every output
+func (t *Transaction) AttachData(data []byte) error {
+	if _, ok := t.GetData(); ok {
+		return errors.New("transaction already carries data")
+	}
+
+	output, err := NewDataOutput(data)
+	if err != nil {
+		return err
+	}
+
+	t.Outputs = append(t.Outputs, output)
+	return nil
+}
+
+// Returns the payload of the transaction data carrier output
+func (t *Transaction) GetData() ([]byte, bool) {
+	for _, output := range t.Outputs {
+		if !output.IsDataCarrier() {
+			continue
+		}
+
+		data, err := output.Script.DataCarrierPayload()
+		if err != nil {
+			return nil, false
+		}
+		return data, true
+	}
+
+	return nil, false
+}
+
+// Checked sum of the output amounts
+func (t *Transaction) TotalOutputs() (common.Amount, error) {
+	var total common.Amount
+	for _, output := range t.Outputs {
+		var err error
+		if total, err = total.Add(output.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// Lowest fee accepted for the transaction: the flat minimum plus the cost
+// of the data it carries
+func (t *Transaction) MinimumFee() common.Amount {
+	data, _ := t.GetData()
+	return common.MIN_FEE + common.Amount(len(data))*common.DATA_FEE_PER_BYTE
+}
+
+// The block height in the message keeps the ID of every coinbase unique, even
+// when the same reward goes to the same miner
+func NewCoinbaseTransaction(recipientAddress string, amount common.Amount, height int) *Transaction {
 	return &Transaction{
-		Inputs: []TransactionInput{},
+		Version: CURRENT_VERSION,
+		Inputs:  []TransactionInput{},
 		Outputs: []TransactionOutput{
 			{
 				Address: recipientAddress,
 				Amount:  amount,
 			},
 		},
-		Message: "Coinbase reward",
+		Message: fmt.Sprintf("Coinbase reward for block %d", height),
 	}
 }
 
 func (t *Transaction) GetHash() []byte {
-	var data string
-	for _, tx := range t.Inputs {
-		data = fmt.Sprintf("%s%s", data, tx.GetHash())
+	if t.Version == 0 {
+		return t.legacyHash()
 	}
-	for _, tx := range t.Outputs {
-		data = fmt.Sprintf("%s%s", data, tx.GetHash())
+
+	hasher := sha256.New()
+	hasher.Write(t.serializeForHash())
+	return hasher.Sum(nil)
+}
+
+// Hash signed by each input: it commits to the whole transaction (except
+// signatures and public keys) and to the input being signed. Version 0
+// inputs only signed their outpoint
+func (t *Transaction) GetSignatureHash(index int) []byte {
+	if t.Version == 0 {
+		return t.Inputs[index].legacyHash()
 	}
-	data = fmt.Sprintf("%s%s%d", data, t.Message, t.Fee)
 
 	hasher := sha256.New()
-	hasher.Write([]byte(data))
+	hasher.Write(t.GetHash())
+	hasher.Write(t.Inputs[index].GetHash())
 	return hasher.Sum(nil)
 }
 
@@ -147,18 +591,22 @@ func (t *Transaction) Print() string {
 	}
 
 	return fmt.Sprintf(`
+Version: %d
 Fee: %d
 Message: %s
+Lock time: %d
 Inputs:
 %s
 Outputs:
-%s`, t.Fee, t.Message, inputs, outputs)
+%s`, t.Version, t.Fee, t.Message, t.LockTime, inputs, outputs)
 }
 
 func (t *TransactionInput) GetHash() []byte {
-	data := fmt.Sprintf("%s%d", t.TransactionID, t.OutputIndex)
+	w := encoding.NewWriter()
+	t.encodeOutpoint(w)
+
 	hasher := sha256.New()
-	hasher.Write([]byte(data))
+	hasher.Write(w.Bytes())
 	return hasher.Sum(nil)
 }
 
@@ -171,19 +619,53 @@ func (t *TransactionInput) Json() string {
 	return fmt.Sprintf("%s\n", json)
 }
 
+func (t *TransactionInput) GetUnlockingScript() (script.Script, error) {
+	if len(t.UnlockingScript) > 0 {
+		return t.UnlockingScript, nil
+	}
+
+	if t.PublicKey.X == nil || t.PublicKey.Y == nil {
+		return nil, errors.New("input is not signed")
+	}
+
+	signature, err := hex.DecodeString(t.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return script.NewPayToPubKeyHashUnlock(signature, t.PublicKey.GetPublicKey()), nil
+}
+
 func (t *TransactionInput) Print() string {
-	return common.BuildBox(
+	lines := []string{
 		fmt.Sprintf("Transaction ID: %s", t.TransactionID),
 		fmt.Sprintf("Output Index:   %d", t.OutputIndex),
-		fmt.Sprintf("Public Key:     %s", common.GetAddressFromPublicKey(*t.PublicKey.GetPublicKey())),
-		fmt.Sprintf("Signature:      %s", t.Signature),
-	)
+	}
+
+	if t.Sequence > 0 {
+		lines = append(lines, fmt.Sprintf("Sequence:       %d", t.Sequence))
+	}
+
+	if t.PublicKey.X != nil && t.PublicKey.Y != nil {
+		lines = append(lines,
+			fmt.Sprintf("Public Key:     %s", common.GetAddressFromPublicKey(*t.PublicKey.GetPublicKey())),
+			fmt.Sprintf("Signature:      %s", t.Signature),
+		)
+	}
+
+	if len(t.UnlockingScript) > 0 {
+		lines = append(lines, fmt.Sprintf("Unlocking:      %s", t.UnlockingScript))
+	}
+
+	return common.BuildBox(lines...)
 }
 
 func (t *TransactionOutput) GetHash() []byte {
-	data := fmt.Sprintf("%s%d", t.Address, t.Amount)
+	w := encoding.NewWriter()
+	t.encode(w, SERIALIZATION_VERSION)
+
 	hasher := sha256.New()
-	hasher.Write([]byte(data))
+	hasher.Write(w.Bytes())
 	return hasher.Sum(nil)
 }
 
@@ -196,17 +678,124 @@ func (t *TransactionOutput) Json() string {
 	return fmt.Sprintf("%s\n", json)
 }
 
+// Whether the output is worth less than the cost of spending it. Data
+// carriers hold no value by design, so they never are
+func (t *TransactionOutput) IsDust() bool {
+	return !t.IsDataCarrier() && t.Amount < common.DUST_THRESHOLD
+}
+
+func (t *TransactionOutput) IsDataCarrier() bool {
+	return t.Script.IsDataCarrier()
+}
+
+func (t *TransactionOutput) GetLockingScript() (script.Script, error) {
+	if len(t.Script) > 0 {
+		return t.Script, nil
+	}
+
+	return script.NewPayToPubKeyHash(t.Address)
+}
+
 func (t *TransactionOutput) Print() string {
-	return common.BuildBox(
+	lines := []string{
 		fmt.Sprintf("Address: %s", t.Address),
 		fmt.Sprintf("Amount:  %d", t.Amount),
-	)
+	}
+
+	if data, err := t.Script.DataCarrierPayload(); err == nil {
+		lines = append(lines, fmt.Sprintf("Data:    %s", hex.EncodeToString(data)))
+	} else if len(t.Script) > 0 {
+		lines = append(lines, fmt.Sprintf("Script:  %s", t.Script))
+	}
+
+	return common.BuildBox(lines...)
 }
 
-func (c *CustomPublicKey) GetPublicKey() *ecdsa.PublicKey {
-	return &ecdsa.PublicKey{
-		Curve: c.Curve,
-		X:     c.X,
-		Y:     c.Y,
+// Parse an outpoint in the "txid:index" form
+func ParseOutpoint(outpoint string) (string, uint, error) {
+	parts := strings.Split(outpoint, ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", 0, fmt.Errorf("invalid outpoint %q, expected txid:index", outpoint)
 	}
+
+	index, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid outpoint index %q", parts[1])
+	}
+
+	return parts[0], uint(index), nil
+}
+
+func ParseTransactionJson(data []byte) (*Transaction, error) {
+	var tx Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+func NewCustomPublicKey(key common.PublicKey) CustomPublicKey {
+	return CustomPublicKey{
+		Type:  key.Type,
+		Curve: key.Curve,
+		X:     key.X,
+		Y:     key.Y,
+	}
+}
+
+func (c *CustomPublicKey) GetPublicKey() *common.PublicKey {
+	return &common.PublicKey{
+		Type: c.Type,
+		PublicKey: ecdsa.PublicKey{
+			Curve: c.Curve,
+			X:     c.X,
+			Y:     c.Y,
+		},
+	}
+}
+
+// Stored as the hex of its encoding, compressed for secp256k1 and Schnorr
+// keys
+func (c CustomPublicKey) MarshalJSON() ([]byte, error) {
+	if c.X == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(hex.EncodeToString(c.GetPublicKey().Encode()))
+}
+
+// Keys stored as X and Y coordinates are still read. The curve isn't
+// stored, it follows from the key type
+func (c *CustomPublicKey) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		raw, err := hex.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+
+		key, err := common.DecodePublicKey(raw)
+		if err != nil {
+			return err
+		}
+
+		*c = NewCustomPublicKey(*key)
+		return nil
+	}
+
+	type plain CustomPublicKey
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.X != nil && c.Type.IsValid() {
+		c.Curve = c.Type.Curve()
+	}
+
+	return nil
 }
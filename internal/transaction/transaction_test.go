@@ -0,0 +1,68 @@
+package transaction
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+func TestCustomPublicKeyJSON(t *testing.T) {
+	for _, keyType := range []common.KeyType{common.KEY_TYPE_P256, common.KEY_TYPE_SECP256K1, common.KEY_TYPE_SCHNORR} {
+		key := testPublicKey(t, keyType, 3)
+
+		data, err := json.Marshal(key)
+		if err != nil {
+			t.Fatalf("%s: Marshal() error: %s", keyType, err)
+		}
+
+		var decoded CustomPublicKey
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: Unmarshal() error: %s", keyType, err)
+		}
+
+		if decoded.Type != keyType || decoded.X.Cmp(key.X) != 0 || decoded.Y.Cmp(key.Y) != 0 || decoded.Curve != key.Curve {
+			t.Errorf("%s: round trip changed the key", keyType)
+		}
+	}
+}
+
+func TestCustomPublicKeyJSONReadsCoordinates(t *testing.T) {
+	key := testPublicKey(t, common.KEY_TYPE_SECP256K1, 4)
+
+	keyType, err := json.Marshal(key.Type)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"type":` + string(keyType) + `,"X":` + key.X.String() + `,"Y":` + key.Y.String() + `}`
+	var decoded CustomPublicKey
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error: %s", err)
+	}
+
+	if decoded.X.Cmp(key.X) != 0 || decoded.Y.Cmp(key.Y) != 0 || decoded.Curve != key.Curve {
+		t.Error("key stored as coordinates read wrong")
+	}
+}
+
+func TestCustomPublicKeyJSONEmpty(t *testing.T) {
+	data, err := json.Marshal(TransactionInput{TransactionID: "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"publicKey":null`) {
+		t.Errorf("Marshal() = %s, want a null public key", data)
+	}
+
+	var input TransactionInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		t.Fatalf("Unmarshal() error: %s", err)
+	}
+
+	if input.PublicKey.X != nil {
+		t.Error("empty public key read as a key")
+	}
+}
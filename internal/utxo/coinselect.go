@@ -0,0 +1,351 @@
+package utxo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Picks the UTXOs funding a payment. Every picked input adds
+// common.INPUT_FEE to the base fee, so the selection has to cover the amount
+// plus the fee of its own inputs
+type CoinSelector interface {
+	Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error)
+}
+
+type Selection struct {
+	UTXOs []*UTXO
+	// Fee of the transaction, including the inputs cost and any amount left
+	// to the miner instead of creating change
+	Fee    common.Amount
+	Change common.Amount
+}
+
+var ErrNoChangelessSolution = errors.New("no combination of UTXOs avoids change")
+
+const BNB_MAX_TRIES = 100000
+
+// Names accepted by GetCoinSelector
+var CoinSelectors = []string{"bnb", "largest-first", "smallest-first", "random-improve"}
+
+func GetCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "bnb", "branch-and-bound":
+		return &BranchAndBound{Fallback: &LargestFirst{}}, nil
+	case "largest-first":
+		return &LargestFirst{}, nil
+	case "smallest-first", "consolidate":
+		return &SmallestFirst{}, nil
+	case "random-improve":
+		return &RandomImprove{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown coin selection %q, expected one of %s", name, strings.Join(CoinSelectors, ", "))
+}
+
+func newSelection(utxos []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	fee, err := baseFee.Add(common.Amount(len(utxos)) * common.INPUT_FEE)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := sumUTXOs(utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	spent, err := amount.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := total.Sub(spent)
+	if err != nil {
+		return nil, fmt.Errorf("insuficient funds")
+	}
+
+	if change < common.DUST_THRESHOLD {
+		if fee, err = fee.Add(change); err != nil {
+			return nil, err
+		}
+		change = 0
+	}
+
+	return &Selection{
+		UTXOs:  utxos,
+		Fee:    fee,
+		Change: change,
+	}, nil
+}
+
+func sumUTXOs(utxos []*UTXO) (common.Amount, error) {
+	amounts := make([]common.Amount, len(utxos))
+	for i, u := range utxos {
+		amounts[i] = u.Amount
+	}
+	return common.SumAmounts(amounts...)
+}
+
+// Value an input adds once its own fee is paid, 0 if it costs more than it
+// brings
+func effectiveValue(u *UTXO) common.Amount {
+	if u.Amount <= common.INPUT_FEE {
+		return 0
+	}
+	return u.Amount - common.INPUT_FEE
+}
+
+// Take candidates in order until the amount and fees are covered
+func accumulate(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	target, err := amount.Add(baseFee)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*UTXO, 0)
+	var value common.Amount
+	for _, u := range candidates {
+		if effectiveValue(u) == 0 {
+			continue
+		}
+
+		selected = append(selected, u)
+		if value, err = value.Add(effectiveValue(u)); err != nil {
+			return nil, err
+		}
+		if value >= target {
+			return newSelection(selected, amount, baseFee)
+		}
+	}
+
+	return nil, fmt.Errorf("insuficient funds")
+}
+
+// Fewest inputs, keeping the fee low
+type LargestFirst struct{}
+
+func (s *LargestFirst) Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	sorted := append([]*UTXO{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Amount > sorted[j].Amount
+	})
+
+	return accumulate(sorted, amount, baseFee)
+}
+
+// Most inputs, consolidating small UTXOs into the change
+type SmallestFirst struct{}
+
+func (s *SmallestFirst) Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	sorted := append([]*UTXO{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Amount < sorted[j].Amount
+	})
+
+	return accumulate(sorted, amount, baseFee)
+}
+
+// Search for a set of inputs matching the amount close enough that the
+// excess, at most the cost of spending a change output later, can go to the
+// miner instead. Without one, the fallback selector is used if set
+type BranchAndBound struct {
+	Fallback CoinSelector
+}
+
+func (s *BranchAndBound) Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	target, err := amount.Add(baseFee)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := branchAndBound(candidates, target, common.INPUT_FEE)
+	if err != nil {
+		if s.Fallback != nil {
+			return s.Fallback.Select(candidates, amount, baseFee)
+		}
+		return nil, err
+	}
+
+	selection, err := newSelection(selected, amount, baseFee)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changeless: the excess is left to the miner
+	if selection.Fee, err = selection.Fee.Add(selection.Change); err != nil {
+		return nil, err
+	}
+	selection.Change = 0
+
+	return selection, nil
+}
+
+// Depth first search over include/exclude decisions of the candidates, by
+// decreasing effective value, keeping the match with the least excess
+func branchAndBound(candidates []*UTXO, target common.Amount, costOfChange common.Amount) ([]*UTXO, error) {
+	pool := make([]*UTXO, 0, len(candidates))
+	for _, u := range candidates {
+		if effectiveValue(u) > 0 {
+			pool = append(pool, u)
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool {
+		return effectiveValue(pool[i]) > effectiveValue(pool[j])
+	})
+
+	// Value still available from each position on
+	remaining := make([]common.Amount, len(pool)+1)
+	for i := len(pool) - 1; i >= 0; i-- {
+		var err error
+		if remaining[i], err = remaining[i+1].Add(effectiveValue(pool[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sums below stay within limit plus remaining, so they can't wrap
+	limit, err := target.Add(costOfChange)
+	if err != nil {
+		return nil, err
+	}
+
+	var best []int
+	var bestExcess common.Amount
+	current := make([]int, 0)
+	tries := 0
+
+	var search func(index int, value common.Amount)
+	search = func(index int, value common.Amount) {
+		tries++
+		if tries > BNB_MAX_TRIES {
+			return
+		}
+
+		if value > limit {
+			return
+		}
+
+		if value >= target {
+			if excess := value - target; best == nil || excess < bestExcess {
+				best = append([]int{}, current...)
+				bestExcess = excess
+			}
+			return
+		}
+
+		if index == len(pool) || value+remaining[index] < target {
+			return
+		}
+
+		current = append(current, index)
+		search(index+1, value+effectiveValue(pool[index]))
+		current = current[:len(current)-1]
+
+		// Excluding an input equal to the one just tried leads to the same
+		// sums, so skip those
+		next := index + 1
+		for next < len(pool) && effectiveValue(pool[next]) == effectiveValue(pool[index]) {
+			next++
+		}
+		search(next, value)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return nil, ErrNoChangelessSolution
+	}
+
+	selected := make([]*UTXO, len(best))
+	for i, index := range best {
+		selected[i] = pool[index]
+	}
+	return selected, nil
+}
+
+// Random selection until the amount is covered, then improved by adding
+// random inputs while it brings the change closer to the amount itself,
+// leaving change outputs of a size similar to the payments
+type RandomImprove struct {
+	Rand *rand.Rand
+}
+
+func (s *RandomImprove) Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	shuffled := append([]*UTXO{}, candidates...)
+	shuffle := rand.Shuffle
+	if s.Rand != nil {
+		shuffle = s.Rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	selection, err := accumulate(shuffled, amount, baseFee)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[*UTXO]bool)
+	for _, u := range selection.UTXOs {
+		used[u] = true
+	}
+
+	for _, u := range shuffled {
+		if used[u] || effectiveValue(u) == 0 {
+			continue
+		}
+
+		candidate, err := newSelection(append(append([]*UTXO{}, selection.UTXOs...), u), amount, baseFee)
+		if err != nil {
+			continue
+		}
+
+		// Ideal change is the amount itself, never more than twice it
+		if candidate.Change > 2*amount || distance(candidate.Change, amount) >= distance(selection.Change, amount) {
+			continue
+		}
+
+		selection = candidate
+	}
+
+	return selection, nil
+}
+
+func distance(a common.Amount, b common.Amount) common.Amount {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// Spends exactly the given outpoints, coin control by hand
+type ManualSelector struct {
+	Outpoints []string // txid:index
+}
+
+func (s *ManualSelector) Select(candidates []*UTXO, amount common.Amount, baseFee common.Amount) (*Selection, error) {
+	byOutpoint := make(map[string]*UTXO)
+	for _, u := range candidates {
+		byOutpoint[u.TransactionID+":"+strconv.Itoa(int(u.OutputIndex))] = u
+	}
+
+	selected := make([]*UTXO, 0, len(s.Outpoints))
+	seen := make(map[string]bool)
+	for _, outpoint := range s.Outpoints {
+		if seen[outpoint] {
+			return nil, fmt.Errorf("UTXO %s selected twice", outpoint)
+		}
+		seen[outpoint] = true
+
+		u, ok := byOutpoint[outpoint]
+		if !ok {
+			return nil, fmt.Errorf("UTXO %s is not spendable by this wallet", outpoint)
+		}
+		selected = append(selected, u)
+	}
+
+	return newSelection(selected, amount, baseFee)
+}
@@ -0,0 +1,290 @@
+package utxo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Candidates with the given amounts, spendable as tx<i>:0
+func testCandidates(amounts ...common.Amount) []*UTXO {
+	candidates := make([]*UTXO, len(amounts))
+	for i, amount := range amounts {
+		candidates[i] = &UTXO{
+			TransactionID: fmt.Sprintf("tx%d", i),
+			Amount:        amount,
+		}
+	}
+
+	return candidates
+}
+
+func selectedAmounts(selection *Selection) []common.Amount {
+	amounts := make([]common.Amount, len(selection.UTXOs))
+	for i, u := range selection.UTXOs {
+		amounts[i] = u.Amount
+	}
+
+	return amounts
+}
+
+type selectTest struct {
+	name     string
+	selector CoinSelector
+	amounts  []common.Amount
+	amount   common.Amount
+	baseFee  common.Amount
+	selected []common.Amount // nil when selection should fail
+	fee      common.Amount
+	change   common.Amount
+}
+
+func runSelectTests(t *testing.T, tests []selectTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selection, err := tt.selector.Select(testCandidates(tt.amounts...), tt.amount, tt.baseFee)
+			if tt.selected == nil {
+				if err == nil {
+					t.Errorf("Select() should fail, selected %v", selectedAmounts(selection))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Select() error: %s", err)
+			}
+
+			checkSelection(t, selection, tt.amount)
+
+			if got := selectedAmounts(selection); fmt.Sprint(got) != fmt.Sprint(tt.selected) {
+				t.Errorf("Select() UTXOs = %v, want %v", got, tt.selected)
+			}
+			if selection.Fee != tt.fee {
+				t.Errorf("Select() fee = %d, want %d", selection.Fee, tt.fee)
+			}
+			if selection.Change != tt.change {
+				t.Errorf("Select() change = %d, want %d", selection.Change, tt.change)
+			}
+		})
+	}
+}
+
+// Every selection spends exactly its inputs, pays the fee of each of them and
+// never creates dust change
+func checkSelection(t *testing.T, selection *Selection, amount common.Amount) {
+	t.Helper()
+
+	total, err := sumUTXOs(selection.UTXOs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != amount+selection.Fee+selection.Change {
+		t.Errorf("inputs %d don't match amount %d, fee %d and change %d", total, amount, selection.Fee, selection.Change)
+	}
+	if selection.Fee < common.Amount(len(selection.UTXOs))*common.INPUT_FEE {
+		t.Errorf("fee %d doesn't pay for %d inputs", selection.Fee, len(selection.UTXOs))
+	}
+	if selection.Change != 0 && selection.Change < common.DUST_THRESHOLD {
+		t.Errorf("change %d is dust", selection.Change)
+	}
+}
+
+func TestNewSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []common.Amount
+		amount  common.Amount
+		baseFee common.Amount
+		fee     common.Amount
+		change  common.Amount
+		fails   bool
+	}{
+		{"change", []common.Amount{10000}, 5000, 10, 110, 4890, false},
+		{"fee per input", []common.Amount{3000, 3000}, 5000, 0, 200, 800, false},
+		{"exact", []common.Amount{5100}, 5000, 0, 100, 0, false},
+		{"change at the dust threshold", []common.Amount{5400}, 5000, 0, 100, common.DUST_THRESHOLD, false},
+		{"dust change folded into the fee", []common.Amount{5399}, 5000, 0, 399, 0, false},
+		{"insufficient funds", []common.Amount{5099}, 5000, 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selection, err := newSelection(testCandidates(tt.amounts...), tt.amount, tt.baseFee)
+			if tt.fails {
+				if err == nil {
+					t.Error("newSelection() should fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("newSelection() error: %s", err)
+			}
+
+			if selection.Fee != tt.fee || selection.Change != tt.change {
+				t.Errorf("newSelection() fee %d and change %d, want %d and %d", selection.Fee, selection.Change, tt.fee, tt.change)
+			}
+		})
+	}
+}
+
+func TestBranchAndBound(t *testing.T) {
+	runSelectTests(t, []selectTest{
+		{
+			name:     "exact match",
+			selector: &BranchAndBound{},
+			amounts:  []common.Amount{10000, 3100, 2100, 1000},
+			amount:   5000,
+			selected: []common.Amount{3100, 2100},
+			fee:      200,
+		},
+		{
+			name:     "exact match with base fee",
+			selector: &BranchAndBound{},
+			amounts:  []common.Amount{10000, 3100, 2100, 1000},
+			amount:   4900,
+			baseFee:  100,
+			selected: []common.Amount{3100, 2100},
+			fee:      300,
+		},
+		{
+			name:     "excess within the cost of change goes to the fee",
+			selector: &BranchAndBound{},
+			amounts:  []common.Amount{10000, 5180},
+			amount:   5000,
+			selected: []common.Amount{5180},
+			fee:      180,
+		},
+		{
+			name:     "least excess",
+			selector: &BranchAndBound{},
+			amounts:  []common.Amount{5190, 5150, 5120},
+			amount:   5000,
+			selected: []common.Amount{5120},
+			fee:      120,
+		},
+		{
+			name:     "inputs costing more than they bring are skipped",
+			selector: &BranchAndBound{},
+			amounts:  []common.Amount{50, 5100, 100},
+			amount:   5000,
+			selected: []common.Amount{5100},
+			fee:      100,
+		},
+		{
+			name:     "fallback",
+			selector: &BranchAndBound{Fallback: &LargestFirst{}},
+			amounts:  []common.Amount{1000, 10000},
+			amount:   5000,
+			selected: []common.Amount{10000},
+			fee:      100,
+			change:   4900,
+		},
+		{
+			name:     "insufficient funds with fallback",
+			selector: &BranchAndBound{Fallback: &LargestFirst{}},
+			amounts:  []common.Amount{2000, 3000},
+			amount:   5000,
+		},
+	})
+}
+
+func TestBranchAndBoundWithoutSolution(t *testing.T) {
+	_, err := (&BranchAndBound{}).Select(testCandidates(10000), 5000, 0)
+	if !errors.Is(err, ErrNoChangelessSolution) {
+		t.Errorf("Select() error = %v, want %s", err, ErrNoChangelessSolution)
+	}
+}
+
+func TestRandomImprove(t *testing.T) {
+	runSelectTests(t, []selectTest{
+		{
+			name:     "insufficient funds",
+			selector: &RandomImprove{Rand: rand.New(rand.NewSource(1))},
+			amounts:  []common.Amount{2000, 3000},
+			amount:   5000,
+		},
+	})
+
+	// Whichever input is picked first covers the amount without change, and
+	// adding the other brings the change closer to the amount
+	for seed := int64(0); seed < 4; seed++ {
+		t.Run(fmt.Sprintf("improved with seed %d", seed), func(t *testing.T) {
+			selection, err := (&RandomImprove{Rand: rand.New(rand.NewSource(seed))}).Select(testCandidates(1200, 1100), 1000, 0)
+			if err != nil {
+				t.Fatalf("Select() error: %s", err)
+			}
+
+			checkSelection(t, selection, 1000)
+			if len(selection.UTXOs) != 2 || selection.Fee != 200 || selection.Change != 1100 {
+				t.Errorf("Select() UTXOs %v, fee %d and change %d, want both, 200 and 1100", selectedAmounts(selection), selection.Fee, selection.Change)
+			}
+		})
+	}
+
+	amounts := []common.Amount{700, 1200, 1500, 2500, 3300, 4100, 8000, 12000}
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			selection, err := (&RandomImprove{Rand: rand.New(rand.NewSource(seed))}).Select(testCandidates(amounts...), 3000, 50)
+			if err != nil {
+				t.Fatalf("Select() error: %s", err)
+			}
+
+			checkSelection(t, selection, 3000)
+
+			again, err := (&RandomImprove{Rand: rand.New(rand.NewSource(seed))}).Select(testCandidates(amounts...), 3000, 50)
+			if err != nil {
+				t.Fatalf("Select() error: %s", err)
+			}
+			if fmt.Sprint(selectedAmounts(again)) != fmt.Sprint(selectedAmounts(selection)) {
+				t.Errorf("same seed selected %v, then %v", selectedAmounts(selection), selectedAmounts(again))
+			}
+		})
+	}
+}
+
+func TestManualSelector(t *testing.T) {
+	runSelectTests(t, []selectTest{
+		{
+			name:     "given outpoints in order",
+			selector: &ManualSelector{Outpoints: []string{"tx2:0", "tx0:0"}},
+			amounts:  []common.Amount{3000, 10000, 4000},
+			amount:   5000,
+			selected: []common.Amount{4000, 3000},
+			fee:      200,
+			change:   1800,
+		},
+		{
+			name:     "dust change folded into the fee",
+			selector: &ManualSelector{Outpoints: []string{"tx1:0"}},
+			amounts:  []common.Amount{3000, 5250},
+			amount:   5000,
+			selected: []common.Amount{5250},
+			fee:      250,
+		},
+		{
+			name:     "insufficient funds",
+			selector: &ManualSelector{Outpoints: []string{"tx0:0"}},
+			amounts:  []common.Amount{3000, 10000},
+			amount:   5000,
+		},
+		{
+			name:     "selected twice",
+			selector: &ManualSelector{Outpoints: []string{"tx1:0", "tx1:0"}},
+			amounts:  []common.Amount{3000, 10000},
+			amount:   5000,
+		},
+		{
+			name:     "unknown outpoint",
+			selector: &ManualSelector{Outpoints: []string{"tx1:1"}},
+			amounts:  []common.Amount{3000, 10000},
+			amount:   5000,
+		},
+	})
+}
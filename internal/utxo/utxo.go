@@ -2,17 +2,25 @@ package utxo
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
 )
 
 type UTXO struct {
-	TransactionID string `json:"transactionID"`
-	OutputIndex   uint   `json:"outputIndex"`
-	Address       string `json:"address"`
-	Amount        uint64 `json:"amount"`
+	TransactionID string        `json:"transactionID"`
+	OutputIndex   uint          `json:"outputIndex"`
+	Address       string        `json:"address"`
+	Amount        common.Amount `json:"amount"`
+	Script        script.Script `json:"script,omitempty"`
+	Height        int           `json:"height"` // Block where the output was confirmed
 }
 
 type UTXOSet struct {
 	UTXOs []*UTXO `json:"UTXOs"`
+	// Height of the last block applied to the set
+	Height int `json:"-"`
 }
 
 func NewUTXOSet() *UTXOSet {
@@ -73,27 +81,99 @@ func (us *UTXOSet) GetUTXOsByAddress(address string) []*UTXO {
 	return utxos
 }
 
-func (us *UTXOSet) GetAddressBalance(address string) uint64 {
-	var balance uint64
+func (us *UTXOSet) GetAddressBalance(address string) (common.Amount, error) {
+	var balance common.Amount
+
+	for _, u := range us.GetUTXOsByAddress(address) {
+		var err error
+		if balance, err = balance.Add(u.Amount); err != nil {
+			return 0, err
+		}
+	}
+
+	return balance, nil
+}
+
+// Returns the spendable and the still time locked balance of the address
+func (us *UTXOSet) GetAddressBalances(address string) (common.Amount, common.Amount, error) {
+	var spendable, locked common.Amount
 
 	for _, u := range us.GetUTXOsByAddress(address) {
-		balance += u.Amount
+		var err error
+		if us.IsSpendable(u) {
+			spendable, err = spendable.Add(u.Amount)
+		} else {
+			locked, err = locked.Add(u.Amount)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return spendable, locked, nil
+}
+
+// Whether a wallet holding the key of the UTXO address can spend it in the
+// next block, which excludes outputs still time locked and outputs locked by
+// scripts other than the address itself
+func (us *UTXOSet) IsSpendable(u *UTXO) bool {
+	lockingScript := u.Script
+	lockUntil, inner, locked := script.ParseTimeLock(u.Script)
+	if locked {
+		lockingScript = inner
+	}
+
+	if len(lockingScript) > 0 {
+		if _, ok := lockingScript.PayToPubKeyHashTarget(); !ok || lockingScript.Address() != u.Address {
+			return false
+		}
+	}
+
+	if !locked {
+		return true
 	}
 
-	return balance
+	if lockUntil < common.LOCKTIME_THRESHOLD {
+		return lockUntil <= int64(us.Height+1)
+	}
+
+	return lockUntil <= time.Now().Unix()
+}
+
+// Lock of a time locked UTXO, 0 if it isn't locked
+func (u *UTXO) LockedUntil() int64 {
+	lockUntil, _, ok := script.ParseTimeLock(u.Script)
+	if !ok {
+		return 0
+	}
+
+	return lockUntil
+}
+
+func (us *UTXOSet) GetSpendableUTXOsForAddress(address string) []*UTXO {
+	utxos := make([]*UTXO, 0)
+	for _, u := range us.GetUTXOsByAddress(address) {
+		if us.IsSpendable(u) {
+			utxos = append(utxos, u)
+		}
+	}
+	return utxos
 }
 
 // Input: address + desired qty | Output: UTXO list that sum >= desired qty
-func (us *UTXOSet) FindSpendableUTXOsForAddress(address string, desiredQty uint64) ([]*UTXO, error) {
-	var currQty uint64 = 0
+func (us *UTXOSet) FindSpendableUTXOsForAddress(address string, desiredQty common.Amount) ([]*UTXO, error) {
+	var currQty common.Amount
 	utxos := make([]*UTXO, 0)
 
-	for _, u := range us.GetUTXOsByAddress(address) {
+	for _, u := range us.GetSpendableUTXOsForAddress(address) {
 		if currQty >= desiredQty {
 			break
 		}
 
-		currQty += u.Amount
+		var err error
+		if currQty, err = currQty.Add(u.Amount); err != nil {
+			return nil, err
+		}
 		utxos = append(utxos, u)
 	}
 
@@ -104,7 +184,15 @@ func (us *UTXOSet) FindSpendableUTXOsForAddress(address string, desiredQty uint6
 	return utxos, nil
 }
 
-func (us *UTXOSet) HasSufficientFunds(address string, amount uint64) bool {
+func (u *UTXO) GetLockingScript() (script.Script, error) {
+	if len(u.Script) > 0 {
+		return u.Script, nil
+	}
+
+	return script.NewPayToPubKeyHash(u.Address)
+}
+
+func (us *UTXOSet) HasSufficientFunds(address string, amount common.Amount) bool {
 	spendableUTXOs, err := us.FindSpendableUTXOsForAddress(address, amount)
 	if err != nil {
 		return false
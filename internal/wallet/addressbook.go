@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+)
+
+// A named address of someone else, so payments can be sent by name
+type Contact struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Notes   string `json:"notes,omitempty"`
+}
+
+func (d *Database) AddContact(name string, address string, notes string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("contact name cannot be empty")
+	}
+
+	// A name that is also an address would be ambiguous when paying it
+	if _, err := script.NewPayToAddress(name); err == nil {
+		return errors.New("contact name cannot be an address")
+	}
+
+	if _, err := script.NewPayToAddress(address); err != nil {
+		return err
+	}
+
+	if d.GetContact(name) != nil {
+		return fmt.Errorf("contact %q already exists", name)
+	}
+
+	d.Contacts = append(d.Contacts, &Contact{Name: name, Address: address, Notes: notes})
+	return nil
+}
+
+func (d *Database) RemoveContact(name string) error {
+	for i, c := range d.Contacts {
+		if c.Name == name {
+			d.Contacts = append(d.Contacts[:i], d.Contacts[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("contact %q not found", name)
+}
+
+func (d *Database) GetContact(name string) *Contact {
+	for _, c := range d.Contacts {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Address of a contact, or the given address itself after checking it
+func (d *Database) ResolveAddress(nameOrAddress string) (string, error) {
+	if c := d.GetContact(nameOrAddress); c != nil {
+		return c.Address, nil
+	}
+
+	if _, err := script.NewPayToAddress(nameOrAddress); err != nil {
+		return "", fmt.Errorf("%q is neither a contact nor a valid address", nameOrAddress)
+	}
+
+	return nameOrAddress, nil
+}
+
+// Label an address or a transaction ID. An empty label removes it
+func (d *Database) SetLabel(key string, label string) {
+	if label == "" {
+		delete(d.Labels, key)
+		return
+	}
+
+	d.Labels[key] = label
+}
+
+// Name to show for an address: the contact name or the label of an own
+// address, empty if it has none
+func (d *Database) AddressName(address string) string {
+	for _, c := range d.Contacts {
+		if c.Address == address {
+			return c.Name
+		}
+	}
+
+	return d.Labels[address]
+}
@@ -0,0 +1,468 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/internal/blockchain"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+type StoredKey struct {
+	PrivateKey string `json:"privateKey"`
+	Address    string `json:"address"`
+}
+
+// A UTXO the wallet received, kept after it is spent so a disconnected block
+// can give it back
+type WalletUTXO struct {
+	utxo.UTXO
+	// Paid by others, unlike the change of the wallet's own spends. Only
+	// those pay invoices
+	Received    bool   `json:"received,omitempty"`
+	SpentBy     string `json:"spentBy,omitempty"`
+	SpentHeight int    `json:"spentHeight,omitempty"`
+}
+
+func (u *WalletUTXO) IsSpent() bool {
+	return u.SpentBy != ""
+}
+
+// A confirmed transaction sending from or to the wallet
+type WalletTransaction struct {
+	TransactionID string        `json:"transactionID"`
+	BlockHeight   int           `json:"blockHeight"`
+	BlockHash     string        `json:"blockHash"`
+	Type          string        `json:"type"` // credit or debit
+	Counterparty  string        `json:"counterparty"`
+	Amount        int64         `json:"amount"`
+	Fee           common.Amount `json:"fee"`
+	Message       string        `json:"message"`
+}
+
+// A wallet kept between runs: its keys and labels, and what it learned from
+// the blocks scanned so far, updated incrementally as blocks connect and
+// disconnect
+type Database struct {
+	Keys []*StoredKey `json:"keys"`
+	// Labels of addresses and transaction IDs
+	Labels       map[string]string    `json:"labels"`
+	Contacts     []*Contact           `json:"contacts"`
+	Invoices     []*Invoice           `json:"invoices"`
+	UTXOs        []*WalletUTXO        `json:"utxos"`
+	Transactions []*WalletTransaction `json:"transactions"`
+	// Last block applied to the wallet, -1 before the first one
+	LastBlockHeight int    `json:"lastBlockHeight"`
+	LastBlockHash   string `json:"lastBlockHash"`
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		Keys:            make([]*StoredKey, 0),
+		Labels:          make(map[string]string),
+		Contacts:        make([]*Contact, 0),
+		Invoices:        make([]*Invoice, 0),
+		UTXOs:           make([]*WalletUTXO, 0),
+		Transactions:    make([]*WalletTransaction, 0),
+		LastBlockHeight: -1,
+	}
+}
+
+// Load a wallet database, or an empty one if the file doesn't exist yet
+func LoadDatabase(filename string) (*Database, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewDatabase(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewDatabase()
+	if err := json.Unmarshal(content, d); err != nil {
+		return nil, err
+	}
+
+	if d.Labels == nil {
+		d.Labels = make(map[string]string)
+	}
+
+	return d, nil
+}
+
+// Saved readable by the owner only, it holds private keys
+func (d *Database) SaveToFile(filename string) error {
+	content, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, content, 0600)
+}
+
+// Store a key. Its past transactions are only found by a rescan
+func (d *Database) AddKey(w *Wallet) error {
+	if d.IsMine(w.Address) {
+		return fmt.Errorf("address %s is already in the wallet", w.Address)
+	}
+
+	d.Keys = append(d.Keys, &StoredKey{
+		PrivateKey: common.GetPrivateKeyHash(w.PrivateKey),
+		Address:    w.Address,
+	})
+	return nil
+}
+
+// Generate and store a new key, of the same type as the first one
+func (d *Database) NewKey() (*Wallet, error) {
+	keyType := common.KEY_TYPE_P256
+	if len(d.Keys) > 0 {
+		if first, err := common.GetPrivateKeyFromHash(d.Keys[0].PrivateKey); err == nil {
+			keyType = first.Type
+		}
+	}
+
+	w := NewWallet(keyType)
+	if w == nil {
+		return nil, errors.New("failed to generate a key")
+	}
+
+	return w, d.AddKey(w)
+}
+
+func (d *Database) IsMine(address string) bool {
+	for _, k := range d.Keys {
+		if k.Address == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Database) Addresses() []string {
+	addresses := make([]string, len(d.Keys))
+	for i, k := range d.Keys {
+		addresses[i] = k.Address
+	}
+
+	return addresses
+}
+
+// Wallet of the stored key of an address
+func (d *Database) GetWallet(address string) (*Wallet, error) {
+	for _, k := range d.Keys {
+		if k.Address == address {
+			return LoadWallet(k.PrivateKey)
+		}
+	}
+
+	return nil, fmt.Errorf("address %s is not in the wallet", address)
+}
+
+// Keyring of every stored key, to spend from them. The keys it generates for
+// change are stored in the database
+func (d *Database) Keyring() (*Keyring, error) {
+	privateKeys := make([]string, len(d.Keys))
+	for i, k := range d.Keys {
+		privateKeys[i] = k.PrivateKey
+	}
+
+	keyring, err := LoadKeyring(privateKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring.StoreKeysIn(d)
+	return keyring, nil
+}
+
+// Bring the wallet up to the chain tip. Blocks no longer in the chain are
+// disconnected first, back to the last block the wallet and the chain agree
+// on. Returns how many blocks were connected and disconnected
+func (d *Database) Sync(bc *blockchain.Blockchain) (int, int, error) {
+	disconnected := 0
+	if d.LastBlockHeight >= 0 && !d.isInChain(bc, d.LastBlockHeight, d.LastBlockHash) {
+		fork := 0
+		for _, tx := range d.Transactions {
+			if !d.isInChain(bc, tx.BlockHeight, tx.BlockHash) {
+				break
+			}
+			fork = tx.BlockHeight + 1
+		}
+
+		disconnected = d.LastBlockHeight + 1 - fork
+		d.disconnectFrom(bc, fork)
+	}
+
+	connected := 0
+	for height := d.LastBlockHeight + 1; height < len(bc.Blocks); height++ {
+		if err := d.ConnectBlock(bc, height); err != nil {
+			return connected, disconnected, err
+		}
+		connected++
+	}
+
+	return connected, disconnected, nil
+}
+
+// Forget everything learned from the given height on and scan the chain
+// again, to find the past transactions of imported keys
+func (d *Database) Rescan(bc *blockchain.Blockchain, fromHeight int) (int, error) {
+	if fromHeight < 0 || fromHeight >= len(bc.Blocks) {
+		return 0, fmt.Errorf("height must be between 0 and %d", len(bc.Blocks)-1)
+	}
+
+	if fromHeight <= d.LastBlockHeight {
+		d.disconnectFrom(bc, fromHeight)
+	}
+
+	connected, _, err := d.Sync(bc)
+	return connected, err
+}
+
+func (d *Database) isInChain(bc *blockchain.Blockchain, height int, hash string) bool {
+	return height < len(bc.Blocks) && bc.Blocks[height].BlockHash == hash
+}
+
+// Apply a block: mark the wallet UTXOs it spends and record the outputs it
+// pays to the wallet
+func (d *Database) ConnectBlock(bc *blockchain.Blockchain, height int) error {
+	if height != d.LastBlockHeight+1 {
+		return fmt.Errorf("expected block %d, got %d", d.LastBlockHeight+1, height)
+	}
+
+	b := bc.Blocks[height]
+	for _, tx := range b.Transactions {
+		txID := hex.EncodeToString(tx.GetHash())
+
+		var spent, received common.Amount
+		senders := make([]string, 0)
+		for _, input := range tx.Inputs {
+			u := d.getUnspent(input.TransactionID, input.OutputIndex)
+			if u == nil {
+				if prevOutput, err := bc.GetPreviousOutput(input); err == nil {
+					senders = appendUnique(senders, prevOutput.Address)
+				}
+				continue
+			}
+
+			u.SpentBy = txID
+			u.SpentHeight = height
+
+			var err error
+			if spent, err = spent.Add(u.Amount); err != nil {
+				return err
+			}
+		}
+
+		recipients := make([]string, 0)
+		for i, output := range tx.Outputs {
+			if output.IsDataCarrier() {
+				continue
+			}
+
+			if !d.IsMine(output.Address) {
+				recipients = appendUnique(recipients, output.Address)
+				continue
+			}
+
+			d.UTXOs = append(d.UTXOs, &WalletUTXO{UTXO: utxo.UTXO{
+				TransactionID: txID,
+				OutputIndex:   uint(i),
+				Address:       output.Address,
+				Amount:        output.Amount,
+				Script:        output.Script,
+				Height:        height,
+			}, Received: spent == 0})
+
+			var err error
+			if received, err = received.Add(output.Amount); err != nil {
+				return err
+			}
+		}
+
+		if spent == 0 && received == 0 {
+			continue
+		}
+
+		entry := &WalletTransaction{
+			TransactionID: txID,
+			BlockHeight:   height,
+			BlockHash:     b.BlockHash,
+			Amount:        int64(received) - int64(spent),
+			Message:       tx.Message,
+		}
+
+		switch {
+		case spent > 0:
+			entry.Type = "debit"
+			entry.Counterparty = strings.Join(recipients, ",")
+			entry.Fee = tx.Fee
+		case len(tx.Inputs) == 0:
+			entry.Type = "credit"
+			entry.Counterparty = "Coinbase"
+		default:
+			entry.Type = "credit"
+			entry.Counterparty = strings.Join(senders, ",")
+		}
+
+		d.Transactions = append(d.Transactions, entry)
+	}
+
+	d.matchInvoices(bc, height)
+
+	d.LastBlockHeight = height
+	d.LastBlockHash = b.BlockHash
+	return nil
+}
+
+// Match the pending invoices with the received outputs that became
+// spendable at a block: the ones it confirms without a lock, and the time
+// locked ones whose lock ends with it
+func (d *Database) matchInvoices(bc *blockchain.Blockchain, height int) {
+	for _, u := range d.UTXOs {
+		if !u.Received || u.IsSpent() || !isUnlocked(bc, u, height) {
+			continue
+		}
+
+		if u.Height < height && isUnlocked(bc, u, height-1) {
+			continue
+		}
+
+		d.matchInvoice(u, bc.Blocks[u.Height].Timestamp, height)
+	}
+}
+
+// Whether a UTXO can be spent in the block after the given one
+func isUnlocked(bc *blockchain.Blockchain, u *WalletUTXO, height int) bool {
+	lockUntil := u.LockedUntil()
+	if lockUntil == 0 {
+		return true
+	}
+
+	if lockUntil < common.LOCKTIME_THRESHOLD {
+		return lockUntil <= int64(height+1)
+	}
+
+	return lockUntil <= bc.Blocks[height].Timestamp.Unix()
+}
+
+// Undo every block from the given height on
+func (d *Database) disconnectFrom(bc *blockchain.Blockchain, height int) {
+	utxos := make([]*WalletUTXO, 0, len(d.UTXOs))
+	for _, u := range d.UTXOs {
+		if u.Height >= height {
+			continue
+		}
+
+		if u.IsSpent() && u.SpentHeight >= height {
+			u.SpentBy = ""
+			u.SpentHeight = 0
+		}
+		utxos = append(utxos, u)
+	}
+	d.UTXOs = utxos
+
+	transactions := make([]*WalletTransaction, 0, len(d.Transactions))
+	for _, tx := range d.Transactions {
+		if tx.BlockHeight < height {
+			transactions = append(transactions, tx)
+		}
+	}
+	d.Transactions = transactions
+
+	for _, i := range d.Invoices {
+		if i.IsPaid() && i.PaidHeight >= height {
+			i.PaidBy = ""
+			i.PaidHeight = 0
+		}
+	}
+
+	d.LastBlockHeight = height - 1
+	d.LastBlockHash = ""
+	if height > 0 {
+		d.LastBlockHash = bc.Blocks[height-1].BlockHash
+	}
+}
+
+func (d *Database) getUnspent(transactionID string, outputIndex uint) *WalletUTXO {
+	for _, u := range d.UTXOs {
+		if !u.IsSpent() && u.TransactionID == transactionID && u.OutputIndex == outputIndex {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// Unspent outputs of the wallet, optionally of a single address
+func (d *Database) GetUnspent(address ...string) []*WalletUTXO {
+	utxos := make([]*WalletUTXO, 0)
+	for _, u := range d.UTXOs {
+		if u.IsSpent() || (len(address) > 0 && u.Address != address[0]) {
+			continue
+		}
+		utxos = append(utxos, u)
+	}
+
+	return utxos
+}
+
+// Spendable and still locked balance of the wallet, optionally of a single
+// address
+func (d *Database) GetBalances(utxoSet *utxo.UTXOSet, address ...string) (common.Amount, common.Amount, error) {
+	var spendable, locked common.Amount
+	for _, u := range d.GetUnspent(address...) {
+		var err error
+		if utxoSet.IsSpendable(&u.UTXO) {
+			spendable, err = spendable.Add(u.Amount)
+		} else {
+			locked, err = locked.Add(u.Amount)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return spendable, locked, nil
+}
+
+// Transactions of the wallet in chain order, with the running balance
+func (d *Database) GetHistory() []blockchain.HistoryEntry {
+	entries := make([]blockchain.HistoryEntry, 0, len(d.Transactions))
+
+	var balance int64
+	for _, tx := range d.Transactions {
+		entry := blockchain.HistoryEntry{
+			TransactionID: tx.TransactionID,
+			BlockHeight:   tx.BlockHeight,
+			Type:          tx.Type,
+			Counterparty:  tx.Counterparty,
+			Amount:        tx.Amount,
+			Fee:           tx.Fee,
+			Message:       tx.Message,
+		}
+		balance += entry.Amount
+		entry.Balance = balance
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+
+	return append(list, value)
+}
@@ -0,0 +1,296 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const (
+	EXTENDED_PUBLIC_PREFIX  = "xpub"
+	EXTENDED_PRIVATE_PREFIX = "xprv"
+	// Children from this index on are hardened: they can only be derived
+	// from the private key
+	HARDENED_KEY_START = 0x80000000
+	MASTER_KEY_SEED    = "go-coin seed"
+	// Type, depth, child number, chain code and the 33 byte key
+	extendedKeyLength = 1 + 1 + 4 + 32 + 33
+)
+
+// Chains of an extended key: one for the addresses handed out to be paid,
+// another for the change
+const (
+	RECEIVE_CHAIN = 0
+	CHANGE_CHAIN  = 1
+)
+
+// A BIP32 style extended key: a key plus the chain code needed to derive its
+// children. Public keys derive the public keys of the non-hardened children,
+// so a watch-only wallet can follow every address of a private key it never
+// sees
+type ExtendedKey struct {
+	KeyType     common.KeyType
+	Depth       uint8
+	ChildNumber uint32
+	ChainCode   []byte
+	privateKey  *common.PrivateKey
+	// The full point, Schnorr keys are only normalized to an even Y when
+	// used for an address, so public and private derivation agree
+	publicKey *common.PublicKey
+}
+
+// Create the root key of a tree from a random seed
+func NewMasterKey(seed []byte, keyType common.KeyType) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("seed must be between 16 and 64 bytes")
+	}
+
+	mac := hmac.New(sha512.New, []byte(MASTER_KEY_SEED))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	privateKey, err := common.NewPrivateKey(keyType, sum[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExtendedKey{
+		KeyType:    keyType,
+		ChainCode:  sum[32:],
+		privateKey: privateKey,
+		publicKey:  &common.PublicKey{Type: keyType, PublicKey: privateKey.PublicKey},
+	}, nil
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.privateKey != nil
+}
+
+// The public extended key, safe to hand to a watch-only wallet
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	public := *k
+	public.privateKey = nil
+	return &public
+}
+
+// Derive a child key. Hardened children need the private key
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.Depth == 255 {
+		return nil, errors.New("maximum derivation depth reached")
+	}
+
+	var data []byte
+	if index >= HARDENED_KEY_START {
+		if !k.IsPrivate() {
+			return nil, errors.New("cannot derive a hardened child from a public key")
+		}
+		data = append([]byte{0}, k.privateKey.D.FillBytes(make([]byte, 32))...)
+	} else {
+		data = k.compressedPublicKey()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	curve := k.KeyType.Curve()
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("invalid child %d, use the next index", index)
+	}
+
+	child := &ExtendedKey{
+		KeyType:     k.KeyType,
+		Depth:       k.Depth + 1,
+		ChildNumber: index,
+		ChainCode:   sum[32:],
+	}
+
+	if k.IsPrivate() {
+		d := new(big.Int).Add(tweak, k.privateKey.D)
+		d.Mod(d, curve.Params().N)
+
+		privateKey, err := common.NewPrivateKey(k.KeyType, d.FillBytes(make([]byte, 32)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid child %d, use the next index", index)
+		}
+		child.privateKey = privateKey
+		child.publicKey = &common.PublicKey{Type: k.KeyType, PublicKey: privateKey.PublicKey}
+		return child, nil
+	}
+
+	tx, ty := curve.ScalarBaseMult(sum[:32])
+	x, y := curve.Add(tx, ty, k.publicKey.X, k.publicKey.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child %d, use the next index", index)
+	}
+
+	child.publicKey = &common.PublicKey{Type: k.KeyType}
+	child.publicKey.Curve = curve
+	child.publicKey.X, child.publicKey.Y = x, y
+	return child, nil
+}
+
+// Derive a descendant following a path like "0/5" or "1/2'"
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Parse a path of child numbers separated by "/", a trailing "'" marking a
+// hardened child. A leading "m" is optional
+func ParseDerivationPath(path string) ([]uint32, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "m"), "/")
+	if path == "" {
+		return nil, nil
+	}
+
+	indexes := make([]uint32, 0)
+	for _, part := range strings.Split(path, "/") {
+		hardened := strings.HasSuffix(part, "'")
+		index, err := strconv.ParseUint(strings.TrimSuffix(part, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+
+		if hardened {
+			index += HARDENED_KEY_START
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+func FormatDerivationPath(chain uint32, index uint32) string {
+	return fmt.Sprintf("%d/%d", chain, index)
+}
+
+// Key the addresses are made of. Schnorr keys stand for the point with an
+// even Y
+func (k *ExtendedKey) GetPublicKey() *common.PublicKey {
+	if k.IsPrivate() {
+		return k.privateKey.GetPublicKey()
+	}
+
+	key := *k.publicKey
+	if k.KeyType == common.KEY_TYPE_SCHNORR && key.Y.Bit(0) == 1 {
+		key.Y = new(big.Int).Sub(key.Curve.Params().P, key.Y)
+	}
+
+	return &key
+}
+
+func (k *ExtendedKey) Address() string {
+	return common.GetAddressFromPublicKey(*k.GetPublicKey())
+}
+
+// Wallet of a private extended key, to sign with it
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	if !k.IsPrivate() {
+		return nil, errors.New("extended key is public")
+	}
+
+	return newWallet(k.privateKey), nil
+}
+
+func (k *ExtendedKey) compressedPublicKey() []byte {
+	return elliptic.MarshalCompressed(k.publicKey.Curve, k.publicKey.X, k.publicKey.Y)
+}
+
+// Base58 encoding with a 4 byte checksum, prefixed with xpub or xprv
+func (k *ExtendedKey) String() string {
+	prefix := EXTENDED_PUBLIC_PREFIX
+	key := k.compressedPublicKey()
+	if k.IsPrivate() {
+		prefix = EXTENDED_PRIVATE_PREFIX
+		key = append([]byte{0}, k.privateKey.D.FillBytes(make([]byte, 32))...)
+	}
+
+	data := []byte{byte(k.KeyType), k.Depth}
+	data = binary.BigEndian.AppendUint32(data, k.ChildNumber)
+	data = append(data, k.ChainCode...)
+	data = append(data, key...)
+
+	return prefix + base58.Encode(append(data, common.Checksum(data)...))
+}
+
+func ParseExtendedKey(encoded string) (*ExtendedKey, error) {
+	private := strings.HasPrefix(encoded, EXTENDED_PRIVATE_PREFIX)
+	if !private && !strings.HasPrefix(encoded, EXTENDED_PUBLIC_PREFIX) {
+		return nil, fmt.Errorf("extended key must start with %s or %s", EXTENDED_PUBLIC_PREFIX, EXTENDED_PRIVATE_PREFIX)
+	}
+
+	decoded := base58.Decode(encoded[len(EXTENDED_PUBLIC_PREFIX):])
+	if len(decoded) != extendedKeyLength+4 {
+		return nil, errors.New("invalid extended key length")
+	}
+
+	data := decoded[:extendedKeyLength]
+	if !bytes.Equal(common.Checksum(data), decoded[extendedKeyLength:]) {
+		return nil, errors.New("invalid extended key checksum")
+	}
+
+	k := &ExtendedKey{
+		KeyType:     common.KeyType(data[0]),
+		Depth:       data[1],
+		ChildNumber: binary.BigEndian.Uint32(data[2:6]),
+		ChainCode:   data[6:38],
+	}
+	if !k.KeyType.IsValid() {
+		return nil, fmt.Errorf("unknown key type %d", data[0])
+	}
+
+	key := data[38:]
+	if private {
+		if key[0] != 0 {
+			return nil, errors.New("invalid extended private key")
+		}
+
+		privateKey, err := common.NewPrivateKey(k.KeyType, key[1:])
+		if err != nil {
+			return nil, err
+		}
+		k.privateKey = privateKey
+		k.publicKey = &common.PublicKey{Type: k.KeyType, PublicKey: privateKey.PublicKey}
+		return k, nil
+	}
+
+	// Decoded as a compressed key of its curve, without the even Y rule of
+	// Schnorr keys
+	curveType := common.KEY_TYPE_SECP256K1
+	if k.KeyType == common.KEY_TYPE_P256 {
+		curveType = common.KEY_TYPE_P256
+	}
+
+	publicKey, err := common.DecodePublicKey(append([]byte{byte(curveType)}, key...))
+	if err != nil {
+		return nil, err
+	}
+	publicKey.Type = k.KeyType
+	k.publicKey = publicKey
+
+	return k, nil
+}
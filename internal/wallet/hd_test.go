@@ -0,0 +1,186 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+var testKeyTypes = []common.KeyType{common.KEY_TYPE_P256, common.KEY_TYPE_SECP256K1, common.KEY_TYPE_SCHNORR}
+
+func testMasterKey(t *testing.T, keyType common.KeyType) *ExtendedKey {
+	t.Helper()
+
+	seed := sha256.Sum256([]byte("hd wallet seed"))
+	master, err := NewMasterKey(seed[:], keyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return master
+}
+
+func testDerive(t *testing.T, key *ExtendedKey, path string) *ExtendedKey {
+	t.Helper()
+
+	child, err := key.Derive(path)
+	if err != nil {
+		t.Fatalf("Derive(%q) error: %s", path, err)
+	}
+
+	return child
+}
+
+func TestPublicDerivationMatchesPrivate(t *testing.T) {
+	for _, keyType := range testKeyTypes {
+		t.Run(keyType.String(), func(t *testing.T) {
+			master := testMasterKey(t, keyType)
+			public := master.Neuter()
+
+			oddY := 0
+			for _, chain := range []uint32{RECEIVE_CHAIN, CHANGE_CHAIN} {
+				for index := uint32(0); index < 10; index++ {
+					path := FormatDerivationPath(chain, index)
+					private := testDerive(t, master, path)
+					derived := testDerive(t, public, path)
+
+					if derived.IsPrivate() {
+						t.Fatalf("%s derived from a public key is private", path)
+					}
+					if private.Address() != derived.Address() {
+						t.Errorf("%s address %s from the private key, %s from the public key", path, private.Address(), derived.Address())
+					}
+
+					if private.publicKey.Y.Bit(0) == 1 {
+						oddY++
+					}
+				}
+			}
+
+			// Schnorr children of odd Y keep the full point to derive from,
+			// only their address uses the even one
+			if keyType == common.KEY_TYPE_SCHNORR && oddY == 0 {
+				t.Error("no child of odd Y was derived")
+			}
+		})
+	}
+}
+
+func TestPublicDerivationOfHardenedChild(t *testing.T) {
+	master := testMasterKey(t, common.KEY_TYPE_SECP256K1)
+
+	if _, err := master.Derive("0'/1"); err != nil {
+		t.Errorf("Derive() error: %s", err)
+	}
+
+	if _, err := master.Neuter().Derive("0'/1"); err == nil {
+		t.Error("Derive() of a hardened child of a public key should fail")
+	}
+}
+
+func TestExtendedKeyRoundTrip(t *testing.T) {
+	for _, keyType := range testKeyTypes {
+		child := testDerive(t, testMasterKey(t, keyType), "1'/0/7")
+
+		for _, key := range []*ExtendedKey{child, child.Neuter()} {
+			encoded := key.String()
+			t.Run(encoded[:4]+" "+keyType.String(), func(t *testing.T) {
+				parsed, err := ParseExtendedKey(encoded)
+				if err != nil {
+					t.Fatalf("ParseExtendedKey() error: %s", err)
+				}
+
+				if parsed.String() != encoded {
+					t.Errorf("ParseExtendedKey() encodes as %s, want %s", parsed.String(), encoded)
+				}
+				if parsed.IsPrivate() != key.IsPrivate() || parsed.KeyType != keyType || parsed.Depth != 3 || parsed.ChildNumber != 7 {
+					t.Errorf("ParseExtendedKey() = %s depth %d child %d, want %s depth 3 child 7", parsed.KeyType, parsed.Depth, parsed.ChildNumber, keyType)
+				}
+				if parsed.Address() != key.Address() {
+					t.Errorf("ParseExtendedKey() address %s, want %s", parsed.Address(), key.Address())
+				}
+
+				next := testDerive(t, key, "0")
+				if testDerive(t, parsed, "0").Address() != next.Address() {
+					t.Error("parsed key derives other children")
+				}
+			})
+		}
+	}
+}
+
+func TestParseExtendedKeyRejects(t *testing.T) {
+	encoded := testMasterKey(t, common.KEY_TYPE_P256).Neuter().String()
+
+	// Another base58 digit in the middle of the key
+	middle := len(encoded) / 2
+	digit := "2"
+	if encoded[middle] == '2' {
+		digit = "3"
+	}
+	tampered := encoded[:middle] + digit + encoded[middle+1:]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"bad checksum", tampered},
+		{"unknown prefix", "ypub" + encoded[4:]},
+		{"truncated", encoded[:len(encoded)-2]},
+		{"public key as private", EXTENDED_PRIVATE_PREFIX + encoded[4:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseExtendedKey(tt.encoded); err == nil {
+				t.Error("ParseExtendedKey() should fail")
+			}
+		})
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		indexes []uint32
+		fails   bool
+	}{
+		{"", nil, false},
+		{"m", nil, false},
+		{"m/0/5", []uint32{0, 5}, false},
+		{"1/2'", []uint32{1, 2 + HARDENED_KEY_START}, false},
+		{"0/x", nil, true},
+		{"0/-1", nil, true},
+		{fmt.Sprint(HARDENED_KEY_START), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			indexes, err := ParseDerivationPath(tt.path)
+			if tt.fails {
+				if err == nil {
+					t.Error("ParseDerivationPath() should fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseDerivationPath() error: %s", err)
+			}
+			if fmt.Sprint(indexes) != fmt.Sprint(tt.indexes) {
+				t.Errorf("ParseDerivationPath() = %v, want %v", indexes, tt.indexes)
+			}
+		})
+	}
+}
+
+func TestNewMasterKeySeedLength(t *testing.T) {
+	for _, length := range []int{15, 65} {
+		if _, err := NewMasterKey([]byte(strings.Repeat("s", length)), common.KEY_TYPE_P256); err == nil {
+			t.Errorf("NewMasterKey() with a %d byte seed should fail", length)
+		}
+	}
+}
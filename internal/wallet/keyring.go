@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Keys spent from as a single wallet. Payments draw on the UTXOs of all its
+// addresses at once, and the change goes to a fresh address
+type Keyring struct {
+	Wallets []*Wallet
+	// Wallet database the generated keys are stored in, if any
+	database *Database
+}
+
+func NewKeyring(wallets ...*Wallet) *Keyring {
+	return &Keyring{Wallets: wallets}
+}
+
+// Load a keyring from Base58 private keys
+func LoadKeyring(privateKeys []string) (*Keyring, error) {
+	if len(privateKeys) == 0 {
+		return nil, errors.New("at least one private key is required")
+	}
+
+	keyring := NewKeyring()
+	for i, privateKey := range privateKeys {
+		w, err := LoadWallet(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("private key %d: %w", i+1, err)
+		}
+
+		keyring.Add(w)
+	}
+
+	return keyring, nil
+}
+
+// Add a key, ignoring the ones already in the keyring
+func (k *Keyring) Add(w *Wallet) {
+	if k.GetWallet(w.Address) == nil {
+		k.Wallets = append(k.Wallets, w)
+	}
+}
+
+// Store the keys the keyring generates from now on in a wallet database
+func (k *Keyring) StoreKeysIn(d *Database) {
+	k.database = d
+}
+
+// Generate a new key, of the same type as the first one, and add it to the
+// keyring and to its wallet database
+func (k *Keyring) NewAddress() (*Wallet, error) {
+	w := NewWallet(k.keyType())
+	if w == nil {
+		return nil, errors.New("failed to generate a key")
+	}
+
+	if k.database != nil {
+		if err := k.database.AddKey(w); err != nil {
+			return nil, err
+		}
+	}
+
+	k.Add(w)
+	return w, nil
+}
+
+func (k *Keyring) keyType() common.KeyType {
+	if len(k.Wallets) == 0 {
+		return common.KEY_TYPE_P256
+	}
+
+	return k.Wallets[0].KeyType
+}
+
+func (k *Keyring) GetWallet(address string) *Wallet {
+	for _, w := range k.Wallets {
+		if w.Address == address {
+			return w
+		}
+	}
+
+	return nil
+}
+
+func (k *Keyring) Addresses() []string {
+	addresses := make([]string, len(k.Wallets))
+	for i, w := range k.Wallets {
+		addresses[i] = w.Address
+	}
+
+	return addresses
+}
+
+// Spendable UTXOs of every address in the keyring
+func (k *Keyring) GetSpendableUTXOs(utxoSet *utxo.UTXOSet) []*utxo.UTXO {
+	utxos := make([]*utxo.UTXO, 0)
+	for _, w := range k.Wallets {
+		utxos = append(utxos, utxoSet.GetSpendableUTXOsForAddress(w.Address)...)
+	}
+
+	return utxos
+}
+
+// Create a transaction paying every recipient from the UTXOs the selector
+// picks among all the keyring addresses. The change, if any, goes to a new
+// key of the keyring, so the wallet database must be saved before the
+// transaction is submitted
+func (k *Keyring) CreateTransaction(payments []transaction.Payment, fee common.Amount, utxoSet *utxo.UTXOSet, selector utxo.CoinSelector, msg ...string) (*transaction.Transaction, *utxo.Selection, error) {
+	if len(k.Wallets) == 0 {
+		return nil, nil, errors.New("keyring has no keys")
+	}
+
+	if len(payments) == 0 {
+		return nil, nil, errors.New("at least one payment is required")
+	}
+
+	if fee < common.MIN_FEE {
+		return nil, nil, errors.New("fee less than min")
+	}
+
+	var total common.Amount
+	for _, p := range payments {
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	selection, err := selector.Select(k.GetSpendableUTXOs(utxoSet), total, fee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners := make(map[string]common.PublicKey, len(k.Wallets))
+	for _, w := range k.Wallets {
+		owners[w.Address] = w.PublicKey
+	}
+
+	changeAddress := k.Wallets[0].Address
+	if selection.Change > 0 {
+		change, err := k.NewAddress()
+		if err != nil {
+			return nil, nil, err
+		}
+		changeAddress = change.Address
+	}
+
+	tx, err := transaction.NewMultiOwnerTransaction(selection.UTXOs, owners, payments, selection.Fee, changeAddress, msg...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, selection, nil
+}
+
+// Sign every input spending a UTXO of the keyring. Inputs of other owners
+// are left for them to sign
+func (k *Keyring) SignTransaction(tx *transaction.Transaction, utxoSet *utxo.UTXOSet) error {
+	if tx == nil {
+		return errors.New("transaction is nil")
+	}
+
+	signed := 0
+	for i, input := range tx.Inputs {
+		u := utxoSet.GetUTXO(input.TransactionID, input.OutputIndex)
+		if u == nil {
+			return fmt.Errorf("input %d spends an unknown UTXO", i)
+		}
+
+		w := k.GetWallet(u.Address)
+		if w == nil {
+			continue
+		}
+
+		signature, err := w.SignInput(tx, i)
+		if err != nil {
+			return err
+		}
+		tx.Inputs[i].PublicKey = w.GetCustomPublicKey()
+		tx.Inputs[i].Signature = signature
+		signed++
+	}
+
+	if signed == 0 {
+		return errors.New("no input belongs to the keyring")
+	}
+
+	return nil
+}
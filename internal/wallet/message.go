@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/FilipeJohansson/go-coin/internal/encoding"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Prefix of every signed message, so a message signature can never be
+// replayed as a transaction signature
+const MESSAGE_PREFIX = "go-coin Signed Message:\n"
+
+// Hash signed for a message: double SHA-256 of the prefix and the message,
+// each one length prefixed
+func MessageHash(message string) []byte {
+	w := encoding.NewWriter()
+	w.WriteString(MESSAGE_PREFIX)
+	w.WriteString(message)
+
+	first := sha256.Sum256(w.Bytes())
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// Sign a message proving ownership of the wallet address. The signature
+// embeds the public key, so it can be checked knowing only the address
+func (w *Wallet) SignMessage(message string) (string, error) {
+	signature, err := w.PrivateKey.SignHash(MessageHash(message))
+	if err != nil {
+		return "", err
+	}
+
+	writer := encoding.NewWriter()
+	writer.WriteBytes(w.PublicKey.Encode())
+	writer.WriteBytes(signature)
+
+	return base64.StdEncoding.EncodeToString(writer.Bytes()), nil
+}
+
+// Check a signature made by SignMessage: the embedded key must hash to the
+// address and the signature must verify against it
+func VerifyMessage(address string, message string, signature string) error {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("signature is not valid base64")
+	}
+
+	r := encoding.NewReader(decoded)
+	encodedKey, err := r.ReadBytes()
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+
+	signatureBytes, err := r.ReadBytes()
+	if err != nil || r.Remaining() != 0 {
+		return errors.New("malformed signature")
+	}
+
+	publicKey, err := common.DecodePublicKey(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	if common.GetAddressFromPublicKey(*publicKey) != address {
+		return errors.New("signature was made by another address")
+	}
+
+	if !publicKey.VerifyHash(MessageHash(message), signatureBytes) {
+		return errors.New("signature doesn't match the message")
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+const URI_SCHEME = "gocoin"
+
+// A request for payment, shared as a gocoin: URI like
+// gocoin:<address>?amount=1.5&label=Shop&message=Order%2042&exp=1767225600
+type PaymentRequest struct {
+	Address string        `json:"address"`
+	Amount  common.Amount `json:"amount,omitempty"` // 0 lets the payer choose
+	Label   string        `json:"label,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Expires time.Time     `json:"expires,omitempty"` // zero never expires
+}
+
+func (r *PaymentRequest) URI() string {
+	params := make([]string, 0)
+	if r.Amount > 0 {
+		params = append(params, "amount="+r.Amount.String())
+	}
+	if r.Label != "" {
+		params = append(params, "label="+escapeURIValue(r.Label))
+	}
+	if r.Message != "" {
+		params = append(params, "message="+escapeURIValue(r.Message))
+	}
+	if !r.Expires.IsZero() {
+		params = append(params, "exp="+strconv.FormatInt(r.Expires.Unix(), 10))
+	}
+
+	uri := URI_SCHEME + ":" + r.Address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+
+	return uri
+}
+
+// Spaces as %20 rather than +, which not every reader decodes
+func escapeURIValue(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// Parse a gocoin: URI. Unknown parameters are ignored unless prefixed with
+// req-, which marks them as required to understand the request
+func ParsePaymentURI(uri string) (*PaymentRequest, error) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok || !strings.EqualFold(scheme, URI_SCHEME) {
+		return nil, fmt.Errorf("payment URI must start with %s:", URI_SCHEME)
+	}
+
+	address, query, _ := strings.Cut(rest, "?")
+	if _, err := script.NewPayToAddress(address); err != nil {
+		return nil, err
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment URI parameters: %w", err)
+	}
+
+	r := &PaymentRequest{Address: address}
+	for key, values := range params {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("payment URI parameter %q is repeated", key)
+		}
+		value := values[0]
+
+		switch key {
+		case "amount":
+			if r.Amount, err = common.ParseAmount(value); err != nil {
+				return nil, fmt.Errorf("invalid amount: %w", err)
+			}
+		case "label":
+			r.Label = value
+		case "message":
+			r.Message = value
+		case "exp":
+			expires, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.New("invalid expiry")
+			}
+			r.Expires = time.Unix(expires, 0)
+		default:
+			if strings.HasPrefix(key, "req-") {
+				return nil, fmt.Errorf("unsupported required parameter %q", key)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func (r *PaymentRequest) IsExpired(at time.Time) bool {
+	return !r.Expires.IsZero() && at.After(r.Expires)
+}
+
+// A payment request of the wallet, paid once an output to its address of
+// at least its amount confirms before it expires and is no longer locked
+type Invoice struct {
+	ID int `json:"id"`
+	PaymentRequest
+	Created    time.Time `json:"created"`
+	PaidBy     string    `json:"paidBy,omitempty"`
+	PaidHeight int       `json:"paidHeight,omitempty"`
+}
+
+func (i *Invoice) IsPaid() bool {
+	return i.PaidBy != ""
+}
+
+func (i *Invoice) Status() string {
+	switch {
+	case i.IsPaid():
+		return "paid"
+	case i.IsExpired(time.Now()):
+		return "expired"
+	}
+
+	return "pending"
+}
+
+// Track a request for a payment to one of the wallet addresses
+func (d *Database) AddInvoice(r PaymentRequest) (*Invoice, error) {
+	if !d.IsMine(r.Address) {
+		return nil, fmt.Errorf("address %s is not in the wallet", r.Address)
+	}
+
+	invoice := &Invoice{
+		ID:             len(d.Invoices) + 1,
+		PaymentRequest: r,
+		Created:        time.Now(),
+	}
+	d.Invoices = append(d.Invoices, invoice)
+
+	return invoice, nil
+}
+
+// Mark the first pending invoice an output pays as paid. The output must be
+// locked to the invoice address and confirmed after the invoice was created,
+// before it expired
+func (d *Database) matchInvoice(u *WalletUTXO, confirmedAt time.Time, height int) {
+	for _, i := range d.Invoices {
+		if i.IsPaid() || u.Amount < i.Amount || !paysToAddress(&u.UTXO, i.Address) || i.IsExpired(confirmedAt) || confirmedAt.Before(i.Created) {
+			continue
+		}
+
+		i.PaidBy = u.TransactionID
+		i.PaidHeight = height
+		return
+	}
+}
+
+// Whether a UTXO is spent by the key of an address alone, once any time lock
+// on it ends
+func paysToAddress(u *utxo.UTXO, address string) bool {
+	lockingScript, err := u.GetLockingScript()
+	if err != nil {
+		return false
+	}
+
+	if _, inner, ok := script.ParseTimeLock(lockingScript); ok {
+		lockingScript = inner
+	}
+
+	_, ok := lockingScript.PayToPubKeyHashTarget()
+	return ok && lockingScript.Address() == address
+}
@@ -1,9 +1,6 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -14,48 +11,57 @@ import (
 )
 
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey `json:"-"`
-	PublicKey  ecdsa.PublicKey  `json:"publicKey"`
-	Address    string           `json:"address"`
+	KeyType    common.KeyType    `json:"keyType"`
+	PrivateKey common.PrivateKey `json:"-"`
+	PublicKey  common.PublicKey  `json:"publicKey"`
+	Address    string            `json:"address"`
 }
 
-func NewWallet() *Wallet {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// Create a wallet with a new key, P-256 unless another key type is given
+func NewWallet(keyType ...common.KeyType) *Wallet {
+	t := common.KEY_TYPE_P256
+	if len(keyType) > 0 {
+		t = keyType[0]
+	}
+
+	privateKey, err := common.GenerateKey(t)
 	if err != nil {
 		// err
+		return nil
 	}
 
-	publicKey := &privateKey.PublicKey
+	return newWallet(privateKey)
+}
 
+func newWallet(privateKey *common.PrivateKey) *Wallet {
 	wallet := &Wallet{
+		KeyType:    privateKey.Type,
 		PrivateKey: *privateKey,
-		PublicKey:  *publicKey,
+		PublicKey:  *privateKey.GetPublicKey(),
 	}
 	wallet.GetAddress()
 
 	return wallet
 }
 
-// Load a wallet from the Base58 private key
-func LoadWallet(hash string) *Wallet {
-	privateKey := common.GetPrivateKeyFromHash(hash)
-
-	publicKey := &privateKey.PublicKey
-
-	wallet := &Wallet{
-		PrivateKey: *privateKey,
-		PublicKey:  *publicKey,
+// Load a wallet from the private key, in WIF or the Base58 form printed by
+// the wallet
+func LoadWallet(encoded string) (*Wallet, error) {
+	privateKey, err := common.ParsePrivateKey(encoded)
+	if err != nil {
+		return nil, err
 	}
-	wallet.GetAddress()
 
-	return wallet
+	return newWallet(privateKey), nil
 }
 
-func (w *Wallet) CreateTransaction(to string, amount float64, fee float64, utxoSet *utxo.UTXOSet, msg ...string) (*transaction.Transaction, error) {
-	uAmount := uint64(amount * common.COINS_PER_UNIT)
-	uFee := uint64(fee * common.COINS_PER_UNIT)
+// Load a wallet from an already parsed private key
+func NewWalletFromKey(privateKey *common.PrivateKey) *Wallet {
+	return newWallet(privateKey)
+}
 
-	if uAmount <= 0 {
+func (w *Wallet) CreateTransaction(to string, amount common.Amount, fee common.Amount, utxoSet *utxo.UTXOSet, msg ...string) (*transaction.Transaction, error) {
+	if amount <= 0 {
 		return nil, errors.New("amount must be positive")
 	}
 
@@ -63,7 +69,7 @@ func (w *Wallet) CreateTransaction(to string, amount float64, fee float64, utxoS
 		return nil, errors.New("recipient address cannot be empty")
 	}
 
-	if uFee < common.MIN_FEE {
+	if fee < common.MIN_FEE {
 		return nil, errors.New("fee less than min")
 	}
 
@@ -72,7 +78,7 @@ func (w *Wallet) CreateTransaction(to string, amount float64, fee float64, utxoS
 		message = msg[0]
 	}
 
-	tx, err := transaction.NewTransaction(w.Address, to, uAmount, uFee, utxoSet, w.PublicKey, message)
+	tx, err := transaction.NewTransaction(w.Address, to, amount, fee, utxoSet, w.PublicKey, message)
 	if err != nil {
 		return nil, err
 	}
@@ -80,18 +86,157 @@ func (w *Wallet) CreateTransaction(to string, amount float64, fee float64, utxoS
 	return tx, nil
 }
 
-func (w *Wallet) SignTransaction(tx *transaction.Transaction) {
+// Create a transaction funded by the UTXOs the selector picks among the
+// spendable ones of the wallet. The fee grows with the inputs picked
+func (w *Wallet) CreateTransactionWithSelector(to string, amount common.Amount, fee common.Amount, utxoSet *utxo.UTXOSet, selector utxo.CoinSelector, msg ...string) (*transaction.Transaction, *utxo.Selection, error) {
+	if amount <= 0 {
+		return nil, nil, errors.New("amount must be positive")
+	}
+
+	if fee < common.MIN_FEE {
+		return nil, nil, errors.New("fee less than min")
+	}
+
+	selection, err := selector.Select(utxoSet.GetSpendableUTXOsForAddress(w.Address), amount, fee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payments := []transaction.Payment{{Address: to, Amount: amount}}
+	tx, err := transaction.NewTransactionFromUTXOs(w.Address, selection.UTXOs, payments, selection.Fee, w.PublicKey, msg...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, selection, nil
+}
+
+// Create a single transaction paying every recipient
+func (w *Wallet) CreateBatchTransaction(payments []transaction.Payment, fee common.Amount, utxoSet *utxo.UTXOSet, msg ...string) (*transaction.Transaction, error) {
+	if fee < common.MIN_FEE {
+		return nil, errors.New("fee less than min")
+	}
+
+	return transaction.NewBatchTransaction(w.Address, payments, fee, utxoSet, w.PublicKey, msg...)
+}
+
+// Create a transaction merging the given UTXOs into one. Each input adds
+// common.INPUT_FEE to the base fee
+func (w *Wallet) CreateConsolidationTransaction(utxos []*utxo.UTXO, fee common.Amount) (*transaction.Transaction, error) {
+	if fee < common.MIN_FEE {
+		return nil, errors.New("fee less than min")
+	}
+
+	totalFee, err := fee.Add(common.Amount(len(utxos)) * common.INPUT_FEE)
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction.NewConsolidationTransaction(w.Address, utxos, totalFee, w.PublicKey)
+}
+
+// Create a transaction sending everything the given UTXOs hold to a single
+// recipient, less the fee. Each input adds common.INPUT_FEE to the base fee
+func (w *Wallet) CreateSweepTransaction(to string, utxos []*utxo.UTXO, fee common.Amount, msg ...string) (*transaction.Transaction, error) {
+	if fee < common.MIN_FEE {
+		return nil, errors.New("fee less than min")
+	}
+
+	totalFee, err := fee.Add(common.Amount(len(utxos)) * common.INPUT_FEE)
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make([]common.Amount, len(utxos))
+	for i, u := range utxos {
+		amounts[i] = u.Amount
+	}
+
+	total, err := common.SumAmounts(amounts...)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := total.Sub(totalFee)
+	if err != nil || amount < common.DUST_THRESHOLD {
+		return nil, fmt.Errorf("UTXOs worth %s are not enough to pay the fee of %s", total, totalFee)
+	}
+
+	payments := []transaction.Payment{{Address: to, Amount: amount}}
+	return transaction.NewTransactionFromUTXOs(w.Address, utxos, payments, totalFee, w.PublicKey, msg...)
+}
+
+// Create a transaction anchoring data on chain. The fee must also cover the
+// data carried
+func (w *Wallet) CreateDataTransaction(data []byte, fee common.Amount, utxoSet *utxo.UTXOSet) (*transaction.Transaction, error) {
+	minFee := common.MIN_FEE + common.Amount(len(data))*common.DATA_FEE_PER_BYTE
+	if fee < minFee {
+		return nil, fmt.Errorf("fee less than min of %s for %d bytes of data", minFee, len(data))
+	}
+
+	return transaction.NewDataTransaction(w.Address, data, fee, utxoSet, w.PublicKey)
+}
+
+// Sign every input of the wallet: the ones with its public key and, when a
+// UTXO set is given, the ones without a key spending its UTXOs. Inputs of
+// other owners are left for them to sign
+func (w *Wallet) SignTransaction(tx *transaction.Transaction, utxoSet ...*utxo.UTXOSet) error {
 	if tx == nil {
-		return
+		return errors.New("transaction is nil")
 	}
 
-	for i := range tx.Inputs {
-		signatureBytes, err := ecdsa.SignASN1(rand.Reader, &w.PrivateKey, tx.Inputs[i].GetHash())
+	signed := 0
+	for i, input := range tx.Inputs {
+		if !w.ownsInput(input, utxoSet...) {
+			continue
+		}
+
+		signature, err := w.SignInput(tx, i)
 		if err != nil {
-			// err
+			return fmt.Errorf("input %d: %w", i, err)
 		}
-		tx.Inputs[i].Signature = hex.EncodeToString(signatureBytes)
+		tx.Inputs[i].PublicKey = w.GetCustomPublicKey()
+		tx.Inputs[i].Signature = signature
+		signed++
+	}
+
+	if signed == 0 {
+		return errors.New("no input belongs to the wallet")
+	}
+
+	return nil
+}
+
+func (w *Wallet) ownsInput(input transaction.TransactionInput, utxoSet ...*utxo.UTXOSet) bool {
+	if input.PublicKey.X != nil {
+		return common.GetAddressFromPublicKey(*input.PublicKey.GetPublicKey()) == w.Address
+	}
+
+	if len(utxoSet) == 0 || utxoSet[0] == nil {
+		return false
 	}
+
+	u := utxoSet[0].GetUTXO(input.TransactionID, input.OutputIndex)
+	return u != nil && u.Address == w.Address
+}
+
+// Sign a single input without touching the transaction, returning the hex
+// encoded signature
+func (w *Wallet) SignInput(tx *transaction.Transaction, index int) (string, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return "", errors.New("input index out of range")
+	}
+
+	signatureBytes, err := w.PrivateKey.SignHash(tx.GetSignatureHash(index))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(signatureBytes), nil
+}
+
+func (w *Wallet) GetCustomPublicKey() transaction.CustomPublicKey {
+	return transaction.NewCustomPublicKey(w.PublicKey)
 }
 
 func (w *Wallet) GetAddress() string {
@@ -101,6 +246,7 @@ func (w *Wallet) GetAddress() string {
 
 func (w *Wallet) Print() string {
 	content := common.BuildBox(
+		fmt.Sprintf("Key type: %s", w.KeyType),
 		fmt.Sprintf("Public key: %s", common.GetPublicKeyHash(w.PublicKey)),
 		fmt.Sprintf("Private key: %s", common.GetPrivateKeyHash(w.PrivateKey)),
 		fmt.Sprintf("Address: %s", w.Address),
@@ -114,26 +260,24 @@ func ValidateTransactionSignature(tx transaction.Transaction) bool {
 		return true // Coinbase transaction
 	}
 
-	for _, i := range tx.Inputs {
-		if i.Signature == "" {
+	for index, i := range tx.Inputs {
+		if !ValidateInputSignature(tx, index, i.PublicKey, i.Signature) {
 			return false
 		}
+	}
 
-		signature, err := hex.DecodeString(i.Signature)
-		if err != nil {
-			// err
-			return false
-		}
+	return true
+}
 
-		publicKey := ecdsa.PublicKey{
-			Curve: i.PublicKey.Curve,
-			X:     i.PublicKey.X,
-			Y:     i.PublicKey.Y,
-		}
-		if !ecdsa.VerifyASN1(&publicKey, i.GetHash(), signature) {
-			return false
-		}
+func ValidateInputSignature(tx transaction.Transaction, index int, publicKey transaction.CustomPublicKey, signature string) bool {
+	if signature == "" || publicKey.X == nil || publicKey.Y == nil {
+		return false
 	}
 
-	return true
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	return publicKey.GetPublicKey().VerifyHash(tx.GetSignatureHash(index), signatureBytes)
 }
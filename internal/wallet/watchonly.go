@@ -0,0 +1,275 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/FilipeJohansson/go-coin/internal/script"
+	"github.com/FilipeJohansson/go-coin/internal/transaction"
+	"github.com/FilipeJohansson/go-coin/internal/utxo"
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+// Unused addresses derived past the last used one on each chain. Payments to
+// addresses further away won't be found
+const DEFAULT_GAP_LIMIT = 20
+
+type DerivedAddress struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// An extended public key and the addresses derived from it so far
+type WatchedKey struct {
+	ExtendedKey string           `json:"extendedKey"`
+	GapLimit    int              `json:"gapLimit"`
+	Addresses   []DerivedAddress `json:"addresses"`
+	// First index of each chain after the last used address
+	NextIndex [2]uint32 `json:"nextIndex"`
+}
+
+// A wallet following addresses it can't spend from. It tracks balances and
+// history and builds unsigned transactions for an offline signer, without
+// ever holding a private key
+type WatchOnlyWallet struct {
+	Addresses []string      `json:"addresses"`
+	Keys      []*WatchedKey `json:"keys"`
+}
+
+func NewWatchOnlyWallet() *WatchOnlyWallet {
+	return &WatchOnlyWallet{
+		Addresses: make([]string, 0),
+		Keys:      make([]*WatchedKey, 0),
+	}
+}
+
+// Load a watch-only wallet, or an empty one if the file doesn't exist yet
+func LoadWatchOnlyWallet(filename string) (*WatchOnlyWallet, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewWatchOnlyWallet(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w := NewWatchOnlyWallet()
+	if err := json.Unmarshal(content, w); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *WatchOnlyWallet) SaveToFile(filename string) error {
+	content, err := json.MarshalIndent(w, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, content, 0644)
+}
+
+func (w *WatchOnlyWallet) ImportAddress(address string) error {
+	if _, err := script.NewPayToAddress(address); err != nil {
+		return err
+	}
+
+	if w.HasAddress(address) {
+		return fmt.Errorf("address %s is already watched", address)
+	}
+
+	w.Addresses = append(w.Addresses, address)
+	return nil
+}
+
+// Watch every address of an extended public key. Its addresses are derived
+// by Scan
+func (w *WatchOnlyWallet) ImportExtendedKey(encoded string, gapLimit int) error {
+	key, err := ParseExtendedKey(encoded)
+	if err != nil {
+		return err
+	}
+
+	if key.IsPrivate() {
+		return errors.New("watch-only wallets never hold private keys, import the extended public key")
+	}
+
+	if gapLimit < 1 {
+		return errors.New("gap limit must be at least 1")
+	}
+
+	for _, k := range w.Keys {
+		if k.ExtendedKey == encoded {
+			return errors.New("extended key is already watched")
+		}
+	}
+
+	w.Keys = append(w.Keys, &WatchedKey{
+		ExtendedKey: encoded,
+		GapLimit:    gapLimit,
+		Addresses:   make([]DerivedAddress, 0),
+	})
+	return nil
+}
+
+// Derive the addresses of every extended key until each chain ends with gap
+// limit unused ones, returning how many new addresses were found
+func (w *WatchOnlyWallet) Scan(used func(address string) bool) (int, error) {
+	found := 0
+	for _, k := range w.Keys {
+		key, err := ParseExtendedKey(k.ExtendedKey)
+		if err != nil {
+			return found, err
+		}
+
+		for _, chain := range []uint32{RECEIVE_CHAIN, CHANGE_CHAIN} {
+			chainKey, err := key.Child(chain)
+			if err != nil {
+				return found, err
+			}
+
+			for index, gap := uint32(0), 0; gap < k.GapLimit; index++ {
+				child, err := chainKey.Child(index)
+				if err != nil {
+					continue
+				}
+
+				address := child.Address()
+				if k.addAddress(address, FormatDerivationPath(chain, index)) {
+					found++
+				}
+
+				if used(address) {
+					gap = 0
+					k.NextIndex[chain] = index + 1
+				} else {
+					gap++
+				}
+			}
+		}
+
+		sort.SliceStable(k.Addresses, func(i, j int) bool {
+			a, _ := ParseDerivationPath(k.Addresses[i].Path)
+			b, _ := ParseDerivationPath(k.Addresses[j].Path)
+			return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+		})
+	}
+
+	return found, nil
+}
+
+func (k *WatchedKey) addAddress(address string, path string) bool {
+	for _, a := range k.Addresses {
+		if a.Address == address {
+			return false
+		}
+	}
+
+	k.Addresses = append(k.Addresses, DerivedAddress{Address: address, Path: path})
+	return true
+}
+
+// Every watched address, the imported ones first
+func (w *WatchOnlyWallet) AllAddresses() []string {
+	addresses := append([]string{}, w.Addresses...)
+	for _, k := range w.Keys {
+		for _, a := range k.Addresses {
+			addresses = append(addresses, a.Address)
+		}
+	}
+
+	return addresses
+}
+
+func (w *WatchOnlyWallet) HasAddress(address string) bool {
+	for _, a := range w.AllAddresses() {
+		if a == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Derivation path of an address from its extended key, empty for imported
+// addresses
+func (w *WatchOnlyWallet) DerivationPath(address string) string {
+	for _, k := range w.Keys {
+		for _, a := range k.Addresses {
+			if a.Address == address {
+				return a.Path
+			}
+		}
+	}
+
+	return ""
+}
+
+// Next unused change address of the first extended key, or the first
+// imported address when there is none
+func (w *WatchOnlyWallet) ChangeAddress() (string, error) {
+	for _, k := range w.Keys {
+		path := FormatDerivationPath(CHANGE_CHAIN, k.NextIndex[CHANGE_CHAIN])
+		for _, a := range k.Addresses {
+			if a.Path == path {
+				return a.Address, nil
+			}
+		}
+	}
+
+	if len(w.Addresses) > 0 {
+		return w.Addresses[0], nil
+	}
+
+	return "", errors.New("watch-only wallet has no addresses")
+}
+
+func (w *WatchOnlyWallet) GetSpendableUTXOs(utxoSet *utxo.UTXOSet) []*utxo.UTXO {
+	utxos := make([]*utxo.UTXO, 0)
+	for _, address := range w.AllAddresses() {
+		utxos = append(utxos, utxoSet.GetSpendableUTXOsForAddress(address)...)
+	}
+
+	return utxos
+}
+
+// Build an unsigned transaction paying every recipient from the UTXOs the
+// selector picks among the watched addresses
+func (w *WatchOnlyWallet) CreateTransaction(payments []transaction.Payment, fee common.Amount, utxoSet *utxo.UTXOSet, selector utxo.CoinSelector, msg ...string) (*transaction.Transaction, *utxo.Selection, error) {
+	if len(payments) == 0 {
+		return nil, nil, errors.New("at least one payment is required")
+	}
+
+	if fee < common.MIN_FEE {
+		return nil, nil, errors.New("fee less than min")
+	}
+
+	var total common.Amount
+	for _, p := range payments {
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	changeAddress, err := w.ChangeAddress()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selection, err := selector.Select(w.GetSpendableUTXOs(utxoSet), total, fee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := transaction.NewMultiOwnerTransaction(selection.UTXOs, nil, payments, selection.Fee, changeAddress, msg...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, selection, nil
+}
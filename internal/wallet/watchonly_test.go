@@ -0,0 +1,105 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/FilipeJohansson/go-coin/pkg/common"
+)
+
+func testUsed(addresses ...string) func(address string) bool {
+	used := make(map[string]bool)
+	for _, a := range addresses {
+		used[a] = true
+	}
+
+	return func(address string) bool {
+		return used[address]
+	}
+}
+
+func TestScanGapLimit(t *testing.T) {
+	master := testMasterKey(t, common.KEY_TYPE_SCHNORR)
+	address := func(path string) string {
+		return testDerive(t, master, path).Address()
+	}
+
+	w := NewWatchOnlyWallet()
+	if err := w.ImportExtendedKey(master.Neuter().String(), 3); err != nil {
+		t.Fatalf("ImportExtendedKey() error: %s", err)
+	}
+
+	// 0/7 is past the gap of three unused addresses after 0/2
+	used := []string{address("0/2"), address("0/7"), address("1/0")}
+	found, err := w.Scan(testUsed(used...))
+	if err != nil {
+		t.Fatalf("Scan() error: %s", err)
+	}
+
+	// 0/0 to 0/5 and 1/0 to 1/3
+	if found != 10 {
+		t.Errorf("Scan() found %d addresses, want 10", found)
+	}
+	if w.Keys[0].NextIndex != [2]uint32{3, 1} {
+		t.Errorf("Scan() next indexes %v, want [3 1]", w.Keys[0].NextIndex)
+	}
+	if w.HasAddress(address("0/6")) || w.HasAddress(address("0/7")) {
+		t.Error("Scan() derived past the gap limit")
+	}
+	if path := w.DerivationPath(address("0/5")); path != "0/5" {
+		t.Errorf("DerivationPath() = %q, want 0/5", path)
+	}
+
+	change, err := w.ChangeAddress()
+	if err != nil {
+		t.Fatalf("ChangeAddress() error: %s", err)
+	}
+	if change != address("1/1") {
+		t.Errorf("ChangeAddress() = %s, want the address of 1/1", change)
+	}
+
+	// Once 0/5 is used, the gap moves and 0/6 to 0/10 are found
+	found, err = w.Scan(testUsed(append(used, address("0/5"))...))
+	if err != nil {
+		t.Fatalf("Scan() error: %s", err)
+	}
+
+	if found != 5 {
+		t.Errorf("Scan() found %d new addresses, want 5", found)
+	}
+	if w.Keys[0].NextIndex != [2]uint32{8, 1} {
+		t.Errorf("Scan() next indexes %v, want [8 1]", w.Keys[0].NextIndex)
+	}
+	if !w.HasAddress(address("0/7")) {
+		t.Error("Scan() didn't find 0/7")
+	}
+}
+
+func TestImportExtendedKeyRejects(t *testing.T) {
+	master := testMasterKey(t, common.KEY_TYPE_P256)
+
+	tests := []struct {
+		name     string
+		encoded  string
+		gapLimit int
+	}{
+		{"private key", master.String(), DEFAULT_GAP_LIMIT},
+		{"no gap", master.Neuter().String(), 0},
+		{"invalid key", "xpub1111", DEFAULT_GAP_LIMIT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewWatchOnlyWallet().ImportExtendedKey(tt.encoded, tt.gapLimit); err == nil {
+				t.Error("ImportExtendedKey() should fail")
+			}
+		})
+	}
+
+	w := NewWatchOnlyWallet()
+	if err := w.ImportExtendedKey(master.Neuter().String(), DEFAULT_GAP_LIMIT); err != nil {
+		t.Fatalf("ImportExtendedKey() error: %s", err)
+	}
+	if err := w.ImportExtendedKey(master.Neuter().String(), DEFAULT_GAP_LIMIT); err == nil {
+		t.Error("ImportExtendedKey() of a watched key should fail")
+	}
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Quantity of coins in base units. Arithmetic on amounts is checked, so
+// totals can't silently wrap around or exceed MAX_MONEY
+type Amount uint64
+
+// No amount, alone or summed, can be above this
+const MAX_MONEY Amount = 21000000 * COINS_PER_UNIT
+
+// Decimal places of a coin, COINS_PER_UNIT being 10^AMOUNT_DECIMALS
+const AMOUNT_DECIMALS = 6
+
+var ErrAmountOverflow = errors.New("amount exceeds the maximum money supply")
+var ErrAmountUnderflow = errors.New("amount would be negative")
+
+func (a Amount) IsValid() bool {
+	return a <= MAX_MONEY
+}
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum, carry := bits.Add64(uint64(a), uint64(b), 0)
+	if carry != 0 || Amount(sum) > MAX_MONEY {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(sum), nil
+}
+
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, ErrAmountUnderflow
+	}
+	return a - b, nil
+}
+
+// Checked sum of all the amounts
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// Exact decimal representation in coins, e.g. 1.500000
+func (a Amount) String() string {
+	return fmt.Sprintf("%d.%06d", uint64(a)/COINS_PER_UNIT, uint64(a)%COINS_PER_UNIT)
+}
+
+// Parse a decimal amount of coins, e.g. "1.5", without going through floats.
+// More decimal places than a base unit can hold are rejected
+func ParseAmount(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("amount cannot be empty")
+	}
+
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if whole == "" && (!hasPoint || fraction == "") {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	if len(fraction) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("invalid amount %q: at most %d decimal places", value, AMOUNT_DECIMALS)
+	}
+
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	var units uint64
+	digits := whole + fraction + strings.Repeat("0", AMOUNT_DECIMALS-len(fraction))
+	for _, c := range digits {
+		units = units*10 + uint64(c-'0')
+		if Amount(units) > MAX_MONEY {
+			return 0, ErrAmountOverflow
+		}
+	}
+
+	return Amount(units), nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// Schnorr signatures checked together, as BIP340 batch verification: with a
+// random weight a for each, the sum of a*s*G must equal the sum of a*R plus
+// a*e*P. One multiplication by G replaces one per signature, and the batch
+// fails if any of them is invalid, without telling which
+type SchnorrBatch struct {
+	entries []schnorrBatchEntry
+}
+
+type schnorrBatchEntry struct {
+	r btcec.JacobianPoint
+	s btcec.ModNScalar
+	e btcec.ModNScalar
+	p btcec.JacobianPoint
+}
+
+func NewSchnorrBatch() *SchnorrBatch {
+	return &SchnorrBatch{}
+}
+
+func (b *SchnorrBatch) Len() int {
+	return len(b.entries)
+}
+
+// Add a signature of a 32 byte hash to check later. Only malformed
+// signatures and keys are rejected now
+func (b *SchnorrBatch) Add(key *PublicKey, hash []byte, signature []byte) error {
+	if key.Type != KEY_TYPE_SCHNORR {
+		return errors.New("only schnorr signatures can be batched")
+	}
+
+	if len(hash) != 32 {
+		return errors.New("hash must be 32 bytes")
+	}
+
+	if len(signature) != schnorr.SignatureSize {
+		return errors.New("invalid schnorr signature size")
+	}
+
+	encodedKey := key.Encode()[1:]
+	parsedKey, err := schnorr.ParsePubKey(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	var entry schnorrBatchEntry
+	parsedKey.AsJacobian(&entry.p)
+
+	// R is the point of even Y with the signature r as X
+	var x btcec.FieldVal
+	if overflow := x.SetByteSlice(signature[:32]); overflow {
+		return errors.New("schnorr signature r is out of range")
+	}
+
+	var y btcec.FieldVal
+	if !btcec.DecompressY(&x, false, &y) {
+		return errors.New("schnorr signature r is not on the curve")
+	}
+	y.Normalize()
+	entry.r = btcec.MakeJacobianPoint(&x, &y, new(btcec.FieldVal).SetInt(1))
+
+	if overflow := entry.s.SetByteSlice(signature[32:]); overflow {
+		return errors.New("schnorr signature s is out of range")
+	}
+
+	challenge := taggedHash("BIP0340/challenge", signature[:32], encodedKey, hash)
+	entry.e.SetByteSlice(challenge)
+
+	b.entries = append(b.entries, entry)
+	return nil
+}
+
+// Whether every signature added is valid. An empty batch is valid
+func (b *SchnorrBatch) Verify() bool {
+	var sum btcec.ModNScalar
+	var total btcec.JacobianPoint
+	for i, entry := range b.entries {
+		// The first weight is 1, the others are random so invalid
+		// signatures can't cancel each other out
+		var a btcec.ModNScalar
+		if i == 0 {
+			a.SetInt(1)
+		} else if !randomScalar(&a) {
+			return false
+		}
+
+		var as, ae btcec.ModNScalar
+		sum.Add(as.Mul2(&a, &entry.s))
+
+		var aR, aeP, next btcec.JacobianPoint
+		btcec.ScalarMultNonConst(&a, &entry.r, &aR)
+		btcec.ScalarMultNonConst(ae.Mul2(&a, &entry.e), &entry.p, &aeP)
+		btcec.AddNonConst(&total, &aR, &next)
+		btcec.AddNonConst(&next, &aeP, &total)
+	}
+
+	// The sums are equal if adding -sum(a*s)*G gives the point at infinity
+	var sG, result btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(sum.Negate(), &sG)
+	btcec.AddNonConst(&total, &sG, &result)
+
+	return (result.X.IsZero() && result.Y.IsZero()) || result.Z.IsZero()
+}
+
+func randomScalar(a *btcec.ModNScalar) bool {
+	var buf [32]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return false
+		}
+
+		if overflow := a.SetBytes(&buf); overflow == 0 && !a.IsZero() {
+			return true
+		}
+	}
+}
+
+// BIP340 tagged hash: sha256(sha256(tag) || sha256(tag) || data)
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	hasher := sha256.New()
+	hasher.Write(tagHash[:])
+	hasher.Write(tagHash[:])
+	for _, d := range data {
+		hasher.Write(d)
+	}
+
+	return hasher.Sum(nil)
+}
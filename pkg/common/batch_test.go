@@ -0,0 +1,116 @@
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func testSchnorrSignature(t *testing.T, seed int) (*PublicKey, []byte, []byte) {
+	t.Helper()
+
+	d := sha256.Sum256([]byte(fmt.Sprintf("schnorr key %d", seed)))
+	key, err := NewPrivateKey(KEY_TYPE_SCHNORR, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("message %d", seed)))
+	signature, err := key.SignHash(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key.GetPublicKey(), hash[:], signature
+}
+
+func TestSchnorrBatchVerify(t *testing.T) {
+	batch := NewSchnorrBatch()
+	if !batch.Verify() {
+		t.Error("empty batch should verify")
+	}
+
+	for seed := 0; seed < 5; seed++ {
+		key, hash, signature := testSchnorrSignature(t, seed)
+		if err := batch.Add(key, hash, signature); err != nil {
+			t.Fatalf("Add() error: %s", err)
+		}
+	}
+
+	if batch.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", batch.Len())
+	}
+
+	if !batch.Verify() {
+		t.Error("batch of valid signatures should verify")
+	}
+}
+
+func TestSchnorrBatchRejectsInvalidSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(hash []byte, signature []byte)
+	}{
+		{"other hash", func(hash []byte, signature []byte) { hash[0] ^= 1 }},
+		{"other s", func(hash []byte, signature []byte) { signature[63] ^= 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := NewSchnorrBatch()
+			for seed := 0; seed < 3; seed++ {
+				key, hash, signature := testSchnorrSignature(t, seed)
+				if seed == 1 {
+					tt.tamper(hash, signature)
+				}
+
+				if err := batch.Add(key, hash, signature); err != nil {
+					t.Fatalf("Add() error: %s", err)
+				}
+			}
+
+			if batch.Verify() {
+				t.Error("batch with an invalid signature should fail")
+			}
+		})
+	}
+}
+
+func TestSchnorrBatchAddRejects(t *testing.T) {
+	key, hash, signature := testSchnorrSignature(t, 0)
+
+	p256, err := NewPrivateKey(KEY_TYPE_P256, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       *PublicKey
+		hash      []byte
+		signature []byte
+	}{
+		{"not schnorr", p256.GetPublicKey(), hash, signature},
+		{"short hash", key, hash[:31], signature},
+		{"short signature", key, hash, signature[:63]},
+		{"r out of range", key, hash, append(repeat(0xff, 32), signature[32:]...)},
+		{"s out of range", key, hash, append(append([]byte{}, signature[:32]...), repeat(0xff, 32)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewSchnorrBatch().Add(tt.key, tt.hash, tt.signature); err == nil {
+				t.Error("Add() should fail")
+			}
+		})
+	}
+}
+
+func repeat(b byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = b
+	}
+
+	return data
+}
@@ -1,12 +1,9 @@
 package common
 
 import (
-	"crypto/ecdh"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/sha256"
+	"errors"
 	"fmt"
-	"math/big"
 	"strings"
 
 	"github.com/btcsuite/btcutil/base58"
@@ -14,77 +11,111 @@ import (
 
 const COINS_PER_UNIT = 1000000
 const MIN_FEE = 1000
+const BLOCK_REWARD = 50 * COINS_PER_UNIT
 
 const INITIAL_DIFFICULTY = 2
 const TARGET_BLOCK_TIME = 3              // in seconds
 const DIFFICULTY_ADJUSTMENT_INTERVAL = 5 // each n blocks
 const MAX_TXS_PER_BLOCK = 10
 
-func GetAddressFromPublicKey(key ecdsa.PublicKey) string {
-	data := append(key.X.Bytes(), key.Y.Bytes()...)
+// Deployments change state every window, locking in when enough of its
+// blocks signal for them
+const DEPLOYMENT_WINDOW = 10   // blocks
+const DEPLOYMENT_THRESHOLD = 8 // signalling blocks per window
 
-	// First hash - SHA256
-	hasher := sha256.New()
-	hasher.Write(data)
-	hashBytes := hasher.Sum(nil)
+// Fee charged for each input picked by coin selection, the cost of spending
+// one more output at the relay fee rate
+const INPUT_FEE = 100
 
-	// Second hash - SHA256
-	hasher = sha256.New()
-	hasher.Write(hashBytes)
-	addressBytes := hasher.Sum(nil)
+// Outputs worth less than spending them a few times over are dust: relayed
+// by no one, and folded into the fee when they would be change
+const DUST_RELAY_FACTOR = 3
+const DUST_THRESHOLD = DUST_RELAY_FACTOR * INPUT_FEE
 
-	return base58.Encode(addressBytes)
-}
+// Largest payload of a data carrier output, and the fee it adds per byte
+const MAX_DATA_CARRIER_SIZE = 80
+const DATA_FEE_PER_BYTE = 10
+
+// Longest message a transaction can carry, in bytes
+const MAX_MESSAGE_LENGTH = 256
+
+// Lock times below this are block heights, from it on Unix timestamps
+const LOCKTIME_THRESHOLD = 500000000
 
-func GetPublicKeyHash(key ecdsa.PublicKey) string {
-	data := append(key.X.Bytes(), key.Y.Bytes()...)
-	return base58.Encode([]byte(data))
+func GetAddressFromPublicKey(key PublicKey) string {
+	return base58.Encode(key.AddressHash())
 }
 
-func GetPrivateKeyHash(key ecdsa.PrivateKey) string {
-	return base58.Encode(key.D.Bytes())
+// The raw bytes behind an address, before the Base58 encoding
+func GetAddressHashFromPublicKey(key PublicKey) []byte {
+	return key.AddressHash()
 }
 
-func GetPrivateKeyFromHash(encoded string) *ecdsa.PrivateKey {
-	decoded := base58.Decode(encoded)
-	if len(decoded) == 0 {
-		return nil
+func DecodeAddress(address string) ([]byte, error) {
+	decoded := base58.Decode(address)
+	if len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid address %q", address)
 	}
 
-	if len(decoded) < 32 {
-		padded := make([]byte, 32)
-		copy(padded[32-len(decoded):], decoded)
-		decoded = padded
+	return decoded, nil
+}
+
+// P-256 keys are printed as their raw coordinates, other keys in their
+// compressed encoding
+func GetPublicKeyHash(key PublicKey) string {
+	if key.Type != KEY_TYPE_P256 {
+		return base58.Encode(key.Encode())
 	}
 
-	d := new(big.Int).SetBytes(decoded)
-	curve := elliptic.P256()
+	data := make([]byte, 64)
+	key.X.FillBytes(data[:32])
+	key.Y.FillBytes(data[32:])
+	return base58.Encode(data)
+}
 
-	privateKey := &ecdsa.PrivateKey{
-		D: d,
-		PublicKey: ecdsa.PublicKey{
-			Curve: curve,
-		},
+// Parse a public key in the Base58 form printed by the wallet
+func GetPublicKeyFromHash(encoded string) (*PublicKey, error) {
+	decoded := base58.Decode(encoded)
+	if len(decoded) == 64 {
+		decoded = append([]byte{0x04}, decoded...)
 	}
 
-	ecdhKey, err := ecdh.P256().NewPrivateKey(decoded)
+	key, err := DecodePublicKey(decoded)
 	if err != nil {
-		// err
-		return nil
+		return nil, fmt.Errorf("invalid public key %q: %w", encoded, err)
+	}
+
+	return key, nil
+}
+
+// P-256 keys are the bare scalar, other keys are prefixed with their type
+func GetPrivateKeyHash(key PrivateKey) string {
+	if key.Type == KEY_TYPE_P256 {
+		return base58.Encode(key.D.Bytes())
 	}
 
-	ecdhPubKey := ecdhKey.PublicKey()
-	pubKeyBytes := ecdhPubKey.Bytes()
+	return base58.Encode(append([]byte{byte(key.Type)}, key.D.FillBytes(make([]byte, 32))...))
+}
 
-	if len(pubKeyBytes) != 65 || pubKeyBytes[0] != 0x04 {
-		// err
-		return nil
+// Parse a private key in the Base58 form printed by the wallet
+func GetPrivateKeyFromHash(encoded string) (*PrivateKey, error) {
+	decoded := base58.Decode(encoded)
+	if len(decoded) == 0 || len(decoded) > 33 {
+		return nil, errors.New("invalid private key")
 	}
 
-	privateKey.PublicKey.X = new(big.Int).SetBytes(pubKeyBytes[1:33])
-	privateKey.PublicKey.Y = new(big.Int).SetBytes(pubKeyBytes[33:65])
+	keyType := KEY_TYPE_P256
+	if len(decoded) == 33 {
+		keyType = KeyType(decoded[0])
+		decoded = decoded[1:]
+	}
+
+	privateKey, err := NewPrivateKey(keyType, decoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
 
-	return privateKey
+	return privateKey, nil
 }
 
 func BuildBox(lines ...string) string {
@@ -0,0 +1,348 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// Version byte of WIF encoded private keys
+const WIF_VERSION = 0x80
+
+// Names accepted by EncodePrivateKey and DecodePrivateKey. base58 is the
+// bare key printed by the wallet, with no checksum
+var KeyFormats = []string{"wif", "pem", "jwk", "base58"}
+
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// First 4 bytes of the double SHA-256 of the data
+func Checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// Encode a private key in the given format. PEM loses the Schnorr key type,
+// it must be forced for Schnorr keys
+func EncodePrivateKey(key PrivateKey, format string, force ...bool) (string, error) {
+	switch format {
+	case "wif":
+		return EncodePrivateKeyWIF(key), nil
+	case "pem":
+		return EncodePrivateKeyPEM(key, force...)
+	case "jwk":
+		return EncodePrivateKeyJWK(key)
+	case "base58":
+		return GetPrivateKeyHash(key), nil
+	}
+
+	return "", fmt.Errorf("unknown key format %q, expected one of %s", format, strings.Join(KeyFormats, ", "))
+}
+
+// Parse a private key in the given format. PEM keys don't tell ECDSA and
+// Schnorr secp256k1 keys apart, the key type must be given for them
+func DecodePrivateKey(encoded string, format string, keyType ...KeyType) (*PrivateKey, error) {
+	switch format {
+	case "wif":
+		return DecodePrivateKeyWIF(encoded)
+	case "pem":
+		return DecodePrivateKeyPEM([]byte(encoded), keyType...)
+	case "jwk":
+		return DecodePrivateKeyJWK([]byte(encoded), keyType...)
+	case "base58":
+		return GetPrivateKeyFromHash(encoded)
+	}
+
+	return nil, fmt.Errorf("unknown key format %q, expected one of %s", format, strings.Join(KeyFormats, ", "))
+}
+
+// Private key in WIF or in the bare base58 form, told apart by their length
+func ParsePrivateKey(encoded string) (*PrivateKey, error) {
+	if len(base58.Decode(encoded)) == wifLength {
+		return DecodePrivateKeyWIF(encoded)
+	}
+
+	return GetPrivateKeyFromHash(encoded)
+}
+
+// Version, 32 byte scalar, key type and checksum
+const wifLength = 1 + 32 + 1 + 4
+
+// Wallet import format: the scalar between a version byte and the key type,
+// Base58 encoded with a checksum so mistyped keys are caught
+func EncodePrivateKeyWIF(key PrivateKey) string {
+	data := make([]byte, 0, wifLength)
+	data = append(data, WIF_VERSION)
+	data = append(data, key.D.FillBytes(make([]byte, 32))...)
+	data = append(data, byte(key.Type))
+
+	return base58.Encode(append(data, Checksum(data)...))
+}
+
+func DecodePrivateKeyWIF(encoded string) (*PrivateKey, error) {
+	decoded := base58.Decode(encoded)
+	if len(decoded) != wifLength {
+		return nil, errors.New("invalid WIF private key length")
+	}
+
+	data := decoded[:wifLength-4]
+	if !bytes.Equal(Checksum(data), decoded[wifLength-4:]) {
+		return nil, errors.New("invalid WIF private key checksum")
+	}
+
+	if data[0] != WIF_VERSION {
+		return nil, fmt.Errorf("invalid WIF version %d", data[0])
+	}
+
+	return NewPrivateKey(KeyType(data[33]), data[1:33])
+}
+
+// PKCS #8 PrivateKeyInfo and the SEC 1 ECPrivateKey it wraps
+type pkcs8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+func (t KeyType) curveOID() asn1.ObjectIdentifier {
+	if t == KEY_TYPE_P256 {
+		return oidNamedCurveP256
+	}
+
+	return oidNamedCurveSecp256k1
+}
+
+// PKCS #8 PEM, readable by OpenSSL. It has no way to record a Schnorr key
+// type, so Schnorr keys are only written, as the secp256k1 keys they are,
+// when forced
+func EncodePrivateKeyPEM(key PrivateKey, force ...bool) (string, error) {
+	if key.Type == KEY_TYPE_SCHNORR && (len(force) == 0 || !force[0]) {
+		return "", errors.New("PEM can't record a schnorr key type, use WIF or JWK, or force it and give the key type on import")
+	}
+
+	point := make([]byte, 65)
+	point[0] = 0x04
+	key.X.FillBytes(point[1:33])
+	key.Y.FillBytes(point[33:])
+
+	ecKey, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: key.D.FillBytes(make([]byte, 32)),
+		PublicKey:  asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	params, err := asn1.Marshal(key.Type.curveOID())
+	if err != nil {
+		return "", err
+	}
+
+	der, err := asn1.Marshal(pkcs8{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PrivateKey: ecKey,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Parse a PKCS #8 or SEC 1 PEM private key on P-256 or secp256k1. A
+// secp256k1 key may be an ECDSA or a Schnorr key, its type must be given
+func DecodePrivateKeyPEM(data []byte, keyType ...KeyType) (*PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var curveOID asn1.ObjectIdentifier
+	ecDER := block.Bytes
+	switch block.Type {
+	case "PRIVATE KEY":
+		var info pkcs8
+		if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+			return nil, fmt.Errorf("invalid PKCS #8 private key: %w", err)
+		}
+
+		if !info.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+			return nil, errors.New("not an elliptic curve private key")
+		}
+
+		if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curveOID); err != nil {
+			return nil, errors.New("elliptic curve private key without a named curve")
+		}
+		ecDER = info.PrivateKey
+	case "EC PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	var ecKey ecPrivateKey
+	if _, err := asn1.Unmarshal(ecDER, &ecKey); err != nil {
+		return nil, fmt.Errorf("invalid EC private key: %w", err)
+	}
+
+	if curveOID == nil {
+		curveOID = ecKey.NamedCurveOID
+	}
+
+	var t KeyType
+	switch {
+	case curveOID.Equal(oidNamedCurveP256):
+		t = KEY_TYPE_P256
+	case curveOID.Equal(oidNamedCurveSecp256k1):
+		if len(keyType) == 0 {
+			return nil, errors.New("a secp256k1 PEM key can be an ECDSA or a schnorr key, its key type is required")
+		}
+		t = KEY_TYPE_SECP256K1
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", curveOID)
+	}
+
+	t, err := chooseKeyType(t, keyType...)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := NewPrivateKey(t, ecKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if point := ecKey.PublicKey.Bytes; len(point) > 0 {
+		if len(point) != 65 || new(big.Int).SetBytes(point[1:33]).Cmp(key.X) != 0 || new(big.Int).SetBytes(point[33:]).Cmp(key.Y) != 0 {
+			return nil, errors.New("public key does not match the private key")
+		}
+	}
+
+	return key, nil
+}
+
+// JSON Web Key of an elliptic curve key, RFC 7518 and RFC 8812
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Alg string `json:"alg,omitempty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d,omitempty"`
+}
+
+// JWK curve and algorithm names of each key type. BIP340 has no registered
+// algorithm, the name marks Schnorr keys
+var jwkCurves = []string{"P-256", "secp256k1", "secp256k1"}
+var jwkAlgorithms = []string{"ES256", "ES256K", "BIP340"}
+
+func EncodePrivateKeyJWK(key PrivateKey) (string, error) {
+	if !key.Type.IsValid() {
+		return "", fmt.Errorf("unknown key type %d", uint8(key.Type))
+	}
+
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+	}
+
+	data, err := json.MarshalIndent(JWK{
+		Kty: "EC",
+		Crv: jwkCurves[key.Type],
+		Alg: jwkAlgorithms[key.Type],
+		X:   encode(key.X),
+		Y:   encode(key.Y),
+		D:   encode(key.D),
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func DecodePrivateKeyJWK(data []byte, keyType ...KeyType) (*PrivateKey, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+
+	if jwk.Kty != "EC" {
+		return nil, fmt.Errorf("unsupported JWK key type %q", jwk.Kty)
+	}
+
+	if jwk.D == "" {
+		return nil, errors.New("JWK has no private key")
+	}
+
+	var t KeyType
+	switch {
+	case jwk.Crv == "P-256":
+		t = KEY_TYPE_P256
+	case jwk.Crv == "secp256k1" && jwk.Alg == jwkAlgorithms[KEY_TYPE_SCHNORR]:
+		t = KEY_TYPE_SCHNORR
+	case jwk.Crv == "secp256k1":
+		t = KEY_TYPE_SECP256K1
+	default:
+		return nil, fmt.Errorf("unsupported JWK curve %q", jwk.Crv)
+	}
+
+	t, err := chooseKeyType(t, keyType...)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(jwk.D)
+	if err != nil {
+		return nil, errors.New("invalid JWK private key")
+	}
+
+	key, err := NewPrivateKey(t, d)
+	if err != nil {
+		return nil, err
+	}
+
+	x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if errX != nil || errY != nil || new(big.Int).SetBytes(x).Cmp(key.X) != 0 || new(big.Int).SetBytes(y).Cmp(key.Y) != 0 {
+		return nil, errors.New("public key does not match the private key")
+	}
+
+	return key, nil
+}
+
+// Key type asked for, if any, as long as it uses the curve of the key
+func chooseKeyType(found KeyType, keyType ...KeyType) (KeyType, error) {
+	if len(keyType) == 0 {
+		return found, nil
+	}
+
+	if keyType[0].Curve() != found.Curve() {
+		return 0, fmt.Errorf("a %s key can't be used as a %s key", found, keyType[0])
+	}
+
+	return keyType[0], nil
+}
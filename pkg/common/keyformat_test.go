@@ -0,0 +1,227 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+var testKeyTypes = []KeyType{KEY_TYPE_P256, KEY_TYPE_SECP256K1, KEY_TYPE_SCHNORR}
+
+func testPrivateKey(t *testing.T, keyType KeyType, seed int) *PrivateKey {
+	t.Helper()
+
+	d := sha256.Sum256([]byte(fmt.Sprintf("format key %d", seed)))
+	key, err := NewPrivateKey(keyType, d[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func checkSameKey(t *testing.T, got *PrivateKey, want *PrivateKey) {
+	t.Helper()
+
+	if got.Type != want.Type || got.D.Cmp(want.D) != 0 || got.X.Cmp(want.X) != 0 || got.Y.Cmp(want.Y) != 0 {
+		t.Errorf("decoded %s key %x, want %s key %x", got.Type, got.D, want.Type, want.D)
+	}
+}
+
+func TestPrivateKeyFormatRoundTrip(t *testing.T) {
+	for _, keyType := range testKeyTypes {
+		for _, format := range KeyFormats {
+			t.Run(format+" "+keyType.String(), func(t *testing.T) {
+				key := testPrivateKey(t, keyType, 1)
+
+				// Only PEM needs the Schnorr key type forced on export and
+				// given back on import
+				encoded, err := EncodePrivateKey(*key, format, true)
+				if err != nil {
+					t.Fatalf("EncodePrivateKey() error: %s", err)
+				}
+
+				var decoded *PrivateKey
+				if format == "pem" && keyType != KEY_TYPE_P256 {
+					decoded, err = DecodePrivateKey(encoded, format, keyType)
+				} else {
+					decoded, err = DecodePrivateKey(encoded, format)
+				}
+				if err != nil {
+					t.Fatalf("DecodePrivateKey() error: %s", err)
+				}
+
+				checkSameKey(t, decoded, key)
+			})
+		}
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := testPrivateKey(t, KEY_TYPE_SCHNORR, 1)
+
+	for _, encoded := range []string{EncodePrivateKeyWIF(*key), GetPrivateKeyHash(*key)} {
+		decoded, err := ParsePrivateKey(encoded)
+		if err != nil {
+			t.Fatalf("ParsePrivateKey() error: %s", err)
+		}
+
+		if decoded.D.Cmp(key.D) != 0 {
+			t.Errorf("ParsePrivateKey(%s) decoded another key", encoded)
+		}
+	}
+}
+
+func TestDecodePrivateKeyWIFRejects(t *testing.T) {
+	key := testPrivateKey(t, KEY_TYPE_SECP256K1, 1)
+	decoded := base58.Decode(EncodePrivateKeyWIF(*key))
+	data := decoded[:wifLength-4]
+
+	// Valid checksum over the given data
+	encode := func(data []byte) string {
+		return base58.Encode(append(append([]byte{}, data...), Checksum(data)...))
+	}
+
+	badChecksum := append([]byte{}, decoded...)
+	badChecksum[wifLength-1] ^= 1
+
+	badVersion := append([]byte{}, data...)
+	badVersion[0] = WIF_VERSION + 1
+
+	badKeyType := append([]byte{}, data...)
+	badKeyType[33] = byte(len(KeyTypes))
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"bad checksum", base58.Encode(badChecksum)},
+		{"bad version", encode(badVersion)},
+		{"unknown key type", encode(badKeyType)},
+		{"truncated", encode(data[:32])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePrivateKeyWIF(tt.encoded); err == nil {
+				t.Error("DecodePrivateKeyWIF() should fail")
+			}
+		})
+	}
+}
+
+func TestPrivateKeyPEMKeyType(t *testing.T) {
+	schnorr := testPrivateKey(t, KEY_TYPE_SCHNORR, 1)
+	if _, err := EncodePrivateKeyPEM(*schnorr); err == nil {
+		t.Error("EncodePrivateKeyPEM() of a schnorr key should fail unless forced")
+	}
+
+	secp256k1, err := EncodePrivateKeyPEM(*testPrivateKey(t, KEY_TYPE_SECP256K1, 1))
+	if err != nil {
+		t.Fatalf("EncodePrivateKeyPEM() error: %s", err)
+	}
+
+	p256, err := EncodePrivateKeyPEM(*testPrivateKey(t, KEY_TYPE_P256, 1))
+	if err != nil {
+		t.Fatalf("EncodePrivateKeyPEM() error: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		pem     string
+		keyType []KeyType
+	}{
+		{"secp256k1 without key type", secp256k1, nil},
+		{"secp256k1 as p256", secp256k1, []KeyType{KEY_TYPE_P256}},
+		{"p256 as schnorr", p256, []KeyType{KEY_TYPE_SCHNORR}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePrivateKeyPEM([]byte(tt.pem), tt.keyType...); err == nil {
+				t.Error("DecodePrivateKeyPEM() should fail")
+			}
+		})
+	}
+}
+
+func TestPrivateKeyMismatchedPublicKey(t *testing.T) {
+	for _, keyType := range []KeyType{KEY_TYPE_P256, KEY_TYPE_SECP256K1} {
+		t.Run(keyType.String(), func(t *testing.T) {
+			key := testPrivateKey(t, keyType, 1)
+			mismatched := *key
+			mismatched.PublicKey = testPrivateKey(t, keyType, 2).PublicKey
+
+			encoded, err := EncodePrivateKeyPEM(mismatched)
+			if err != nil {
+				t.Fatalf("EncodePrivateKeyPEM() error: %s", err)
+			}
+			if _, err := DecodePrivateKeyPEM([]byte(encoded), keyType); err == nil {
+				t.Error("DecodePrivateKeyPEM() with another public key should fail")
+			}
+
+			encoded, err = EncodePrivateKeyJWK(mismatched)
+			if err != nil {
+				t.Fatalf("EncodePrivateKeyJWK() error: %s", err)
+			}
+			if _, err := DecodePrivateKeyJWK([]byte(encoded)); err == nil {
+				t.Error("DecodePrivateKeyJWK() with another public key should fail")
+			}
+		})
+	}
+}
+
+func TestDecodePrivateKeyJWKRejects(t *testing.T) {
+	encoded, err := EncodePrivateKeyJWK(*testPrivateKey(t, KEY_TYPE_SCHNORR, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := func(change func(jwk *JWK)) string {
+		var key JWK
+		if err := json.Unmarshal([]byte(encoded), &key); err != nil {
+			t.Fatal(err)
+		}
+		change(&key)
+
+		data, err := json.Marshal(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not EC", jwk(func(key *JWK) { key.Kty = "RSA" })},
+		{"public only", jwk(func(key *JWK) { key.D = "" })},
+		{"unknown curve", jwk(func(key *JWK) { key.Crv = "P-384" })},
+		{"missing y", jwk(func(key *JWK) { key.Y = "" })},
+		{"not JSON", strings.TrimPrefix(encoded, "{")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePrivateKeyJWK([]byte(tt.encoded)); err == nil {
+				t.Error("DecodePrivateKeyJWK() should fail")
+			}
+		})
+	}
+}
+
+func TestUnknownKeyFormat(t *testing.T) {
+	key := testPrivateKey(t, KEY_TYPE_P256, 1)
+
+	if _, err := EncodePrivateKey(*key, "der"); err == nil {
+		t.Error("EncodePrivateKey() of an unknown format should fail")
+	}
+	if _, err := DecodePrivateKey("", "der"); err == nil {
+		t.Error("DecodePrivateKey() of an unknown format should fail")
+	}
+}
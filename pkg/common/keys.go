@@ -0,0 +1,304 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// Signature scheme of a key. P-256 is the original one, keys with no type
+// are P-256 keys
+type KeyType uint8
+
+const (
+	KEY_TYPE_P256      KeyType = iota // ECDSA over P-256
+	KEY_TYPE_SECP256K1                // ECDSA over secp256k1
+	KEY_TYPE_SCHNORR                  // BIP340 Schnorr over secp256k1
+)
+
+var KeyTypes = []string{"p256", "secp256k1", "schnorr"}
+
+func ParseKeyType(name string) (KeyType, error) {
+	for i, keyType := range KeyTypes {
+		if name == keyType {
+			return KeyType(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown key type %q, expected one of %s", name, strings.Join(KeyTypes, ", "))
+}
+
+func (t KeyType) IsValid() bool {
+	return int(t) < len(KeyTypes)
+}
+
+func (t KeyType) String() string {
+	if !t.IsValid() {
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+
+	return KeyTypes[t]
+}
+
+func (t KeyType) MarshalText() ([]byte, error) {
+	if !t.IsValid() {
+		return nil, fmt.Errorf("unknown key type %d", uint8(t))
+	}
+
+	return []byte(t.String()), nil
+}
+
+func (t *KeyType) UnmarshalText(text []byte) error {
+	keyType, err := ParseKeyType(string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = keyType
+	return nil
+}
+
+func (t KeyType) Curve() elliptic.Curve {
+	if t == KEY_TYPE_P256 {
+		return elliptic.P256()
+	}
+
+	return btcec.S256()
+}
+
+// A public key along with the signature scheme it is used with
+type PublicKey struct {
+	Type KeyType
+	ecdsa.PublicKey
+}
+
+type PrivateKey struct {
+	Type KeyType
+	ecdsa.PrivateKey
+}
+
+func GenerateKey(keyType KeyType) (*PrivateKey, error) {
+	if !keyType.IsValid() {
+		return nil, fmt.Errorf("unknown key type %d", uint8(keyType))
+	}
+
+	if keyType == KEY_TYPE_P256 {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PrivateKey{Type: keyType, PrivateKey: *key}, nil
+	}
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPrivateKey(keyType, key.Serialize())
+}
+
+// Rebuild a private key from its scalar, deriving the public key
+func NewPrivateKey(keyType KeyType, d []byte) (*PrivateKey, error) {
+	if !keyType.IsValid() {
+		return nil, fmt.Errorf("unknown key type %d", uint8(keyType))
+	}
+
+	curve := keyType.Curve()
+	scalar := new(big.Int).SetBytes(d)
+	if scalar.Sign() == 0 || scalar.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key out of range")
+	}
+
+	x, y := curve.ScalarBaseMult(scalar.FillBytes(make([]byte, 32)))
+	return &PrivateKey{
+		Type: keyType,
+		PrivateKey: ecdsa.PrivateKey{
+			D:         scalar,
+			PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		},
+	}, nil
+}
+
+// Schnorr public keys are x-only, standing for the point with an even Y
+func (k *PrivateKey) GetPublicKey() *PublicKey {
+	key := &PublicKey{Type: k.Type, PublicKey: k.PublicKey}
+	if k.Type == KEY_TYPE_SCHNORR && k.PublicKey.Y.Bit(0) == 1 {
+		key.Y = new(big.Int).Sub(key.Curve.Params().P, key.Y)
+	}
+
+	return key
+}
+
+func (k *PrivateKey) btcecKey() *btcec.PrivateKey {
+	key, _ := btcec.PrivKeyFromBytes(k.D.FillBytes(make([]byte, 32)))
+	return key
+}
+
+// Sign a 32 byte hash: DER encoded ECDSA for P-256 and secp256k1, 64 byte
+// BIP340 signature for Schnorr
+func (k *PrivateKey) SignHash(hash []byte) ([]byte, error) {
+	switch k.Type {
+	case KEY_TYPE_P256:
+		return ecdsa.SignASN1(rand.Reader, &k.PrivateKey, hash)
+	case KEY_TYPE_SECP256K1:
+		return btcecdsa.Sign(k.btcecKey(), hash).Serialize(), nil
+	case KEY_TYPE_SCHNORR:
+		signature, err := schnorr.Sign(k.btcecKey(), hash)
+		if err != nil {
+			return nil, err
+		}
+		return signature.Serialize(), nil
+	}
+
+	return nil, fmt.Errorf("unknown key type %d", uint8(k.Type))
+}
+
+func (k *PublicKey) VerifyHash(hash []byte, signature []byte) bool {
+	switch k.Type {
+	case KEY_TYPE_P256:
+		return ecdsa.VerifyASN1(&k.PublicKey, hash, signature)
+	case KEY_TYPE_SECP256K1:
+		parsed, err := btcecdsa.ParseDERSignature(signature)
+		if err != nil {
+			return false
+		}
+
+		key, err := btcec.ParsePubKey(k.Encode()[1:])
+		if err != nil {
+			return false
+		}
+
+		return parsed.Verify(hash, key)
+	case KEY_TYPE_SCHNORR:
+		parsed, err := schnorr.ParseSignature(signature)
+		if err != nil {
+			return false
+		}
+
+		key, err := schnorr.ParsePubKey(k.Encode()[1:])
+		if err != nil {
+			return false
+		}
+
+		return parsed.Verify(hash, key)
+	}
+
+	return false
+}
+
+// Check the key is a point of its curve, with an even Y for Schnorr keys
+func (k *PublicKey) Validate() error {
+	if !k.Type.IsValid() {
+		return fmt.Errorf("unknown key type %d", uint8(k.Type))
+	}
+
+	if k.X == nil || k.Y == nil || !k.Type.Curve().IsOnCurve(k.X, k.Y) {
+		return fmt.Errorf("invalid %s public key", k.Type)
+	}
+
+	if k.Type == KEY_TYPE_SCHNORR && k.Y.Bit(0) == 1 {
+		return errors.New("schnorr public key must have an even Y")
+	}
+
+	return nil
+}
+
+// Encoding pushed in scripts. P-256 keys keep the uncompressed SEC form so
+// existing scripts and addresses stay the same. Other keys are compressed,
+// prefixed with their type: 33 byte SEC for secp256k1, 32 byte x-only for
+// Schnorr
+func (k *PublicKey) Encode() []byte {
+	switch k.Type {
+	case KEY_TYPE_P256:
+		encoded := make([]byte, 65)
+		encoded[0] = 0x04
+		k.X.FillBytes(encoded[1:33])
+		k.Y.FillBytes(encoded[33:65])
+		return encoded
+	case KEY_TYPE_SCHNORR:
+		encoded := make([]byte, 33)
+		encoded[0] = byte(k.Type)
+		k.X.FillBytes(encoded[1:])
+		return encoded
+	}
+
+	return append([]byte{byte(k.Type)}, elliptic.MarshalCompressed(k.Curve, k.X, k.Y)...)
+}
+
+// Parse a key in any of the encodings of Encode. Compressed P-256 keys,
+// prefixed with their type too, are also accepted
+func DecodePublicKey(data []byte) (*PublicKey, error) {
+	if len(data) == 65 && data[0] == 0x04 {
+		key := &PublicKey{
+			Type: KEY_TYPE_P256,
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(data[1:33]),
+				Y:     new(big.Int).SetBytes(data[33:65]),
+			},
+		}
+		return key, key.Validate()
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("empty public key")
+	}
+
+	keyType := KeyType(data[0])
+	key := &PublicKey{Type: keyType}
+	switch {
+	case keyType == KEY_TYPE_P256 && len(data) == 34:
+		key.Curve = elliptic.P256()
+		key.X, key.Y = elliptic.UnmarshalCompressed(key.Curve, data[1:])
+		if key.X == nil {
+			return nil, errors.New("invalid p256 public key")
+		}
+	case keyType == KEY_TYPE_SECP256K1 && len(data) == 34:
+		parsed, err := btcec.ParsePubKey(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = *parsed.ToECDSA()
+	case keyType == KEY_TYPE_SCHNORR && len(data) == 33:
+		parsed, err := schnorr.ParsePubKey(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = *parsed.ToECDSA()
+	default:
+		return nil, fmt.Errorf("invalid public key encoding of %d bytes", len(data))
+	}
+
+	return key, key.Validate()
+}
+
+// The raw bytes behind an address, before the Base58 encoding. P-256
+// addresses hash the raw coordinates, as they always did, other keys their
+// encoding, so keys of different types never share an address
+func (k *PublicKey) AddressHash() []byte {
+	var data []byte
+	if k.Type == KEY_TYPE_P256 {
+		data = append(k.X.Bytes(), k.Y.Bytes()...)
+	} else {
+		data = k.Encode()
+	}
+
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+func (k *PublicKey) Equal(other *PublicKey) bool {
+	return k.Type == other.Type && k.X.Cmp(other.X) == 0 && k.Y.Cmp(other.Y) == 0
+}